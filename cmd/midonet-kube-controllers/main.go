@@ -32,10 +32,13 @@ import (
 	"github.com/midonet/midonet-kubernetes/pkg/controller"
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
 	"github.com/midonet/midonet-kubernetes/pkg/converter/endpoints"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/namespace"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/networkpolicy"
 	"github.com/midonet/midonet-kubernetes/pkg/converter/node"
 	"github.com/midonet/midonet-kubernetes/pkg/converter/pod"
 	"github.com/midonet/midonet-kubernetes/pkg/converter/service"
 	"github.com/midonet/midonet-kubernetes/pkg/k8s"
+	"github.com/midonet/midonet-kubernetes/pkg/loadbalancer"
 	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 	"github.com/midonet/midonet-kubernetes/pkg/nodeannotator"
 	"github.com/midonet/midonet-kubernetes/pkg/pusher"
@@ -110,10 +113,18 @@ func main() {
 			newController = service.NewController
 		case "endpoints":
 			newController = endpoints.NewController
+		case "endpointslice":
+			newController = endpoints.NewEndpointSliceController
 		case "pusher":
 			newController = pusher.NewController
 		case "nodeannotator":
 			newController = nodeannotator.NewController
+		case "loadbalancer":
+			newController = loadbalancer.NewController
+		case "networkpolicy":
+			newController = networkpolicy.NewController
+		case "namespace":
+			newController = namespace.NewController
 		}
 		c := newController(si, msi, k8sClientset, mnClientset, recorder, converterCfg, midonetCfg)
 		controllers = append(controllers, c)
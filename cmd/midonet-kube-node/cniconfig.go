@@ -25,23 +25,30 @@ const (
 {
   "name": "midonet-pod-network",
   "type": "midonet-kube-cni",
+  "mtu": {{ .MTU }},
   "ipam": {
-    "type": "host-local"
+    "type": "{{ .IPAMType }}"{{ if .IPAMDataDir }},
+    "dataDir": "{{ .IPAMDataDir }}"{{ end }}
   },
   "kubernetes": {
-    "podcidr": "{{ .PodCIDR }}"
+    "podcidr": "{{ .PodCIDR }}"{{ if .IPv6PodCIDR }},
+    "ipv6podcidr": "{{ .IPv6PodCIDR }}"{{ end }}
   }
 }`
 )
 
 type cniConfigData struct {
-	PodCIDR string
+	PodCIDR     string
+	IPv6PodCIDR string
+	MTU         int
+	IPAMType    string
+	IPAMDataDir string
 }
 
-func generateCNIConfig(writer io.Writer, podCIDR string) error {
+func generateCNIConfig(writer io.Writer, data *cniConfigData) error {
 	tmpl, err := template.New("cniconfig").Parse(cniConfigTemplate)
 	if err != nil {
 		return err
 	}
-	return tmpl.Execute(writer, &cniConfigData{PodCIDR: podCIDR})
+	return tmpl.Execute(writer, data)
 }
@@ -15,6 +15,8 @@
 package main
 
 import (
+	"net"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -29,13 +31,52 @@ type Config struct {
 	// Kubernetes Node name of this host
 	NodeName string `required:"true" split_words:"false"`
 
-	ClusterCIDR string `required:"true" split_words:"false"`
-	ServiceCIDR string `default:"" split_words:"false"`
+	// Comma separated lists of IPv4 and/or IPv6 CIDRs.
+	ClusterCIDR []string `required:"true" split_words:"false"`
+	ServiceCIDR []string `default:"" split_words:"false"`
+
+	// An optional IPv6 subnet for the Pods on this Node.
+	// As a Kubernetes Node has only a single PodCIDR, this needs
+	// to be configured separately for each Node.
+	IPv6PodCIDR string `default:"" split_words:"false"`
 
 	CNIConfigPath string `default:"" split_words:"false"`
+
+	// MTU for the veths of the Node and Pods.  0 means to detect it
+	// from the interface with the tunnel endpoint IP of the Node.
+	MTU int `default:"0" split_words:"false"`
+
+	// Type of the MidoNet Tunnel Zone for the Node.  It's used to
+	// calculate the tunnel overhead for the MTU detection.
+	TunnelZoneType string `default:"vxlan" split_words:"true"`
+
+	// IPAM type in the generated CNI network configuration.
+	// "midonet" is the built-in IPAM of midonet-kube-cni.
+	IPAMType string `default:"host-local" split_words:"true"`
+
+	// The directory where the built-in IPAM persists the allocations.
+	// It's also written to the generated CNI network configuration
+	// so that midonet-kube-cni uses the same directory.
+	IPAMDataDir string `default:"/var/lib/midonet-kube-cni/ipam" split_words:"true"`
 }
 
 // Parse parses envconfig and stores in Config struct
 func (c *Config) Parse() error {
 	return envconfig.Process("midonetkube", c)
 }
+
+// parseCIDRs parses a list of CIDRs, ignoring empty ones.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
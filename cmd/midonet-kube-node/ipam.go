@@ -0,0 +1,91 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/midonet/midonet-kubernetes/pkg/cni/ipam"
+)
+
+const (
+	// ipamReconcileMinAge is the minimum age of the allocations to
+	// reconcile.  The CNI might be still setting up younger ones.
+	ipamReconcileMinAge = time.Minute
+
+	ipamReconcileInterval = 10 * time.Minute
+)
+
+// reconcileIPAM releases the IP addresses allocated by the built-in
+// IPAM of midonet-kube-cni for the Pods which don't use them anymore.
+// Usually they are released by CNI DEL.  This is a safety net for
+// the cases it wasn't called, e.g. the Node was rebooted.
+func reconcileIPAM(client kubernetes.Interface, nodeName, dataDir string, logger *log.Entry) error {
+	allocs, err := ipam.List(dataDir)
+	if err != nil {
+		return err
+	}
+	// The addresses allocated for each container.  The Pod status
+	// only has the IPv4 address.  The IPv6 address is in use while
+	// the IPv4 address allocated for the same container is.
+	containerIPs := make(map[string][]string)
+	for _, a := range allocs {
+		containerIPs[a.ContainerID] = append(containerIPs[a.ContainerID], a.IP.String())
+	}
+	released, err := ipam.Reconcile(dataDir, ipamReconcileMinAge, func(a *ipam.Allocation) (bool, error) {
+		p, err := client.CoreV1().Pods(a.Namespace).Get(a.Pod, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		// The Pod might have been re-created with the same name
+		// on another Node.
+		if p.Spec.NodeName != nodeName {
+			return false, nil
+		}
+		// The Pod status doesn't have the address yet.
+		if p.Status.Phase == v1.PodPending {
+			return true, nil
+		}
+		// Otherwise, the allocation is stale unless the Pod uses
+		// it.  E.g. the Pod might have been re-created with
+		// the same name on this Node, or its sandbox might have
+		// been re-created with another address.
+		for _, ip := range containerIPs[a.ContainerID] {
+			if ip == p.Status.PodIP {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	for _, a := range released {
+		logger.WithFields(log.Fields{
+			"ip":          a.IP,
+			"containerID": a.ContainerID,
+			"namespace":   a.Namespace,
+			"pod":         a.Pod,
+		}).Info("Released a stale IP allocation")
+	}
+	return err
+}
@@ -15,7 +15,6 @@
 package main
 
 import (
-	"net"
 	"os"
 	"runtime"
 	"time"
@@ -23,11 +22,15 @@ import (
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/projectcalico/libcalico-go/lib/logutils"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
 
+	"github.com/midonet/midonet-kubernetes/pkg/cni/ipam"
 	k8scni "github.com/midonet/midonet-kubernetes/pkg/cni/k8s"
 	"github.com/midonet/midonet-kubernetes/pkg/cni/utils"
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
 	"github.com/midonet/midonet-kubernetes/pkg/converter/node"
+	"github.com/midonet/midonet-kubernetes/pkg/healthcheck"
 	"github.com/midonet/midonet-kubernetes/pkg/k8s"
 )
 
@@ -70,6 +73,15 @@ func main() {
 	logger := log.WithFields(log.Fields{
 		"nodeName": nodeName,
 	})
+
+	// "midonet-kube-node reconcile-ipam" just reconciles the built-in
+	// IPAM and exits.
+	if len(os.Args) > 1 && os.Args[1] == "reconcile-ipam" {
+		if err := reconcileIPAM(k8sClientset, nodeName, config.IPAMDataDir, logger); err != nil {
+			logger.WithError(err).Fatal("Failed to reconcile IPAM")
+		}
+		return
+	}
 retry:
 	podCIDR, err := k8scni.GetNodePodCIDR(k8sClientset, nodeName)
 	if err != nil {
@@ -91,22 +103,42 @@ retry:
 			Gateway: si.GatewayIP.IP,
 		},
 	}
-	_, clusterNetwork, err := net.ParseCIDR(config.ClusterCIDR)
+	if config.IPv6PodCIDR != "" {
+		ipv6SI, err := node.GetIPv6SubnetInfo(config.IPv6PodCIDR)
+		if err != nil {
+			logger.WithError(err).Fatal("GetIPv6SubnetInfo")
+		}
+		ips = append(ips, &current.IPConfig{
+			Version: "6",
+			Address: ipv6SI.NodeIP,
+			Gateway: ipv6SI.GatewayIP.IP,
+		})
+	}
+	clusterNetworks, err := parseCIDRs(config.ClusterCIDR)
 	if err != nil {
 		logger.WithError(err).Fatal("ClusterCIDR")
 	}
-	networks := []*net.IPNet{clusterNetwork}
-	if config.ServiceCIDR != "" {
-		_, serviceNetwork, err := net.ParseCIDR(config.ServiceCIDR)
+	if len(clusterNetworks) == 0 {
+		logger.Fatal("Empty ClusterCIDR")
+	}
+	serviceNetworks, err := parseCIDRs(config.ServiceCIDR)
+	if err != nil {
+		logger.WithError(err).Fatal("ServiceCIDR")
+	}
+	networks := append(clusterNetworks, serviceNetworks...)
+	mtu := config.MTU
+	if mtu == 0 {
+		mtu, err = detectMTU(k8sClientset, nodeName, config.TunnelZoneType)
 		if err != nil {
-			logger.WithError(err).Fatal("ServiceCIDR")
+			logger.WithError(err).Warnf("Failed to detect MTU, using %d", utils.DefaultMTU)
+			mtu = utils.DefaultMTU
 		}
-		networks = append(networks, serviceNetwork)
 	}
+	logger = logger.WithField("mtu", mtu)
 	contNetNS := utils.GetCurrentThreadNetNSPath()
 	contVethName := "midokube-node"
 	hostVethName := node.IFName()
-	contVethMAC, err := utils.DoNetworking(networks, ips, contNetNS, contVethName, hostVethName, true, logger)
+	contVethMAC, err := utils.DoNetworking(networks, ips, contNetNS, contVethName, hostVethName, nil, mtu, true, logger)
 	if err != nil {
 		logger.WithError(err).Fatal("DoNetworking")
 	}
@@ -120,18 +152,53 @@ retry:
 		logger.Info("Node annotation succeeded")
 	}
 
+	// Tell the Node converter the IPv6 PodCIDR, or that there's none.
+	if config.IPv6PodCIDR != "" {
+		err = k8s.AddNodeAnnotation(k8sClientset, nodeName, converter.IPv6PodCIDRAnnotation, config.IPv6PodCIDR)
+	} else {
+		err = k8s.DeleteNodeAnnotation(k8sClientset, nodeName, converter.IPv6PodCIDRAnnotation)
+	}
+	if err != nil {
+		logger.WithError(err).Warn("Node IPv6 PodCIDR annotation failed")
+	}
+
 	cniConfigPath := config.CNIConfigPath
 	if cniConfigPath != "" {
 		file, err := os.OpenFile(cniConfigPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
 		if err != nil {
 			logger.WithError(err).Fatal("OpenFile")
 		}
-		err = generateCNIConfig(file, podCIDR)
+		data := &cniConfigData{
+			PodCIDR:     podCIDR,
+			IPv6PodCIDR: config.IPv6PodCIDR,
+			MTU:         mtu,
+			IPAMType:    config.IPAMType,
+		}
+		if config.IPAMType == ipam.Type {
+			data.IPAMDataDir = config.IPAMDataDir
+		}
+		err = generateCNIConfig(file, data)
 		if err != nil {
 			logger.WithError(err).Fatal("generateCNIConfig")
 		}
 	}
 
+	// Serve health check node ports for Services with
+	// externalTrafficPolicy=Local.
+	stop := make(chan struct{})
+	defer close(stop)
+	informerFactory := informers.NewSharedInformerFactory(k8sClientset, 0)
+	healthcheck.NewServer(nodeName, informerFactory)
+	informerFactory.Start(stop)
+
+	if config.IPAMType == ipam.Type {
+		go wait.Until(func() {
+			if err := reconcileIPAM(k8sClientset, nodeName, config.IPAMDataDir, logger); err != nil {
+				logger.WithError(err).Warn("Failed to reconcile IPAM")
+			}
+		}, ipamReconcileInterval, stop)
+	}
+
 	// Note: serveRPC usually doesn't return.
 	// Otherwise, we will exit and be restarted by kubernetes.
 	// Note that DaemonSet manadates restartPolicy=Always.
@@ -0,0 +1,86 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+// detectMTU returns the MTU for the veths of the Node and its Pods.
+// That is, the MTU of the interface with the tunnel endpoint IP of
+// the Node, minus the overhead of the tunnel encapsulation.
+func detectMTU(client kubernetes.Interface, nodeName string, tunnelZoneType string) (int, error) {
+	overhead, err := midonet.TunnelOverhead(tunnelZoneType)
+	if err != nil {
+		return 0, err
+	}
+	n, err := client.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	ip := tunnelEndpointIP(n)
+	if ip == nil {
+		return 0, fmt.Errorf("Node %s has no tunnel endpoint IP", nodeName)
+	}
+	ifMTU, err := interfaceMTU(ip)
+	if err != nil {
+		return 0, err
+	}
+	return ifMTU - overhead, nil
+}
+
+// tunnelEndpointIP returns the tunnel endpoint IP of the Node.
+// The annotation might not be available yet.  In that case, use
+// the first InternalIP as the nodeannotator controller would do.
+func tunnelEndpointIP(n *v1.Node) net.IP {
+	if ip := net.ParseIP(n.ObjectMeta.Annotations[converter.TunnelEndpointIPAnnotation]); ip != nil {
+		return ip
+	}
+	for _, addr := range n.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return net.ParseIP(addr.Address)
+		}
+	}
+	return nil
+}
+
+// interfaceMTU returns the MTU of the interface with the given address.
+func interfaceMTU(ip net.IP) (int, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return 0, err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return 0, err
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				return iface.MTU, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no interface has %s", ip)
+}
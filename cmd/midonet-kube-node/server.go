@@ -45,7 +45,7 @@ func (s *server) AddPodAnnotation(ctx context.Context, in *api.AddPodAnnotationR
 	logger.Info("Got a request")
 	var errorMessage string
 	var reason string
-	if in.Key == converter.MACAnnotation {
+	if in.Key == converter.MACAnnotation || in.Key == converter.IPv6AddressAnnotation {
 		err := k8s.AddPodAnnotation(s.client, in.Namespace, in.Name, in.Key, in.Value)
 		if err != nil {
 			errorMessage = err.Error()
@@ -73,7 +73,7 @@ func (s *server) DeletePodAnnotation(ctx context.Context, in *api.DeletePodAnnot
 	logger.Info("Got a request")
 	var errorMessage string
 	var reason string
-	if in.Key == converter.MACAnnotation {
+	if in.Key == converter.MACAnnotation || in.Key == converter.IPv6AddressAnnotation {
 		err := k8s.DeletePodAnnotation(s.client, in.Namespace, in.Name, in.Key)
 		if err != nil {
 			errorMessage = err.Error()
@@ -92,6 +92,38 @@ func (s *server) DeletePodAnnotation(ctx context.Context, in *api.DeletePodAnnot
 	}, nil
 }
 
+func (s *server) GetPodAnnotation(ctx context.Context, in *api.GetPodAnnotationRequest) (*api.GetPodAnnotationReply, error) {
+	logger := log.WithFields(log.Fields{
+		"request": "GetPodAnnotation",
+		"args":    in,
+	})
+
+	logger.Info("Got a request")
+	var value string
+	var errorMessage string
+	var reason string
+	switch in.Key {
+	case converter.NetworksAnnotation, converter.StaticIPAnnotation, converter.StaticMACAnnotation:
+		v, err := k8s.GetPodAnnotation(s.client, in.Namespace, in.Name, in.Key)
+		if err != nil {
+			errorMessage = err.Error()
+			reason = string(errors.ReasonForError(err))
+			logger.WithError(err).WithField("reason", reason).Error("Failed")
+		} else {
+			value = v
+			logger.Info("Succeed")
+		}
+	default:
+		logger.Error("Rejected")
+		errorMessage = "Rejected"
+	}
+	return &api.GetPodAnnotationReply{
+		Value:              value,
+		Error:              errorMessage,
+		Metav1StatusReason: reason,
+	}, nil
+}
+
 func serveRPC(clientset *kubernetes.Clientset) {
 	log.Info("Starting RPC server")
 	logger := log.WithField("path", api.Path)
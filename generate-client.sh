@@ -5,4 +5,4 @@
 ./generate-groups.sh all \
 github.com/midonet/midonet-kubernetes/pkg/client \
 github.com/midonet/midonet-kubernetes/pkg/apis \
-midonet:v1
+"midonet:v1 discovery:v1"
@@ -0,0 +1,25 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+// +k8s:deepcopy-gen=package
+// +groupName=discovery.k8s.io
+
+// A minimal subset of discovery.k8s.io/v1 API definitions.
+//
+// REVISIT: The version of k8s.io/api we use doesn't have EndpointSlice.
+// Remove this package and the generated discovery client in our
+// clientset once we upgrade it.  As only the fields we use are defined,
+// the client is read-only.
+package v1
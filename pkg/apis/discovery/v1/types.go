@@ -0,0 +1,83 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package v1
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LabelServiceName is the label used to indicate the name of
+// the Service an EndpointSlice belongs to.
+const LabelServiceName = "kubernetes.io/service-name"
+
+// AddressType represents the type of addresses in an EndpointSlice.
+type AddressType string
+
+const (
+	// AddressTypeIPv4 represents IPv4 addresses.
+	AddressTypeIPv4 = AddressType("IPv4")
+	// AddressTypeIPv6 represents IPv6 addresses.
+	AddressTypeIPv6 = AddressType("IPv6")
+	// AddressTypeFQDN represents FQDN addresses.
+	AddressTypeFQDN = AddressType("FQDN")
+)
+
+// +genclient
+// +genclient:onlyVerbs=get,list,watch
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// EndpointSlice represents a subset of the endpoints of a Service.
+// Only the fields we use are defined.
+type EndpointSlice struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	AddressType AddressType    `json:"addressType"`
+	Endpoints   []Endpoint     `json:"endpoints"`
+	Ports       []EndpointPort `json:"ports"`
+}
+
+// Endpoint represents a single logical backend.
+type Endpoint struct {
+	Addresses  []string           `json:"addresses"`
+	Conditions EndpointConditions `json:"conditions,omitempty"`
+	NodeName   *string            `json:"nodeName,omitempty"`
+}
+
+// EndpointConditions represents the current condition of an endpoint.
+type EndpointConditions struct {
+	Ready       *bool `json:"ready,omitempty"`
+	Serving     *bool `json:"serving,omitempty"`
+	Terminating *bool `json:"terminating,omitempty"`
+}
+
+// EndpointPort represents a port used by an EndpointSlice.
+type EndpointPort struct {
+	Name     *string      `json:"name,omitempty"`
+	Protocol *v1.Protocol `json:"protocol,omitempty"`
+	Port     *int32       `json:"port,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// EndpointSliceList is a list of EndpointSlices.
+type EndpointSliceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []EndpointSlice `json:"items"`
+}
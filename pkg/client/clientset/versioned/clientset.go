@@ -20,6 +20,7 @@ package versioned
 
 import (
 	glog "github.com/golang/glog"
+	discoveryv1 "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned/typed/discovery/v1"
 	midonetv1 "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned/typed/midonet/v1"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
@@ -28,6 +29,7 @@ import (
 
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
+	DiscoveryV1() discoveryv1.DiscoveryV1Interface
 	MidonetV1() midonetv1.MidonetV1Interface
 	// Deprecated: please explicitly pick a version if possible.
 	Midonet() midonetv1.MidonetV1Interface
@@ -37,7 +39,13 @@ type Interface interface {
 // version included in a Clientset.
 type Clientset struct {
 	*discovery.DiscoveryClient
-	midonetV1 *midonetv1.MidonetV1Client
+	discoveryV1 *discoveryv1.DiscoveryV1Client
+	midonetV1   *midonetv1.MidonetV1Client
+}
+
+// DiscoveryV1 retrieves the DiscoveryV1Client
+func (c *Clientset) DiscoveryV1() discoveryv1.DiscoveryV1Interface {
+	return c.discoveryV1
 }
 
 // MidonetV1 retrieves the MidonetV1Client
@@ -67,6 +75,10 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 	}
 	var cs Clientset
 	var err error
+	cs.discoveryV1, err = discoveryv1.NewForConfig(&configShallowCopy)
+	if err != nil {
+		return nil, err
+	}
 	cs.midonetV1, err = midonetv1.NewForConfig(&configShallowCopy)
 	if err != nil {
 		return nil, err
@@ -84,6 +96,7 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 // panics if there is an error in the config.
 func NewForConfigOrDie(c *rest.Config) *Clientset {
 	var cs Clientset
+	cs.discoveryV1 = discoveryv1.NewForConfigOrDie(c)
 	cs.midonetV1 = midonetv1.NewForConfigOrDie(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClientForConfigOrDie(c)
@@ -93,6 +106,7 @@ func NewForConfigOrDie(c *rest.Config) *Clientset {
 // New creates a new Clientset for the given RESTClient.
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
+	cs.discoveryV1 = discoveryv1.New(c)
 	cs.midonetV1 = midonetv1.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
@@ -20,6 +20,8 @@ package fake
 
 import (
 	clientset "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned"
+	discoveryv1 "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned/typed/discovery/v1"
+	fakediscoveryv1 "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned/typed/discovery/v1/fake"
 	midonetv1 "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned/typed/midonet/v1"
 	fakemidonetv1 "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned/typed/midonet/v1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -70,6 +72,11 @@ func (c *Clientset) Discovery() discovery.DiscoveryInterface {
 
 var _ clientset.Interface = &Clientset{}
 
+// DiscoveryV1 retrieves the DiscoveryV1Client
+func (c *Clientset) DiscoveryV1() discoveryv1.DiscoveryV1Interface {
+	return &fakediscoveryv1.FakeDiscoveryV1{Fake: &c.Fake}
+}
+
 // MidonetV1 retrieves the MidonetV1Client
 func (c *Clientset) MidonetV1() midonetv1.MidonetV1Interface {
 	return &fakemidonetv1.FakeMidonetV1{Fake: &c.Fake}
@@ -19,6 +19,7 @@ limitations under the License.
 package fake
 
 import (
+	discoveryv1 "github.com/midonet/midonet-kubernetes/pkg/apis/discovery/v1"
 	midonetv1 "github.com/midonet/midonet-kubernetes/pkg/apis/midonet/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
@@ -50,5 +51,6 @@ func init() {
 // After this, RawExtensions in Kubernetes types will serialize kube-aggregator types
 // correctly.
 func AddToScheme(scheme *runtime.Scheme) {
+	discoveryv1.AddToScheme(scheme)
 	midonetv1.AddToScheme(scheme)
 }
@@ -24,6 +24,7 @@ import (
 	time "time"
 
 	versioned "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned"
+	discovery "github.com/midonet/midonet-kubernetes/pkg/client/informers/externalversions/discovery"
 	internalinterfaces "github.com/midonet/midonet-kubernetes/pkg/client/informers/externalversions/internalinterfaces"
 	midonet "github.com/midonet/midonet-kubernetes/pkg/client/informers/externalversions/midonet"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -123,9 +124,14 @@ type SharedInformerFactory interface {
 	ForResource(resource schema.GroupVersionResource) (GenericInformer, error)
 	WaitForCacheSync(stopCh <-chan struct{}) map[reflect.Type]bool
 
+	Discovery() discovery.Interface
 	Midonet() midonet.Interface
 }
 
+func (f *sharedInformerFactory) Discovery() discovery.Interface {
+	return discovery.New(f, f.namespace, f.tweakListOptions)
+}
+
 func (f *sharedInformerFactory) Midonet() midonet.Interface {
 	return midonet.New(f, f.namespace, f.tweakListOptions)
 }
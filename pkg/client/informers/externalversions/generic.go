@@ -21,7 +21,8 @@ package externalversions
 import (
 	"fmt"
 
-	v1 "github.com/midonet/midonet-kubernetes/pkg/apis/midonet/v1"
+	v1 "github.com/midonet/midonet-kubernetes/pkg/apis/discovery/v1"
+	midonet_v1 "github.com/midonet/midonet-kubernetes/pkg/apis/midonet/v1"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
 	cache "k8s.io/client-go/tools/cache"
 )
@@ -52,8 +53,12 @@ func (f *genericInformer) Lister() cache.GenericLister {
 // TODO extend this to unknown resources with a client pool
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
-	// Group=midonet.org, Version=v1
-	case v1.SchemeGroupVersion.WithResource("translations"):
+	// Group=discovery.k8s.io, Version=v1
+	case v1.SchemeGroupVersion.WithResource("endpointslices"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Discovery().V1().EndpointSlices().Informer()}, nil
+
+		// Group=midonet.org, Version=v1
+	case midonet_v1.SchemeGroupVersion.WithResource("translations"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Midonet().V1().Translations().Informer()}, nil
 
 	}
@@ -0,0 +1,338 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ip"
+)
+
+const (
+	// Type is the IPAM type in the network configuration to use
+	// the built-in IPAM instead of an IPAM plugin.
+	Type = "midonet"
+
+	// DefaultDataDir is the default directory to persist
+	// the allocations.
+	DefaultDataDir = "/var/lib/midonet-kube-cni/ipam"
+
+	lastFile = "last"
+)
+
+// Allocation is an IP address allocated for a container.
+type Allocation struct {
+	IP          net.IP    `json:"-"`
+	ContainerID string    `json:"containerID"`
+	Namespace   string    `json:"namespace"`
+	Pod         string    `json:"pod"`
+	Created     time.Time `json:"-"`
+
+	path string
+}
+
+// Allocator allocates IP addresses in a subnet.
+// Each allocation is persisted as a file named after the address in
+// the directory for the subnet.  As the file is linked into the directory
+// only when it doesn't exist yet, concurrent CNI invocations never
+// allocate the same address.
+type Allocator struct {
+	dir      string
+	subnet   *net.IPNet
+	reserved []net.IP
+}
+
+// NewAllocator returns an Allocator for the subnet.  The reserved
+// addresses, i.e. the gateway and the Node, are never allocated.
+func NewAllocator(dataDir string, subnet *net.IPNet, reserved ...net.IP) *Allocator {
+	return &Allocator{
+		dir:      filepath.Join(dataDir, strings.Replace(subnet.String(), "/", "_", -1)),
+		subnet:   subnet,
+		reserved: reserved,
+	}
+}
+
+// Allocate allocates an address for the container.  If requested is
+// not nil, only the address is tried.  If the container already has
+// an address in the subnet, e.g. for a retried ADD, it's returned.
+func (a *Allocator) Allocate(containerID, namespace, pod string, requested net.IP) (net.IP, error) {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return nil, err
+	}
+	allocs, err := list(a.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, alloc := range allocs {
+		if alloc.ContainerID == containerID {
+			return alloc.IP, nil
+		}
+	}
+	data, err := json.Marshal(&Allocation{
+		ContainerID: containerID,
+		Namespace:   namespace,
+		Pod:         pod,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if requested != nil {
+		if !a.usable(requested) {
+			return nil, fmt.Errorf("%s is not available in %s", requested, a.subnet)
+		}
+		ok, err := a.tryAllocate(requested, data)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s is already allocated", requested)
+		}
+		return requested, nil
+	}
+	// Start after the last allocated address so that a released
+	// address is not reused soon.
+	start := a.last()
+	candidate := start
+	for {
+		candidate = a.next(candidate)
+		if a.usable(candidate) {
+			ok, err := a.tryAllocate(candidate, data)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				a.setLast(candidate)
+				return candidate, nil
+			}
+		}
+		if candidate.Equal(start) {
+			return nil, fmt.Errorf("no address available in %s", a.subnet)
+		}
+	}
+}
+
+// usable returns true if the address can be allocated.
+func (a *Allocator) usable(addr net.IP) bool {
+	if !a.subnet.Contains(addr) || addr.Equal(a.subnet.IP) {
+		return false
+	}
+	if a.subnet.IP.To4() != nil && addr.Equal(broadcast(a.subnet)) {
+		return false
+	}
+	for _, r := range a.reserved {
+		if addr.Equal(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// next returns the address after addr, wrapping around in the subnet.
+func (a *Allocator) next(addr net.IP) net.IP {
+	n := ip.NextIP(addr)
+	if !a.subnet.Contains(n) {
+		return a.subnet.IP
+	}
+	return n
+}
+
+func (a *Allocator) last() net.IP {
+	data, err := ioutil.ReadFile(filepath.Join(a.dir, lastFile))
+	if err == nil {
+		addr := net.ParseIP(string(data))
+		if addr != nil && a.subnet.Contains(addr) {
+			if a.subnet.IP.To4() != nil {
+				return addr.To4()
+			}
+			return addr
+		}
+	}
+	return a.subnet.IP
+}
+
+func (a *Allocator) setLast(addr net.IP) {
+	// Best effort.  It's merely a hint where to start.
+	ioutil.WriteFile(filepath.Join(a.dir, lastFile), []byte(addr.String()), 0644)
+}
+
+// tryAllocate persists the allocation of the address.  It returns
+// false if the address is already allocated.
+func (a *Allocator) tryAllocate(addr net.IP, data []byte) (bool, error) {
+	tmp, err := ioutil.TempFile(a.dir, ".tmp-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return false, err
+	}
+	err = os.Link(tmp.Name(), filepath.Join(a.dir, addr.String()))
+	if os.IsExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func broadcast(subnet *net.IPNet) net.IP {
+	addr := make(net.IP, len(subnet.IP))
+	for i := range subnet.IP {
+		addr[i] = subnet.IP[i] | ^subnet.Mask[i]
+	}
+	return addr
+}
+
+// list returns the allocations in the directory for a subnet.
+func list(dir string) ([]*Allocation, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var allocs []*Allocation
+	for _, f := range files {
+		addr := net.ParseIP(f.Name())
+		if addr == nil {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			// Released concurrently
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		alloc := &Allocation{}
+		if err := json.Unmarshal(data, alloc); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		alloc.IP = addr
+		alloc.Created = f.ModTime()
+		alloc.path = path
+		allocs = append(allocs, alloc)
+	}
+	return allocs, nil
+}
+
+// release removes the allocation unless the address has been
+// released and allocated for another container in the meantime.
+func (a *Allocation) release() error {
+	data, err := ioutil.ReadFile(a.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	current := &Allocation{}
+	if err := json.Unmarshal(data, current); err != nil {
+		return fmt.Errorf("%s: %v", a.path, err)
+	}
+	if current.ContainerID != a.ContainerID {
+		return nil
+	}
+	err = os.Remove(a.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List returns the allocations in all subnets.
+func List(dataDir string) ([]*Allocation, error) {
+	dirs, err := ioutil.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var allocs []*Allocation
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		l, err := list(filepath.Join(dataDir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		allocs = append(allocs, l...)
+	}
+	return allocs, nil
+}
+
+// Release releases the addresses allocated for the container in all
+// subnets.  It isn't an error if there's none, as the CNI DEL can be
+// called multiple times for a container.
+func Release(dataDir, containerID string) error {
+	allocs, err := List(dataDir)
+	if err != nil {
+		return err
+	}
+	for _, a := range allocs {
+		if a.ContainerID != containerID {
+			continue
+		}
+		if err := a.release(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reconcile releases the allocations for which inUse returns false.
+// Allocations younger than minAge are kept without calling inUse,
+// as the CNI might be still setting up the Pod.
+// It returns the released allocations.
+func Reconcile(dataDir string, minAge time.Duration, inUse func(*Allocation) (bool, error)) ([]*Allocation, error) {
+	allocs, err := List(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	var released []*Allocation
+	now := time.Now()
+	for _, a := range allocs {
+		if now.Sub(a.Created) < minAge {
+			continue
+		}
+		used, err := inUse(a)
+		if err != nil {
+			return released, err
+		}
+		if used {
+			continue
+		}
+		if err := a.release(); err != nil {
+			return released, err
+		}
+		released = append(released, a)
+	}
+	return released, nil
+}
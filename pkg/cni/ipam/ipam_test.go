@@ -0,0 +1,154 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package ipam
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAllocator(t *testing.T, cidr string) (*Allocator, string) {
+	dir, err := ioutil.TempDir("", "ipam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, subnet, _ := net.ParseCIDR(cidr)
+	gateway := nthIP(subnet, 1)
+	node := nthIP(subnet, 2)
+	return NewAllocator(dir, subnet, gateway, node), dir
+}
+
+func nthIP(subnet *net.IPNet, n byte) net.IP {
+	addr := make(net.IP, len(subnet.IP))
+	copy(addr, subnet.IP)
+	addr[len(addr)-1] += n
+	return addr
+}
+
+func TestAllocate(t *testing.T) {
+	a, dir := newTestAllocator(t, "10.1.2.0/29")
+	defer os.RemoveAll(dir)
+
+	// .0 is the network, .1 the gateway, .2 the Node, and .7 the broadcast.
+	var allocated []string
+	for _, id := range []string{"c1", "c2", "c3", "c4"} {
+		addr, err := a.Allocate(id, "foo", id, nil)
+		assert.Nil(t, err)
+		allocated = append(allocated, addr.String())
+	}
+	assert.Equal(t, []string{"10.1.2.3", "10.1.2.4", "10.1.2.5", "10.1.2.6"}, allocated)
+
+	_, err := a.Allocate("c5", "foo", "c5", nil)
+	assert.Error(t, err)
+
+	// Retried ADD
+	addr, err := a.Allocate("c2", "foo", "c2", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.1.2.4", addr.String())
+
+	assert.Nil(t, Release(dir, "c2"))
+	assert.Nil(t, Release(dir, "c2"))
+	addr, err = a.Allocate("c5", "foo", "c5", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.1.2.4", addr.String())
+}
+
+func TestAllocateRoundRobin(t *testing.T) {
+	a, dir := newTestAllocator(t, "10.1.2.0/24")
+	defer os.RemoveAll(dir)
+
+	addr, err := a.Allocate("c1", "foo", "c1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.1.2.3", addr.String())
+	assert.Nil(t, Release(dir, "c1"))
+
+	// Don't reuse the released address immediately.
+	addr, err = a.Allocate("c2", "foo", "c2", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.1.2.4", addr.String())
+}
+
+func TestAllocateRequested(t *testing.T) {
+	a, dir := newTestAllocator(t, "10.1.2.0/24")
+	defer os.RemoveAll(dir)
+
+	addr, err := a.Allocate("c1", "foo", "c1", net.ParseIP("10.1.2.100"))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.1.2.100", addr.String())
+
+	_, err = a.Allocate("c2", "foo", "c2", net.ParseIP("10.1.2.100"))
+	assert.Error(t, err)
+	for _, s := range []string{"10.1.2.0", "10.1.2.1", "10.1.2.2", "10.1.2.255", "10.1.3.1"} {
+		_, err = a.Allocate("c2", "foo", "c2", net.ParseIP(s))
+		assert.Error(t, err, s)
+	}
+}
+
+func TestAllocateIPv6(t *testing.T) {
+	a, dir := newTestAllocator(t, "fd00:10:1:2::/64")
+	defer os.RemoveAll(dir)
+
+	addr, err := a.Allocate("c1", "foo", "c1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "fd00:10:1:2::3", addr.String())
+
+	// Both IPv4 and IPv6 addresses are released.
+	a4 := NewAllocator(dir, &net.IPNet{IP: net.ParseIP("10.1.2.0").To4(), Mask: net.CIDRMask(24, 32)})
+	_, err = a4.Allocate("c1", "foo", "c1", nil)
+	assert.Nil(t, err)
+	allocs, err := List(dir)
+	assert.Nil(t, err)
+	assert.Len(t, allocs, 2)
+	assert.Nil(t, Release(dir, "c1"))
+	allocs, err = List(dir)
+	assert.Nil(t, err)
+	assert.Len(t, allocs, 0)
+}
+
+func TestReconcile(t *testing.T) {
+	a, dir := newTestAllocator(t, "10.1.2.0/24")
+	defer os.RemoveAll(dir)
+
+	for _, pod := range []string{"alive", "dead"} {
+		_, err := a.Allocate("c-"+pod, "foo", pod, nil)
+		assert.Nil(t, err)
+	}
+	inUse := func(alloc *Allocation) (bool, error) {
+		assert.Equal(t, "foo", alloc.Namespace)
+		return alloc.Pod == "alive", nil
+	}
+
+	// Too young
+	released, err := Reconcile(dir, time.Hour, inUse)
+	assert.Nil(t, err)
+	assert.Len(t, released, 0)
+
+	released, err = Reconcile(dir, 0, inUse)
+	assert.Nil(t, err)
+	assert.Len(t, released, 1)
+	assert.Equal(t, "c-dead", released[0].ContainerID)
+	assert.Equal(t, "10.1.2.4", released[0].IP.String())
+
+	allocs, err := List(dir)
+	assert.Nil(t, err)
+	assert.Len(t, allocs, 1)
+	assert.Equal(t, "alive", allocs[0].Pod)
+}
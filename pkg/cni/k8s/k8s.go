@@ -24,6 +24,7 @@ import (
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/containernetworking/plugins/pkg/ipam"
+	midoipam "github.com/midonet/midonet-kubernetes/pkg/cni/ipam"
 	"github.com/midonet/midonet-kubernetes/pkg/cni/types"
 	"github.com/midonet/midonet-kubernetes/pkg/cni/utils"
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
@@ -53,6 +54,16 @@ func CmdAddK8s(args *skel.CmdArgs, conf types.NetConf, epIDs utils.WEPIdentifier
 
 	logger.Info("Extracted identifiers for CmdAddK8s")
 
+	annotations, err := getPodAnnotations(epIDs, logger)
+	if err != nil {
+		return nil, err
+	}
+	networks, err := pod.ParseNetworks(annotations)
+	if err != nil {
+		logger.WithError(err).Error("Invalid additional networks")
+		return nil, err
+	}
+
 	podCIDR := conf.Kubernetes.PodCIDR
 	if podCIDR == "" {
 		fmt.Fprint(os.Stderr, "MidoNet CNI fetching podCidr from Kubernetes\n")
@@ -79,47 +90,49 @@ func CmdAddK8s(args *skel.CmdArgs, conf types.NetConf, epIDs utils.WEPIdentifier
 	gatewayIP := subnetInfo.GatewayIP
 	nodeIP := subnetInfo.NodeIP
 
-	// Replace the actual value in the args.StdinData as that's what's passed to the IPAM plugin.
-	var stdinData map[string]interface{}
-	if err := json.Unmarshal(args.StdinData, &stdinData); err != nil {
-		return nil, err
-	}
-	stdinData["ipam"].(map[string]interface{})["subnet"] = podCIDR
-	stdinData["ipam"].(map[string]interface{})["gateway"] = gatewayIP.IP.String()
-	fmt.Fprintf(os.Stderr, "MidoNet CNI passing podCidr to host-local IPAM: %s\n", podCIDR)
-	args.StdinData, err = json.Marshal(stdinData)
-	if err != nil {
-		return nil, err
-	}
-	logger.WithField("stdin", string(args.StdinData)).Debug("Updated stdin data")
-
-retry_ipam:
-	logger.Debugf("Calling IPAM plugin %s", conf.IPAM.Type)
-	ipamResult, err := ipam.ExecAdd(conf.IPAM.Type, args.StdinData)
-	if err != nil {
-		return nil, err
+	var ipv6SubnetInfo *node.SubnetInfo
+	if conf.Kubernetes.IPv6PodCIDR != "" {
+		ipv6SubnetInfo, err = node.GetIPv6SubnetInfo(conf.Kubernetes.IPv6PodCIDR)
+		if err != nil {
+			return nil, err
+		}
 	}
-	logger.Debugf("IPAM plugin returned: %+v", ipamResult)
 
-	// Convert IPAM result into current Result.
-	// IPAM result has a bunch of fields that are optional for an IPAM plugin
-	// but required for a CNI plugin, so this is to populate those fields.
-	// See CNI Spec doc for more details.
-	result, err = current.NewResultFromResult(ipamResult)
-	if err != nil {
-		utils.ReleaseIPAllocation(logger, conf.IPAM.Type, args.StdinData)
-		return nil, err
+	var staticIP net.IP
+	if s, ok := annotations[converter.StaticIPAnnotation]; ok {
+		staticIP, err = pod.ParseStaticIP(s, &subnetInfo.Subnet, gatewayIP.IP, nodeIP.IP)
+		if err != nil {
+			logger.WithError(err).Error("Invalid static IP")
+			return nil, err
+		}
 	}
-
-	if len(result.IPs) == 0 {
-		utils.ReleaseIPAllocation(logger, conf.IPAM.Type, args.StdinData)
-		return nil, errors.New("IPAM plugin returned missing IP config")
+	var staticMAC net.HardwareAddr
+	if s, ok := annotations[converter.StaticMACAnnotation]; ok {
+		staticMAC, err = pod.ParseStaticMAC(s)
+		if err != nil {
+			logger.WithError(err).Error("Invalid static MAC")
+			return nil, err
+		}
 	}
 
-	for _, ip := range result.IPs {
-		if ip.Address.IP.Equal(nodeIP.IP) {
-			// Just leak it and retry
-			goto retry_ipam
+	var releaseIPAM func()
+	if conf.IPAM.Type == midoipam.Type {
+		result, err = allocateIPs(conf, epIDs, subnetInfo, ipv6SubnetInfo, staticIP, logger)
+		if err != nil {
+			return nil, err
+		}
+		releaseIPAM = func() {
+			if err := midoipam.Release(utils.IPAMDataDir(conf), epIDs.ContainerID); err != nil {
+				logger.WithError(err).Warning("Failed to clean up IP allocations for failed ADD")
+			}
+		}
+	} else {
+		result, err = execIPAMPlugin(args, conf, podCIDR, subnetInfo, ipv6SubnetInfo, staticIP, logger)
+		if err != nil {
+			return nil, err
+		}
+		releaseIPAM = func() {
+			utils.ReleaseIPAllocation(logger, conf.IPAM.Type, args.StdinData)
 		}
 	}
 
@@ -129,15 +142,16 @@ retry_ipam:
 		logger.Debug("Checking if we need to clean up IPAM.")
 		//		logger := logger.WithField("IPs", endpoint.Spec.IPNetworks)
 		logger.Info("Releasing IPAM allocation after failure")
-		utils.ReleaseIPAllocation(logger, conf.IPAM.Type, args.StdinData)
+		releaseIPAM()
 	}
 
 	// Whether the endpoint existed or not, the veth needs (re)creating.
 	_, defaultNetwork, _ := net.ParseCIDR("0.0.0.0/0")
-	destNetworks := []*net.IPNet{defaultNetwork}
+	_, ipv6DefaultNetwork, _ := net.ParseCIDR("::/0")
+	destNetworks := []*net.IPNet{defaultNetwork, ipv6DefaultNetwork}
 	podKey := fmt.Sprintf("%s/%s", epIDs.Namespace, epIDs.Pod)
 	hostVethName := pod.IFNameForKey(podKey)
-	contVethMac, err := utils.DoNetworking(destNetworks, result.IPs, args.Netns, args.IfName, hostVethName, false, logger)
+	contVethMac, err := utils.DoNetworking(destNetworks, result.IPs, args.Netns, args.IfName, hostVethName, staticMAC, conf.MTU, false, logger)
 	if err != nil {
 		logger.WithError(err).Error("Error setting up networking")
 		maybeReleaseIPAM()
@@ -151,6 +165,29 @@ retry_ipam:
 		return nil, err
 	}
 
+	// Set up veths for additional networks.  The pod controller
+	// creates the corresponding Bridge Ports.
+	// Note: We don't bother to remove them on DEL.  They are removed
+	// with the network namespace.
+	for _, n := range networks {
+		var ips []*current.IPConfig
+		if n.Address != "" {
+			// Validated by ParseNetworks
+			ip, ipnet, _ := net.ParseCIDR(n.Address)
+			ips = append(ips, &current.IPConfig{
+				Version: "4",
+				Address: net.IPNet{IP: ip, Mask: ipnet.Mask},
+			})
+		}
+		hostVethName := pod.NetworkIFNameForKey(podKey, n.Interface)
+		_, err := utils.DoNetworking(nil, ips, args.Netns, n.Interface, hostVethName, nil, conf.MTU, false, logger)
+		if err != nil {
+			logger.WithError(err).WithField("network", n).Error("Error setting up an additional network")
+			maybeReleaseIPAM()
+			return nil, err
+		}
+	}
+
 	// REVISIT(yamamoto): We've just set up a veth pair. The rest of
 	// the plumbing will be done by the controller and the backend
 	// asynchronously.  That is, the controller will create necessary
@@ -176,6 +213,147 @@ retry_ipam:
 		}).Error("Failed to annotate Pod with MAC")
 	}
 
+	// Unlike the MAC, the IPv6 address is known to the controllers
+	// only via the annotation.  Fail if we can't tell it.
+	for _, ip := range result.IPs {
+		if ip.Version != "6" {
+			continue
+		}
+		err, reason := nodecli.AddPodAnnotation(epIDs.Namespace, epIDs.Pod, converter.IPv6AddressAnnotation, ip.Address.IP.String())
+		if err != nil {
+			logger.WithError(err).WithFields(logrus.Fields{
+				"reason": reason,
+				"ip":     ip.Address.IP,
+			}).Error("Failed to annotate Pod with IPv6 address")
+			maybeReleaseIPAM()
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// execIPAMPlugin allocates the IP addresses for the Pod with the IPAM
+// plugin, which is expected to be host-local.
+func execIPAMPlugin(args *skel.CmdArgs, conf types.NetConf, podCIDR string, subnetInfo, ipv6SubnetInfo *node.SubnetInfo, staticIP net.IP, logger *logrus.Entry) (*current.Result, error) {
+	var result *current.Result
+	var err error
+	gatewayIP := subnetInfo.GatewayIP
+	nodeIP := subnetInfo.NodeIP
+
+	// Replace the actual value in the args.StdinData as that's what's passed to the IPAM plugin.
+	var stdinData map[string]interface{}
+	if err := json.Unmarshal(args.StdinData, &stdinData); err != nil {
+		return nil, err
+	}
+	stdinData["ipam"].(map[string]interface{})["subnet"] = podCIDR
+	stdinData["ipam"].(map[string]interface{})["gateway"] = gatewayIP.IP.String()
+	if staticIP != nil {
+		// Request the IP to IPAM in the way described in
+		// https://github.com/containernetworking/cni/blob/master/CONVENTIONS.md
+		stdinData["args"] = map[string]interface{}{
+			"cni": map[string]interface{}{
+				"ips": []string{staticIP.String()},
+			},
+		}
+		fmt.Fprintf(os.Stderr, "MidoNet CNI requesting static IP to IPAM: %s\n", staticIP)
+	}
+	fmt.Fprintf(os.Stderr, "MidoNet CNI passing podCidr to host-local IPAM: %s\n", podCIDR)
+	if ipv6SubnetInfo != nil {
+		// host-local IPAM allocates an address from each range set
+		// in addition to the "subnet" above.
+		stdinData["ipam"].(map[string]interface{})["ranges"] = [][]map[string]interface{}{
+			{
+				{
+					"subnet":  ipv6SubnetInfo.Subnet.String(),
+					"gateway": ipv6SubnetInfo.GatewayIP.IP.String(),
+				},
+			},
+		}
+		fmt.Fprintf(os.Stderr, "MidoNet CNI passing IPv6 podCidr to host-local IPAM: %s\n", conf.Kubernetes.IPv6PodCIDR)
+	}
+	args.StdinData, err = json.Marshal(stdinData)
+	if err != nil {
+		return nil, err
+	}
+	logger.WithField("stdin", string(args.StdinData)).Debug("Updated stdin data")
+
+retry_ipam:
+	logger.Debugf("Calling IPAM plugin %s", conf.IPAM.Type)
+	ipamResult, err := ipam.ExecAdd(conf.IPAM.Type, args.StdinData)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("IPAM plugin returned: %+v", ipamResult)
+
+	// Convert IPAM result into current Result.
+	// IPAM result has a bunch of fields that are optional for an IPAM plugin
+	// but required for a CNI plugin, so this is to populate those fields.
+	// See CNI Spec doc for more details.
+	result, err = current.NewResultFromResult(ipamResult)
+	if err != nil {
+		utils.ReleaseIPAllocation(logger, conf.IPAM.Type, args.StdinData)
+		return nil, err
+	}
+
+	if len(result.IPs) == 0 {
+		utils.ReleaseIPAllocation(logger, conf.IPAM.Type, args.StdinData)
+		return nil, errors.New("IPAM plugin returned missing IP config")
+	}
+
+	for _, ip := range result.IPs {
+		if ip.Address.IP.Equal(nodeIP.IP) {
+			// Just leak it and retry.
+			// The built-in IPAM doesn't have this problem.
+			goto retry_ipam
+		}
+		if ipv6SubnetInfo != nil && ip.Address.IP.Equal(ipv6SubnetInfo.NodeIP.IP) {
+			// Ditto
+			goto retry_ipam
+		}
+	}
+
+	if staticIP != nil && !result.IPs[0].Address.IP.Equal(staticIP) {
+		// The IPAM plugin ignored the request.
+		utils.ReleaseIPAllocation(logger, conf.IPAM.Type, args.StdinData)
+		return nil, fmt.Errorf("IPAM plugin returned %s instead of the static IP %s", result.IPs[0].Address.IP, staticIP)
+	}
+
+	return result, nil
+}
+
+// allocateIPs allocates the IP addresses for the Pod with the built-in
+// IPAM.  Unlike host-local, it never allocates the addresses reserved
+// for the gateway and the Node.
+func allocateIPs(conf types.NetConf, epIDs utils.WEPIdentifiers, subnetInfo, ipv6SubnetInfo *node.SubnetInfo, staticIP net.IP, logger *logrus.Entry) (*current.Result, error) {
+	dataDir := utils.IPAMDataDir(conf)
+	infos := []*node.SubnetInfo{subnetInfo}
+	if ipv6SubnetInfo != nil {
+		infos = append(infos, ipv6SubnetInfo)
+	}
+	result := &current.Result{CNIVersion: current.ImplementedSpecVersion}
+	for _, si := range infos {
+		version := "6"
+		var requested net.IP
+		if si.Subnet.IP.To4() != nil {
+			version = "4"
+			requested = staticIP
+		}
+		allocator := midoipam.NewAllocator(dataDir, &si.Subnet, si.GatewayIP.IP, si.NodeIP.IP)
+		addr, err := allocator.Allocate(epIDs.ContainerID, epIDs.Namespace, epIDs.Pod, requested)
+		if err != nil {
+			if err := midoipam.Release(dataDir, epIDs.ContainerID); err != nil {
+				logger.WithError(err).Warning("Failed to clean up IP allocations for failed ADD")
+			}
+			return nil, err
+		}
+		logger.WithField("ip", addr).Info("Allocated IP address")
+		result.IPs = append(result.IPs, &current.IPConfig{
+			Version: version,
+			Address: net.IPNet{IP: addr, Mask: si.Subnet.Mask},
+			Gateway: si.GatewayIP.IP,
+		})
+	}
 	return result, nil
 }
 
@@ -190,6 +368,13 @@ func CmdDelK8s(epIDs utils.WEPIdentifiers, args *skel.CmdArgs, conf types.NetCon
 		}).Error("Failed to delete MAC annotation")
 		return err
 	}
+	err, reason = nodecli.DeletePodAnnotation(epIDs.Namespace, epIDs.Pod, converter.IPv6AddressAnnotation)
+	if err != nil && reason != string(metav1.StatusReasonNotFound) {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"reason": reason,
+		}).Error("Failed to delete IPv6 address annotation")
+		return err
+	}
 
 	// Release the IP address by calling the configured IPAM plugin.
 	ipamErr := utils.CleanUpIPAM(conf, args, logger)
@@ -211,6 +396,30 @@ func CmdDelK8s(epIDs utils.WEPIdentifiers, args *skel.CmdArgs, conf types.NetCon
 	return nil
 }
 
+// getPodAnnotations queries the annotations of the Pod which the CNI
+// uses via local midonet-kube-node instance.
+func getPodAnnotations(epIDs utils.WEPIdentifiers, logger *logrus.Entry) (map[string]string, error) {
+	annotations := make(map[string]string)
+	for _, key := range []string{
+		converter.NetworksAnnotation,
+		converter.StaticIPAnnotation,
+		converter.StaticMACAnnotation,
+	} {
+		value, err, reason := nodecli.GetPodAnnotation(epIDs.Namespace, epIDs.Pod, key)
+		if err != nil {
+			logger.WithError(err).WithFields(logrus.Fields{
+				"key":    key,
+				"reason": reason,
+			}).Error("Failed to query Pod annotation")
+			return nil, err
+		}
+		if value != "" {
+			annotations[key] = value
+		}
+	}
+	return annotations, nil
+}
+
 func newK8sClient(conf types.NetConf, logger *logrus.Entry) (*kubernetes.Clientset, error) {
 	// Some config can be passed in a kubeconfig file
 	kubeconfig := conf.Kubernetes.Kubeconfig
@@ -26,6 +26,10 @@ type Kubernetes struct {
 	Kubeconfig string `json:"kubeconfig"`
 	NodeName   string `json:"node_name"`
 	PodCIDR    string `json:"podcidr"`
+
+	// IPv6PodCIDR is an optional IPv6 subnet to allocate the pod
+	// addresses from, in addition to PodCIDR.
+	IPv6PodCIDR string `json:"ipv6podcidr"`
 }
 
 type NetworkInfo struct {
@@ -51,6 +55,10 @@ type NetConf struct {
 		AssignIpv6 *string  `json:"assign_ipv6"`
 		IPv4Pools  []string `json:"ipv4_pools,omitempty"`
 		IPv6Pools  []string `json:"ipv6_pools,omitempty"`
+
+		// DataDir is the directory where the built-in IPAM
+		// persists the allocations.
+		DataDir string `json:"dataDir,omitempty"`
 	} `json:"ipam,omitempty"`
 	MTU        int        `json:"mtu"`
 	LogLevel   string     `json:"log_level"`
@@ -21,6 +21,7 @@ import (
 	"io"
 	"net"
 	"os"
+	"syscall"
 
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/containernetworking/plugins/pkg/ip"
@@ -29,10 +30,15 @@ import (
 	"github.com/vishvananda/netlink"
 )
 
-// DoNetworking performs the networking for the given config and IPAM result
-func DoNetworking(destNetworks []*net.IPNet, ips []*current.IPConfig, contNetNS, contVethName, hostVethName string, ipForward bool, logger *logrus.Entry) (contVethMAC string, err error) {
+// DoNetworking performs the networking for the given config and IPAM result.
+// If contVethHWAddr is nil, the kernel generates the MAC address of the
+// container side veth.
+// If mtu is 0, DefaultMTU is used for the veth pair.
+func DoNetworking(destNetworks []*net.IPNet, ips []*current.IPConfig, contNetNS, contVethName, hostVethName string, contVethHWAddr net.HardwareAddr, mtu int, ipForward bool, logger *logrus.Entry) (contVethMAC string, err error) {
 	var hasIPv4, hasIPv6 bool
-	MTU := 1500 // XXX
+	if mtu == 0 {
+		mtu = DefaultMTU
+	}
 
 	logger.Infof("Setting the host side veth name to %s", hostVethName)
 
@@ -47,9 +53,10 @@ func DoNetworking(destNetworks []*net.IPNet, ips []*current.IPConfig, contNetNS,
 	err = ns.WithNetNSPath(contNetNS, func(hostNS ns.NetNS) error {
 		veth := &netlink.Veth{
 			LinkAttrs: netlink.LinkAttrs{
-				Name:  contVethName,
-				Flags: net.FlagUp,
-				MTU:   MTU,
+				Name:         contVethName,
+				Flags:        net.FlagUp,
+				MTU:          mtu,
+				HardwareAddr: contVethHWAddr,
 			},
 			PeerName: hostVethName,
 		}
@@ -103,6 +110,9 @@ func DoNetworking(destNetworks []*net.IPNet, ips []*current.IPConfig, contNetNS,
 				}
 
 				for _, dest := range destNetworks {
+					if dest.IP.To4() == nil {
+						continue
+					}
 					gw := addr.Gateway
 					if err = ip.AddRoute(dest, gw, contVeth); err != nil {
 						return fmt.Errorf("failed to add the default route inside the container: %v", err)
@@ -115,6 +125,34 @@ func DoNetworking(destNetworks []*net.IPNet, ips []*current.IPConfig, contNetNS,
 			}
 		}
 
+		for _, addr := range ips {
+			if addr.Version == "6" {
+				// IPv6 might be disabled on the new interface by default.
+				if err = writeProcSys(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/disable_ipv6", contVethName), "0"); err != nil {
+					return fmt.Errorf("failed to enable IPv6 on %q: %v", contVethName, err)
+				}
+
+				// Skip the duplicate address detection.  Otherwise the address
+				// stays tentative for a while and the routes below can't use it.
+				// The address is allocated by IPAM and can't be a duplicate.
+				if err = netlink.AddrAdd(contVeth, &netlink.Addr{IPNet: &addr.Address, Flags: syscall.IFA_F_NODAD}); err != nil {
+					return fmt.Errorf("failed to add IPv6 addr to %q: %v", contVethName, err)
+				}
+
+				for _, dest := range destNetworks {
+					if dest.IP.To4() != nil {
+						continue
+					}
+					gw := addr.Gateway
+					if err = ip.AddRoute(dest, gw, contVeth); err != nil {
+						return fmt.Errorf("failed to add the IPv6 default route inside the container: %v", err)
+					}
+				}
+
+				hasIPv6 = true
+			}
+		}
+
 		if err = ConfigureIPForwarding(hasIPv4, hasIPv6, ipForward); err != nil {
 			return fmt.Errorf("error configuring sysctls for the container netns, error: %s", err)
 		}
@@ -23,8 +23,11 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// DoNetworking performs the networking for the given config and IPAM result
-func DoNetworking(destNetworks []*net.IPNet, ips []*current.IPConfig, contNetNS, contVethName, hostVethName string, ipForward bool, logger *logrus.Entry) (contVethMAC string, err error) {
+// DoNetworking performs the networking for the given config and IPAM result.
+// If contVethHWAddr is nil, the kernel generates the MAC address of the
+// container side veth.
+// If mtu is 0, DefaultMTU is used for the veth pair.
+func DoNetworking(destNetworks []*net.IPNet, ips []*current.IPConfig, contNetNS, contVethName, hostVethName string, contVethHWAddr net.HardwareAddr, mtu int, ipForward bool, logger *logrus.Entry) (contVethMAC string, err error) {
 	logrus.Fatal("Stub implementation used")
 	return "", nil
 }
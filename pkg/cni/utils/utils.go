@@ -23,10 +23,14 @@ import (
 	"github.com/containernetworking/cni/pkg/skel"
 	cnitypes "github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/plugins/pkg/ipam"
+	midoipam "github.com/midonet/midonet-kubernetes/pkg/cni/ipam"
 	"github.com/midonet/midonet-kubernetes/pkg/cni/types"
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultMTU is the MTU of veths used when it isn't configured.
+const DefaultMTU = 1500
+
 func Min(a, b int) int {
 	if a < b {
 		return a
@@ -34,10 +38,25 @@ func Min(a, b int) int {
 	return b
 }
 
-// CleanUpIPAM calls IPAM plugin to release the IP address.
+// IPAMDataDir returns the directory for the built-in IPAM.
+func IPAMDataDir(conf types.NetConf) string {
+	if conf.IPAM.DataDir != "" {
+		return conf.IPAM.DataDir
+	}
+	return midoipam.DefaultDataDir
+}
+
+// CleanUpIPAM calls IPAM plugin, or the built-in IPAM, to release the IP address.
 // It also contains IPAM plugin specific changes needed before calling the plugin.
 func CleanUpIPAM(conf types.NetConf, args *skel.CmdArgs, logger *logrus.Entry) error {
 	fmt.Fprint(os.Stderr, "MidoNet CNI releasing IP address\n")
+	if conf.IPAM.Type == midoipam.Type {
+		err := midoipam.Release(IPAMDataDir(conf), args.ContainerID)
+		if err != nil {
+			logger.Error(err)
+		}
+		return err
+	}
 	logger.WithFields(logrus.Fields{"paths": os.Getenv("CNI_PATH"),
 		"type": conf.IPAM.Type}).Debug("Looking for IPAM plugin in paths")
 
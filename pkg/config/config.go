@@ -15,6 +15,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -37,6 +39,27 @@ type Config struct {
 
 	// MidoNet tenantId to group resources maintained by our controllers
 	Tenant string `default:"midonetkube"`
+
+	// The pool of IPv4 addresses for LoadBalancer Services, in CIDR.
+	// Used by the loadbalancer controller.
+	LoadBalancerCIDR string `envconfig:"loadbalancer_cidr" default:""`
+
+	// How long to keep the chain and NAT rules for a removed endpoint
+	// so that existing connections can drain.  Zero disables draining.
+	// Used by the endpoints and endpointslice controllers.
+	EndpointDrainingPeriod time.Duration `split_words:"true" default:"0s"`
+
+	// SNAT the traffic from Pods to the outside of the cluster to
+	// an address of the Node.  "internal" for InternalIP, "external" for
+	// ExternalIP (or InternalIP if the Node doesn't have one).
+	// Empty disables it.  Used by the node controller.
+	EgressSNAT string `envconfig:"egress_snat" default:""`
+
+	// The Pod and Service CIDRs of the cluster, as comma separated
+	// lists of IPv4 and/or IPv6 CIDRs.  The traffic to them is not
+	// subject to the egress SNAT.
+	ClusterCIDR []string `default:"" split_words:"false"`
+	ServiceCIDR []string `default:"" split_words:"false"`
 }
 
 // Parse parses envconfig and stores in Config struct
@@ -16,6 +16,9 @@
 package controller
 
 import (
+	"fmt"
+	"time"
+
 	log "github.com/sirupsen/logrus"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -29,6 +32,17 @@ type Handler interface {
 	Delete(string) error
 }
 
+// RequeueAfterError can be returned by a Handler to ask the controller
+// to process the key again after the given duration.  Unlike other
+// errors, it isn't considered as a failure.
+type RequeueAfterError struct {
+	After time.Duration
+}
+
+func (e *RequeueAfterError) Error() string {
+	return fmt.Sprintf("requeue after %v", e.After)
+}
+
 // Controller describes a controller to watch the given GVK events.
 type Controller struct {
 	informer cache.SharedIndexInformer
@@ -72,6 +86,12 @@ func (c *Controller) processNextItem() bool {
 		queue.Forget(key)
 		return true
 	}
+	if r, ok := err.(*RequeueAfterError); ok {
+		clog.WithField("after", r.After).Debug("Done. Requeueing.")
+		queue.Forget(key)
+		queue.AddAfter(key, r.After)
+		return true
+	}
 	clog.WithError(err).Error("Failed. Retrying.")
 	queue.AddRateLimited(key)
 	return true
@@ -29,4 +29,46 @@ const (
 
 	// MACAnnotation annotates MAC address for the Pod/Node.
 	MACAnnotation = "midonet.org/mac-address"
+
+	// IPv6PodCIDRAnnotation annotates the IPv6 subnet for the Pods on
+	// the Node.  As the Kubernetes API we use has only a single PodCIDR
+	// for a Node, midonet-kube-node annotates it with its configuration.
+	IPv6PodCIDRAnnotation = "midonet.org/ipv6-pod-cidr"
+
+	// IPv6AddressAnnotation annotates the IPv6 address for the Pod.
+	// As the Kubernetes API we use has only a single PodIP for a Pod,
+	// midonet-kube-cni annotates it when it allocates the address.
+	IPv6AddressAnnotation = "midonet.org/ipv6-address"
+
+	// StaticIPAnnotation requests the IPv4 address for the Pod.
+	// It should be in the PodCIDR of the Node.
+	StaticIPAnnotation = "midonet.org/static-ip"
+
+	// StaticMACAnnotation requests the MAC address for the Pod.
+	// Unlike MACAnnotation, it's specified by users.
+	StaticMACAnnotation = "midonet.org/static-mac"
+
+	// AllowSpoofingAnnotation, when set to "true", disables
+	// the anti-spoofing rules on the port for the Pod.
+	// E.g. for a Pod acting as a router.
+	AllowSpoofingAnnotation = "midonet.org/allow-spoofing"
+
+	// NetworksAnnotation annotates additional networks for the Pod.
+	// It's a JSON array of objects with "bridge" (MidoNet Bridge ID),
+	// and optional "interface" and "address" keys.
+	// See pod.Network.
+	NetworksAnnotation = "midonet.org/networks"
+
+	// EgressIPAnnotation annotates the IPv4 address to which the traffic
+	// from the Pods in the Namespace to the outside of the cluster is
+	// SNATed.
+	EgressIPAnnotation = "midonet.org/egress-ip"
+
+	// EgressNodeAnnotation annotates the name of the Node preferred to
+	// host the egress IP of the Namespace.
+	EgressNodeAnnotation = "midonet.org/egress-node"
+
+	// DrainingSinceAnnotation annotates when the Translation started
+	// draining, in RFC3339 format.
+	DrainingSinceAnnotation = "midonet.org/draining-since"
 )
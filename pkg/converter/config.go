@@ -16,17 +16,47 @@
 package converter
 
 import (
+	"net"
+	"time"
+
 	"github.com/midonet/midonet-kubernetes/pkg/config"
 )
 
 // Config contains configuration for converter and its sub packages.
 type Config struct {
-	Tenant string
+	Tenant                 string
+	LoadBalancerCIDR       string
+	EndpointDrainingPeriod time.Duration
+	EgressSNAT             string
+	ClusterCIDR            []string
+	ServiceCIDR            []string
 }
 
 // NewConfigFromEnvConfig creates Config from envconfig instance.
 func NewConfigFromEnvConfig(config *config.Config) *Config {
 	return &Config{
-		Tenant: config.Tenant,
+		Tenant:                 config.Tenant,
+		LoadBalancerCIDR:       config.LoadBalancerCIDR,
+		EndpointDrainingPeriod: config.EndpointDrainingPeriod,
+		EgressSNAT:             config.EgressSNAT,
+		ClusterCIDR:            config.ClusterCIDR,
+		ServiceCIDR:            config.ServiceCIDR,
+	}
+}
+
+// ParseCIDRs parses a list of CIDRs, ignoring empty ones.
+// Note: envconfig makes an empty list [""].
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
 	}
+	return networks, nil
 }
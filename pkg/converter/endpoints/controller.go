@@ -16,11 +16,14 @@
 package endpoints
 
 import (
+	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 
+	discoveryv1 "github.com/midonet/midonet-kubernetes/pkg/apis/discovery/v1"
 	mncli "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned"
 	mninformers "github.com/midonet/midonet-kubernetes/pkg/client/informers/externalversions"
 	"github.com/midonet/midonet-kubernetes/pkg/controller"
@@ -30,9 +33,10 @@ import (
 
 // NewController creates an endpoint controller.
 func NewController(si informers.SharedInformerFactory, msi mninformers.SharedInformerFactory, kc *kubernetes.Clientset, mc *mncli.Clientset, recorder record.EventRecorder, config *converter.Config, _ *midonet.Config) *controller.Controller {
+	validateConfig(config)
 	informer := si.Core().V1().Endpoints().Informer()
 	svcInformer := si.Core().V1().Services().Informer()
-	updater := converter.NewTranslationUpdater(mc, recorder)
+	updater := newUpdater(mc, recorder, config)
 	handler := converter.NewHandler(newEndpointsConverter(svcInformer), updater, config)
 	gvk := v1.SchemeGroupVersion.WithKind("Endpoints")
 	c := controller.NewController(gvk, informer, handler)
@@ -40,3 +44,43 @@ func NewController(si informers.SharedInformerFactory, msi mninformers.SharedInf
 	svcInformer.AddEventHandler(controller.NewEventHandler("svc-eps", c.GetQueue()))
 	return c
 }
+
+// NewEndpointSliceController creates an endpoint controller which
+// consumes EndpointSlices instead of Endpoints.
+// It produces the same MidoNet resources as the one created by
+// NewController.  Only one of them should be enabled.
+func NewEndpointSliceController(si informers.SharedInformerFactory, msi mninformers.SharedInformerFactory, kc *kubernetes.Clientset, mc *mncli.Clientset, recorder record.EventRecorder, config *converter.Config, _ *midonet.Config) *controller.Controller {
+	validateConfig(config)
+	informer := msi.Discovery().V1().EndpointSlices().Informer()
+	if err := informer.AddIndexers(cache.Indexers{serviceIndex: indexByService}); err != nil {
+		log.WithError(err).Fatal("Failed to add the EndpointSlice indexer")
+	}
+	svcInformer := si.Core().V1().Services().Informer()
+	splits := newSplitCache(svcInformer.GetIndexer(), informer.GetIndexer())
+	updater := newUpdater(mc, recorder, config)
+	handler := converter.NewHandler(newEndpointSliceConverter(splits), updater, config)
+	gvk := discoveryv1.SchemeGroupVersion.WithKind("EndpointSlice")
+	c := controller.NewController(gvk, informer, handler)
+	// Kick the EndpointSlices of a Service whose translations are
+	// changed by an update of the Service or its other EndpointSlices.
+	siblings := newSiblingsEventHandler(splits, config, c.GetQueue())
+	svcInformer.AddEventHandler(siblings)
+	informer.AddEventHandler(siblings)
+	return c
+}
+
+func validateConfig(config *converter.Config) {
+	// The cluster networks are used to split the traffic for Services
+	// with ClientIP session affinity.
+	if _, err := converter.ParseCIDRs(config.ClusterCIDR); err != nil {
+		log.WithError(err).Fatal("Invalid ClusterCIDR")
+	}
+}
+
+func newUpdater(mc *mncli.Clientset, recorder record.EventRecorder, config *converter.Config) converter.Updater {
+	// Keep the endpoint chains, including the Node local ones, for
+	// a while after the endpoints are removed.  Their jump rules are
+	// removed immediately so that new connections don't reach
+	// the endpoints.
+	return converter.NewDrainingTranslationUpdater(mc, recorder, config.EndpointDrainingPeriod, "Endpoints-Port", "Endpoints-Local")
+}
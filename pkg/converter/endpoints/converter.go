@@ -17,11 +17,14 @@ package endpoints
 
 import (
 	"fmt"
+	"net"
+	"sort"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/cache"
 
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/service"
 )
 
 type endpointsConverter struct {
@@ -32,11 +35,33 @@ func newEndpointsConverter(svcInformer cache.SharedIndexInformer) converter.Conv
 	return &endpointsConverter{svcInformer.GetIndexer()}
 }
 
-func endpoints(key string, svcIP string, subsets []v1.EndpointSubset) map[string][]endpoint {
+func endpoints(key string, svcIP string, subsets []v1.EndpointSubset, publishNotReady bool) map[string][]endpoint {
 	m := make(map[string][]endpoint, 0)
+	clusterIP := net.ParseIP(svcIP)
 	for _, s := range subsets {
-		for _, a := range s.Addresses {
+		addrs := s.Addresses
+		if publishNotReady {
+			// Note: The readiness is not a part of the endpoint.
+			// Thus an endpoint flipping between ready and not-ready
+			// doesn't change its translation.
+			addrs = append(addrs[:len(addrs):len(addrs)], s.NotReadyAddresses...)
+		}
+		for _, a := range addrs {
+			ip := net.ParseIP(a.IP)
+			if ip == nil || !converter.SameFamily(ip, clusterIP) {
+				// We can't NAT between the families.
+				continue
+			}
+			nodeName := ""
+			if a.NodeName != nil {
+				nodeName = *a.NodeName
+			}
 			for _, p := range s.Ports {
+				if _, err := converter.ProtocolNumber(p.Protocol); err != nil {
+					// The service converter doesn't create
+					// the chain for the port either.
+					continue
+				}
 				ep := endpoint{
 					endpointsKey: key,
 					portName:     p.Name,
@@ -44,6 +69,7 @@ func endpoints(key string, svcIP string, subsets []v1.EndpointSubset) map[string
 					ip:           a.IP,
 					port:         int(p.Port),
 					protocol:     p.Protocol,
+					nodeName:     nodeName,
 				}
 				l := m[p.Name]
 				l = append(l, ep)
@@ -56,7 +82,6 @@ func endpoints(key string, svcIP string, subsets []v1.EndpointSubset) map[string
 
 func (c *endpointsConverter) Convert(key converter.Key, obj interface{}, config *converter.Config) ([]converter.BackendResource, converter.SubResourceMap, error) {
 	resources := make([]converter.BackendResource, 0)
-	subs := make(converter.SubResourceMap)
 	svcObj, exists, err := c.svcGetter.GetByKey(key.Key())
 	if err != nil {
 		return nil, nil, err
@@ -68,23 +93,138 @@ func (c *endpointsConverter) Convert(key converter.Key, obj interface{}, config
 	}
 	svcSpec := svcObj.(*v1.Service).Spec
 	svcIP := svcSpec.ClusterIP
-	if svcSpec.Type != v1.ServiceTypeClusterIP || svcIP == "" || svcIP == v1.ClusterIPNone {
-		// Ignore Endpoints without ClusterIP.
+	if !service.Translatable(&svcSpec) {
+		// Ignore Endpoints without a ClusterIP.
 		return nil, nil, nil
 	}
-	endpoint := obj.(*v1.Endpoints)
-	for _, eps := range endpoints(key.Key(), svcIP, endpoint.Subsets) {
-		for _, ep := range eps {
-			// We include almost everything in the key so that a modified
-			// endpoint is treated as another resource for the
-			// MidoNet side.  Note that MidoNet Chains and Rules are not
-			// updateable.
-			epKey := converter.Key{
-				Kind: "Endpoints-Port",
-				Name: fmt.Sprintf("%s/%s/%s/%s/%d/%s", key.Name, ep.portName, svcIP, ep.ip, ep.port, ep.protocol),
+	eps := obj.(*v1.Endpoints)
+	subs := convertEndpoints(key.Name, &svcSpec, endpoints(key.Key(), svcIP, eps.Subsets, svcSpec.PublishNotReadyAddresses), config)
+	return resources, subs[""], nil
+}
+
+// endpointKey returns the key of the sub resource for the endpoint.
+// We include almost everything in the key so that a modified
+// endpoint is treated as another resource for the MidoNet side.
+// Note that MidoNet Chains and Rules are not updateable.
+// For an endpoint in an EndpointSlice, the key includes the name of
+// the EndpointSlice.  Otherwise, when an endpoint moves between
+// EndpointSlices, the stale Translation of the old one would be
+// the same as the new one.
+func endpointKey(svcName string, ep *endpoint) converter.Key {
+	name := fmt.Sprintf("%s/%s/%s/%s/%d/%s", svcName, ep.portName, ep.svcIP, ep.ip, ep.port, ep.protocol)
+	if ep.slice != "" {
+		name = fmt.Sprintf("%s/%s", name, ep.slice)
+	}
+	return converter.Key{
+		Kind: "Endpoints-Port",
+		Name: name,
+	}
+}
+
+// convertEndpoints returns sub resources for the endpoints of a Service,
+// grouped by the EndpointSlices the endpoints came from.  For Endpoints,
+// everything is in the group for an empty name.
+// byPort is the endpoints of the Service, grouped by the port name.
+func convertEndpoints(svcName string, svcSpec *v1.ServiceSpec, byPort map[string][]endpoint, config *converter.Config) map[string]converter.SubResourceMap {
+	subs := make(map[string]converter.SubResourceMap)
+	add := func(ep *endpoint, k converter.Key, sub converter.SubResource) {
+		m, ok := subs[ep.slice]
+		if !ok {
+			m = make(converter.SubResourceMap)
+			subs[ep.slice] = m
+		}
+		m[k] = sub
+	}
+	svcIP := svcSpec.ClusterIP
+	// Validated by NewController
+	clusterNets, _ := converter.ParseCIDRs(config.ClusterCIDR)
+	// With ClientIP session affinity, split the traffic by source
+	// addresses rather than source ports so that a client always
+	// reaches the same endpoint.
+	affinity := svcSpec.SessionAffinity == v1.ServiceAffinityClientIP
+	local := svcSpec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal
+	ipv6 := net.ParseIP(svcIP).To4() == nil
+	for _, eps := range byPort {
+		// Sort endpoints so that the split of the traffic is
+		// deterministic.
+		sort.Slice(eps, func(i, j int) bool {
+			return eps[i].less(&eps[j])
+		})
+		for i := range eps {
+			ep := eps[i]
+			add(&ep, endpointKey(svcName, &ep), &ep)
+		}
+		// The jump rules to the endpoint are a separate sub resource
+		// so that the endpoint chain is kept intact when the split
+		// of the traffic changes.  As the key includes the split,
+		// an addition or a removal of another endpoint only affects
+		// the endpoints which gain or lose buckets.  See bucketOwners.
+		for i, split := range splitTraffic(eps, affinity, ipv6, clusterNets) {
+			ep := eps[i]
+			if split == nil {
+				continue
+			}
+			epKey := endpointKey(svcName, &ep)
+			jumpKey := converter.Key{
+				Kind: "Endpoints-Jump",
+				Name: fmt.Sprintf("%s/%s", epKey.Name, split.name),
+			}
+			add(&ep, jumpKey, &endpointJump{
+				portKey: ep.portKey(),
+				epKey:   epKey,
+				split:   *split,
+			})
+		}
+		if local {
+			addLocalEndpoints(add, svcName, eps, affinity, ipv6, clusterNets)
+		}
+	}
+	return subs
+}
+
+// localEndpointKey returns the key of the sub resource for the chain
+// for the endpoint local to a Node.
+func localEndpointKey(svcName string, ep *endpoint) converter.Key {
+	return converter.Key{
+		Kind: "Endpoints-Local",
+		Name: fmt.Sprintf("%s/%s", endpointKey(svcName, ep).Name, ep.nodeName),
+	}
+}
+
+// addLocalEndpoints adds sub resources for the Node local chains.
+// For each Nodes, the traffic is split among the endpoints on the Node.
+// Like the endpoint chains, the chain for an endpoint is separate from
+// the jump rules to it so that it can drain.
+func addLocalEndpoints(add func(*endpoint, converter.Key, converter.SubResource), svcName string, eps []endpoint, affinity, ipv6 bool, clusterNets []*net.IPNet) {
+	byNode := make(map[string][]endpoint)
+	for _, ep := range eps {
+		if ep.nodeName == "" {
+			// Not running on a Node.  E.g. an external endpoint.
+			continue
+		}
+		byNode[ep.nodeName] = append(byNode[ep.nodeName], ep)
+	}
+	for nodeName, local := range byNode {
+		for i := range local {
+			ep := local[i]
+			add(&ep, localEndpointKey(svcName, &ep), &endpointLocal{ep: ep})
+		}
+		for i, split := range splitTraffic(local, affinity, ipv6, clusterNets) {
+			ep := local[i]
+			if split == nil {
+				continue
+			}
+			localKey := localEndpointKey(svcName, &ep)
+			k := converter.Key{
+				Kind: "Endpoints-LocalJump",
+				Name: fmt.Sprintf("%s/%s", localKey.Name, split.name),
 			}
-			subs[epKey] = &ep
+			add(&ep, k, &endpointLocalJump{
+				portKey:  ep.portKey(),
+				nodeName: nodeName,
+				localKey: localKey,
+				split:    *split,
+			})
 		}
 	}
-	return resources, subs, nil
 }
@@ -17,12 +17,18 @@ package endpoints
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
 
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/service"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 )
 
 var (
@@ -74,6 +80,27 @@ var (
 		},
 	}
 
+	svcCatDogNodePort = &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeNodePort,
+			ClusterIP: "192.2.0.1",
+			Ports: []v1.ServicePort{
+				{
+					Name:     "cat",
+					Protocol: "UDP",
+					Port:     8000,
+					NodePort: 30080,
+				},
+				{
+					Name:     "dog",
+					Protocol: "TCP",
+					Port:     200,
+					NodePort: 30200,
+				},
+			},
+		},
+	}
+
 	svcEmptyClusterIP = &v1.Service{
 		Spec: v1.ServiceSpec{
 			Type:      v1.ServiceTypeClusterIP,
@@ -139,6 +166,25 @@ func (s *objGetter) GetByKey(key string) (interface{}, bool, error) {
 	return obj, exists, nil
 }
 
+// catDogSubs is the number of sub resources for endpointsCatDog.
+// An Endpoints-Port and an Endpoints-Jump for each endpoint.
+const catDogSubs = 12
+
+// subKeys returns the keys of the given kind with the given name prefix,
+// sorted by the names.
+func subKeys(subs converter.SubResourceMap, kind string, prefix string) []converter.Key {
+	var keys []converter.Key
+	for k := range subs {
+		if k.Kind == kind && strings.HasPrefix(k.Name, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+	return keys
+}
+
 type objErrorGetter struct{}
 
 func (s *objErrorGetter) GetByKey(key string) (interface{}, bool, error) {
@@ -162,7 +208,7 @@ func TestConverter(t *testing.T) {
 	rs, subs, err := c.Convert(key, endpointsCatDog, config)
 	assert.Nil(t, err)
 	assert.Len(t, rs, 0)
-	assert.Len(t, subs, 6)
+	assert.Len(t, subs, catDogSubs)
 	assert.Contains(t, subs, converter.Key{
 		Kind: "Endpoints-Port",
 		Name: "bar/cat/192.2.0.1/10.0.0.1/18000/UDP",
@@ -187,6 +233,638 @@ func TestConverter(t *testing.T) {
 		Kind: "Endpoints-Port",
 		Name: "bar/dog/192.2.0.1/10.0.0.4/10200/TCP",
 	})
+	// The traffic to a port is split into buckets.  Each of them is
+	// assigned to one of the endpoints.
+	assert.Len(t, subKeys(subs, "Endpoints-Jump", "bar/cat/"), 2)
+	assert.Len(t, subKeys(subs, "Endpoints-Jump", "bar/dog/"), 4)
+	var ranges []midonet.PortRange
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		keys := subKeys(subs, "Endpoints-Jump", "bar/dog/192.2.0.1/"+ip+"/")
+		assert.Len(t, keys, 1, ip)
+		ranges = append(ranges, subs[keys[0]].(*endpointJump).split.tpSrcs...)
+	}
+	// Every port belongs to exactly one of the endpoints.
+	assert.Equal(t, []midonet.PortRange{{Start: 1, End: 65535}}, mergePortRanges(ranges))
+	total := 0
+	for _, r := range ranges {
+		total += r.End - r.Start + 1
+	}
+	assert.Equal(t, 65535, total)
+}
+
+func TestConverterJumpRules(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svcCatDog,
+		},
+	}}
+	_, subs, err := c.Convert(key, endpointsCatDog, config)
+	assert.Nil(t, err)
+	jumpKey := subKeys(subs, "Endpoints-Jump", "bar/dog/192.2.0.1/10.0.0.2/10200/TCP/")[0]
+	rs, err := subs[jumpKey].Convert(jumpKey, config)
+	assert.Nil(t, err)
+	// A rule for each of the ranges of the buckets of the endpoint
+	split := subs[jumpKey].(*endpointJump).split
+	assert.True(t, strings.HasSuffix(jumpKey.Name, "/"+split.name))
+	assert.True(t, strings.HasSuffix(split.name, fmt.Sprintf("/%d", numBuckets(4))))
+	assert.Len(t, rs, len(split.tpSrcs))
+	assert.True(t, len(rs) >= len(portSegments))
+	rule := rs[0].(*midonet.Rule)
+	assert.Equal(t, "jump", rule.Type)
+	for i, r := range rs {
+		assert.Equal(t, split.tpSrcs[i], *r.(*midonet.Rule).TPSrc)
+		assert.Equal(t, rule.JumpChainID, r.(*midonet.Rule).JumpChainID)
+	}
+	assert.NotEqual(t, rule.ID, rs[1].(*midonet.Rule).ID)
+	portChainID := converter.IDForKey("ServicePort", "foo/bar/dog", config)
+	assert.Equal(t, &portChainID, rule.Parent.ID)
+	epKey := converter.Key{
+		Kind: "Endpoints-Port",
+		Name: "bar/dog/192.2.0.1/10.0.0.2/10200/TCP",
+	}
+	epChainID := converter.IDForKey("Endpoint", epKey.Key(), config)
+	assert.Equal(t, &epChainID, rule.JumpChainID)
+	// The endpoint chain itself doesn't have the jump rule.
+	rs, err = subs[epKey].Convert(epKey, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 3)
+	assert.Equal(t, &epChainID, rs[0].(*midonet.Chain).ID)
+}
+
+func TestConverterJumpKeysStable(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svcCatDog,
+		},
+	}}
+	var addrs []v1.EndpointAddress
+	for i := 1; i <= 16; i++ {
+		addrs = append(addrs, v1.EndpointAddress{IP: fmt.Sprintf("10.0.0.%d", i)})
+	}
+	eps := &v1.Endpoints{
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses: addrs,
+				Ports: []v1.EndpointPort{
+					{Name: "dog", Port: 10200, Protocol: "TCP"},
+				},
+			},
+		},
+	}
+	_, subs, err := c.Convert(key, eps, config)
+	assert.Nil(t, err)
+	assert.Len(t, subKeys(subs, "Endpoints-Jump", ""), 16)
+
+	// 10.0.0.3 becomes not ready.
+	eps2 := eps.DeepCopy()
+	eps2.Subsets[0].Addresses = append(addrs[:2:2], addrs[3:]...)
+	eps2.Subsets[0].NotReadyAddresses = []v1.EndpointAddress{{IP: "10.0.0.3"}}
+	_, subs2, err := c.Convert(key, eps2, config)
+	assert.Nil(t, err)
+	removed := "bar/dog/192.2.0.1/10.0.0.3/"
+	// The number of buckets doesn't change.
+	assert.Equal(t, numBuckets(16), numBuckets(15))
+	assert.Empty(t, subKeys(subs2, "Endpoints-Jump", removed))
+	// Only the endpoints which get the buckets of the removed endpoint
+	// have new jump rules.  The others keep theirs.
+	removedBuckets := strings.Count(subKeys(subs, "Endpoints-Jump", removed)[0].Name, ".") + 1
+	changed := 0
+	for _, k := range subKeys(subs, "Endpoints-Jump", "") {
+		if strings.HasPrefix(k.Name, removed) {
+			continue
+		}
+		if _, ok := subs2[k]; !ok {
+			changed++
+		}
+	}
+	assert.True(t, changed <= removedBuckets, "%d > %d", changed, removedBuckets)
+	assert.True(t, changed < 15-changed, "%d", changed)
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.4"} {
+		assert.Len(t, subKeys(subs2, "Endpoints-Jump", "bar/dog/192.2.0.1/"+ip+"/"), 1, ip)
+	}
+
+	// It becomes ready again.  Everything is back.
+	_, subs3, err := c.Convert(key, eps, config)
+	assert.Nil(t, err)
+	assert.Equal(t, subKeys(subs, "", ""), subKeys(subs3, "", ""))
+}
+
+func TestNumBuckets(t *testing.T) {
+	assert.Equal(t, 1, numBuckets(1))
+	assert.Equal(t, 8, numBuckets(2))
+	assert.Equal(t, 16, numBuckets(3))
+	assert.Equal(t, 16, numBuckets(4))
+	assert.Equal(t, 32, numBuckets(5))
+	assert.Equal(t, 128, numBuckets(17))
+	assert.Equal(t, 4096, numBuckets(1024))
+	// Capped
+	assert.Equal(t, 4096, numBuckets(1025))
+	assert.Equal(t, 4096, numBuckets(5000))
+}
+
+func TestBucketOwners(t *testing.T) {
+	var eps []endpoint
+	for i := 0; i < 8; i++ {
+		eps = append(eps, endpoint{ip: fmt.Sprintf("10.1.%d.5", i), port: 80})
+	}
+	buckets := numBuckets(len(eps))
+	owners := bucketOwners(eps, buckets)
+	counts := make([]int, len(eps))
+	for _, i := range owners {
+		counts[i]++
+	}
+	// Every endpoint gets a share.
+	for i, c := range counts {
+		assert.InDelta(t, buckets/len(eps), c, float64(buckets/len(eps))*0.75, "%d: %v", i, counts)
+	}
+
+	// Remove an endpoint.  Only its buckets move.
+	removed := 3
+	rest := append(append([]endpoint(nil), eps[:removed]...), eps[removed+1:]...)
+	owners2 := bucketOwners(rest, buckets)
+	for b, i := range owners {
+		if i == removed {
+			continue
+		}
+		assert.Equal(t, eps[i], rest[owners2[b]], "bucket %d", b)
+	}
+}
+
+func TestSplitTrafficManyEndpoints(t *testing.T) {
+	for _, n := range []int{1025, 3000, 5000} {
+		var eps []endpoint
+		for i := 0; i < n; i++ {
+			eps = append(eps, endpoint{ip: fmt.Sprintf("10.%d.%d.%d", i>>16, (i>>8)&0xff, i&0xff), port: 80})
+		}
+		// Only some endpoints get no traffic when there are
+		// not enough buckets.
+		minWithTraffic := n * 9 / 10
+		if minWithTraffic > maxBuckets/2 {
+			minWithTraffic = maxBuckets / 2
+		}
+		var ranges []midonet.PortRange
+		withTraffic := 0
+		for _, s := range splitTraffic(eps, false, false, nil) {
+			if s == nil {
+				continue
+			}
+			withTraffic++
+			ranges = append(ranges, s.tpSrcs...)
+		}
+		assert.True(t, withTraffic > minWithTraffic, "%d: %d", n, withTraffic)
+		// A handful of ranges for each bucket
+		assert.True(t, len(ranges) <= len(portSegments)*maxBuckets, "%d: %d", n, len(ranges))
+		// Every port still belongs to exactly one of the endpoints.
+		assert.Equal(t, []midonet.PortRange{{Start: 1, End: 65535}}, mergePortRanges(ranges), "%d", n)
+		total := 0
+		for _, r := range ranges {
+			total += r.End - r.Start + 1
+		}
+		assert.Equal(t, 65535, total, "%d", n)
+
+		// The same for ClientIP session affinity
+		withTraffic = 0
+		for _, s := range splitTraffic(eps, true, false, nil) {
+			if s != nil {
+				withTraffic++
+			}
+		}
+		assert.True(t, withTraffic > minWithTraffic, "%d: %d", n, withTraffic)
+	}
+}
+
+func TestBucketSplit(t *testing.T) {
+	// Adjacent buckets are merged.
+	s := bucketSplit([]int{0, 1, 3}, 4, false, false, nil)
+	assert.Equal(t, "0-1.3/4", s.name)
+	assert.Equal(t, []midonet.PortRange{
+		{Start: 1, End: 16383},
+		{Start: 24576, End: 40959},
+		{Start: 45056, End: 55075},
+		{Start: 58038, End: 63267},
+		{Start: 64402, End: 65535},
+	}, s.tpSrcs)
+	// With session affinity, the name also identifies the source
+	// networks as the rules are not updateable.
+	s = bucketSplit([]int{0, 1, 3}, 4, true, false, nil)
+	assert.True(t, strings.HasPrefix(s.name, "0-1.3/4/ClientIP-"), s.name)
+	assert.Equal(t, "[0.0.0.0/1 192.0.0.0/2]", fmt.Sprint(s.srcNets))
+	_, clusterNet, _ := net.ParseCIDR("10.1.0.0/16")
+	s2 := bucketSplit([]int{0, 1, 3}, 4, true, false, []*net.IPNet{clusterNet})
+	assert.NotEqual(t, s.name, s2.name)
+	s = bucketSplit([]int{1, 2, 3}, 4, true, true, nil)
+	assert.True(t, strings.HasPrefix(s.name, "1-3/4/ClientIP-"), s.name)
+	assert.Equal(t, "[4000::/2 8000::/1]", fmt.Sprint(s.srcNets))
+	// No buckets
+	assert.Nil(t, bucketSplit(nil, 4, false, false, nil))
+	// The cluster network covers the whole part.
+	_, all, _ := net.ParseCIDR("::/0")
+	s = bucketSplit([]int{3}, 8192, true, true, []*net.IPNet{all})
+	assert.Equal(t, "[18::/13]", fmt.Sprint(s.srcNets))
+}
+
+func TestConverterSessionAffinity(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	svc := svcCatDog.DeepCopy()
+	svc.Spec.SessionAffinity = v1.ServiceAffinityClientIP
+	c := &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svc,
+		},
+	}}
+	_, subs, err := c.Convert(key, endpointsCatDog, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, catDogSubs)
+	jumpKey := subKeys(subs, "Endpoints-Jump", "bar/dog/192.2.0.1/10.0.0.2/10200/TCP/")[0]
+	rs, err := subs[jumpKey].Convert(jumpKey, config)
+	assert.Nil(t, err)
+	// 1/16 of the address space for each bucket
+	split := subs[jumpKey].(*endpointJump).split
+	assert.Len(t, rs, len(split.srcNets))
+	for _, r := range rs {
+		rule := r.(*midonet.Rule)
+		assert.Equal(t, "jump", rule.Type)
+		assert.Nil(t, rule.TPSrc)
+		assert.Equal(t, 0x800, rule.DLType)
+		assert.True(t, rule.NWSrcLength >= 4, "%d", rule.NWSrcLength)
+	}
+}
+
+func TestSpanPortRanges(t *testing.T) {
+	assert.Equal(t, []midonet.PortRange{{Start: 1, End: 65535}}, spanPortRanges(0, 0, 1))
+	assert.Equal(t, []midonet.PortRange{
+		{Start: 1, End: 10922},
+		{Start: 32768, End: 38228},
+		{Start: 49152, End: 53100},
+		{Start: 61000, End: 62511},
+	}, spanPortRanges(0, 0, 3))
+	assert.Equal(t, []midonet.PortRange{
+		{Start: 21845, End: 32767},
+		{Start: 43690, End: 49151},
+		{Start: 57050, End: 60999},
+		{Start: 64024, End: 65535},
+	}, spanPortRanges(2, 2, 3))
+	assert.Equal(t, []midonet.PortRange{
+		{Start: 10923, End: 32767},
+		{Start: 38229, End: 49151},
+		{Start: 53101, End: 60999},
+		{Start: 62512, End: 65535},
+	}, spanPortRanges(1, 2, 3))
+	// Too many buckets for the last segment
+	assert.Len(t, spanPortRanges(0, 0, 5000), 3)
+}
+
+func TestNthPortRangesDistribution(t *testing.T) {
+	// Ephemeral port ranges of typical clients.
+	ephemerals := []midonet.PortRange{
+		{Start: 32768, End: 60999}, // Linux
+		{Start: 49152, End: 65535}, // IANA, e.g. Windows and BSDs
+	}
+	overlap := func(a, b midonet.PortRange) int {
+		start, end := a.Start, a.End
+		if b.Start > start {
+			start = b.Start
+		}
+		if b.End < end {
+			end = b.End
+		}
+		if start > end {
+			return 0
+		}
+		return end - start + 1
+	}
+	for n := 1; n <= 10; n++ {
+		for _, e := range ephemerals {
+			size := e.End - e.Start + 1
+			total := 0
+			for i := 0; i < n; i++ {
+				count := 0
+				for _, r := range spanPortRanges(i, i, n) {
+					count += overlap(r, e)
+				}
+				// Every endpoint gets its share, give or take
+				// the rounding for each segment.
+				assert.InDelta(t, size/n, count, 4, "%d/%d %v", i, n, e)
+				total += count
+			}
+			assert.Equal(t, size, total)
+		}
+	}
+}
+
+func TestSpanAddressRanges(t *testing.T) {
+	rs := spanAddressRanges(0, 0, 1, nil)
+	assert.Len(t, rs, 1)
+	first, last := rs[0].bounds()
+	assert.Equal(t, "0.0.0.0", first.String())
+	assert.Equal(t, "255.255.255.255", last.String())
+	assert.Len(t, rs[0].cidrs(), 1)
+	assert.Equal(t, "0.0.0.0/0", rs[0].cidrs()[0].String())
+	rs = spanAddressRanges(1, 1, 3, nil)
+	assert.Len(t, rs, 1)
+	r := rs[0]
+	first, last = r.bounds()
+	assert.Equal(t, "85.85.85.85", first.String())
+	assert.Equal(t, "170.170.170.169", last.String())
+	cidrs := r.cidrs()
+	assert.Equal(t, "85.85.85.85/32", cidrs[0].String())
+	assert.Equal(t, "170.170.170.168/31", cidrs[len(cidrs)-1].String())
+	// The CIDRs should be contiguous.
+	next := r.first
+	for _, n := range cidrs {
+		assert.Equal(t, uint32ToIP(next).String(), n.IP.String())
+		ones, _ := n.Mask.Size()
+		next += uint32(1) << uint(32-ones)
+	}
+	assert.Equal(t, r.last+1, next)
+}
+
+func TestSpanAddressRangesClusterNetworks(t *testing.T) {
+	var clusterNets []*net.IPNet
+	for _, cidr := range []string{"10.1.0.0/16", "fd00:1::/64"} {
+		_, n, err := net.ParseCIDR(cidr)
+		assert.Nil(t, err)
+		clusterNets = append(clusterNets, n)
+	}
+	bounds := func(rs []addressRange) []string {
+		var l []string
+		for _, r := range rs {
+			first, last := r.bounds()
+			l = append(l, fmt.Sprintf("%s-%s", first, last))
+		}
+		return l
+	}
+	// The cluster network is split separately from the rest.
+	assert.Equal(t, []string{
+		"10.1.0.0-10.1.127.255",
+		"0.0.0.0-10.0.255.255",
+		"10.2.0.0-127.255.255.255",
+	}, bounds(spanAddressRanges(0, 0, 2, clusterNets)))
+	assert.Equal(t, []string{
+		"10.1.128.0-10.1.255.255",
+		"128.0.0.0-255.255.255.255",
+	}, bounds(spanAddressRanges(1, 1, 2, clusterNets)))
+	// Every Pod address belongs to exactly one of the splits, and
+	// the splits are even.
+	counts := make([]int, 4)
+	for i := range counts {
+		for _, r := range spanAddressRanges(i, i, len(counts), clusterNets) {
+			for _, n := range r.cidrs() {
+				if !clusterNets[0].Contains(n.IP) {
+					continue
+				}
+				ones, _ := n.Mask.Size()
+				counts[i] += 1 << uint(32-ones)
+			}
+		}
+	}
+	assert.Equal(t, []int{16384, 16384, 16384, 16384}, counts)
+}
+
+func TestNthIPv6Nets(t *testing.T) {
+	strs := func(nets []*net.IPNet) []string {
+		var l []string
+		for _, n := range nets {
+			l = append(l, n.String())
+		}
+		return l
+	}
+	assert.Equal(t, []string{"::/0"}, strs(nthIPv6Nets(0, 1, nil)))
+	assert.Equal(t, []string{"8000::/1"}, strs(nthIPv6Nets(1, 2, nil)))
+
+	var clusterNets []*net.IPNet
+	for _, cidr := range []string{"10.1.0.0/16", "fd00:1::/64"} {
+		_, n, err := net.ParseCIDR(cidr)
+		assert.Nil(t, err)
+		clusterNets = append(clusterNets, n)
+	}
+	// The cluster network is split separately from the rest.
+	assert.Equal(t, []string{
+		"fd00:1:0:0:8000::/65",
+		"8000::/2",
+		"c000::/3",
+		"e000::/4",
+		"f000::/5",
+		"f800::/6",
+		"fc00::/8",
+	}, strs(nthIPv6Nets(1, 2, clusterNets))[:7])
+	// Every Pod address belongs to exactly one of the splits.
+	for _, ip := range []string{"fd00:1::1", "fd00:1::8000:0:0:1", "fd00:1::ffff:ffff:ffff:ffff", "fd00:2::1", "::1"} {
+		found := 0
+		for i := 0; i < 4; i++ {
+			for _, n := range nthIPv6Nets(i, 4, clusterNets) {
+				if n.Contains(net.ParseIP(ip)) {
+					found++
+				}
+			}
+		}
+		assert.Equal(t, 1, found, ip)
+	}
+	// The cluster network covers the whole part.
+	_, all, _ := net.ParseCIDR("::/0")
+	assert.Equal(t, []string{"::/1"}, strs(nthIPv6Nets(0, 2, []*net.IPNet{all})))
+}
+
+func TestConverterSessionAffinityClusterCIDR(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	config := &converter.Config{
+		Tenant:      "MyTenant",
+		ClusterCIDR: []string{"10.1.0.0/16"},
+	}
+	svc := svcCatDog.DeepCopy()
+	svc.Spec.SessionAffinity = v1.ServiceAffinityClientIP
+	c := &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svc,
+		},
+	}}
+	_, subs, err := c.Convert(key, endpointsCatDog, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, catDogSubs)
+	// Each bucket has a part of the cluster network, i.e. 1/8 of it.
+	keys := subKeys(subs, "Endpoints-Jump", "bar/cat/")
+	assert.Len(t, keys, 2)
+	_, clusterNet, _ := net.ParseCIDR("10.1.0.0/16")
+	total := 0
+	for _, k := range keys {
+		rs, err := subs[k].Convert(k, config)
+		assert.Nil(t, err)
+		for _, r := range rs {
+			rule := r.(*midonet.Rule)
+			if !clusterNet.Contains(net.ParseIP(rule.NWSrcAddress)) {
+				continue
+			}
+			assert.True(t, rule.NWSrcLength >= 19, "%d", rule.NWSrcLength)
+			total += 1 << uint(32-rule.NWSrcLength)
+		}
+	}
+	assert.Equal(t, 65536, total)
+}
+
+func TestConverterUnsupportedProtocol(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svcCatDog,
+		},
+	}}
+	eps := &v1.Endpoints{
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses: []v1.EndpointAddress{
+					{IP: "10.0.0.1"},
+				},
+				Ports: []v1.EndpointPort{
+					{Name: "cat", Port: 18000, Protocol: "DCCP"},
+					{Name: "dog", Port: 10200, Protocol: "SCTP"},
+				},
+			},
+		},
+	}
+	rs, subs, err := c.Convert(key, eps, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 0)
+	assert.Len(t, subs, 2)
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Endpoints-Port",
+		Name: "bar/dog/192.2.0.1/10.0.0.1/10200/SCTP",
+	})
+}
+
+func TestConverterLocal(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	svc := svcCatDogNodePort.DeepCopy()
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	c := &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svc,
+		},
+	}}
+	node1 := "node1"
+	node2 := "node2"
+	eps := &v1.Endpoints{
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses: []v1.EndpointAddress{
+					{IP: "10.0.0.1", NodeName: &node1},
+					{IP: "10.0.0.2", NodeName: &node2},
+					{IP: "10.0.0.3", NodeName: &node2},
+					{IP: "192.0.2.1"},
+				},
+				Ports: []v1.EndpointPort{
+					{Name: "dog", Port: 10200, Protocol: "TCP"},
+				},
+			},
+		},
+	}
+	_, subs, err := c.Convert(key, eps, config)
+	assert.Nil(t, err)
+	assert.Len(t, subKeys(subs, "Endpoints-Port", ""), 4)
+	assert.Len(t, subKeys(subs, "Endpoints-Jump", ""), 4)
+	assert.Len(t, subKeys(subs, "Endpoints-Local", ""), 3)
+	assert.Len(t, subKeys(subs, "Endpoints-LocalJump", ""), 3)
+	assert.Equal(t, []converter.Key{{
+		Kind: "Endpoints-LocalJump",
+		Name: "bar/dog/192.2.0.1/10.0.0.1/10200/TCP/node1/0/1",
+	}}, subKeys(subs, "Endpoints-LocalJump", "bar/dog/192.2.0.1/10.0.0.1/"))
+	assert.NotEmpty(t, subKeys(subs, "Endpoints-LocalJump", "bar/dog/192.2.0.1/10.0.0.2/10200/TCP/node2/"))
+
+	localKey := converter.Key{
+		Kind: "Endpoints-Local",
+		Name: "bar/dog/192.2.0.1/10.0.0.3/10200/TCP/node2",
+	}
+	assert.Contains(t, subs, localKey)
+	rs, err := subs[localKey].Convert(localKey, config)
+	assert.Nil(t, err)
+	// chain, DNAT
+	assert.Len(t, rs, 2)
+	localChainID := *rs[0].(*midonet.Chain).ID
+	rule := rs[1].(*midonet.Rule)
+	assert.Equal(t, "dnat", rule.Type)
+	assert.Equal(t, &localChainID, rule.Parent.ID)
+	assert.Equal(t, "10.0.0.3", (*rule.NATTargets)[0].AddressFrom)
+
+	keys := subKeys(subs, "Endpoints-LocalJump", localKey.Name+"/")
+	assert.NotEmpty(t, keys)
+	k := keys[0]
+	rs, err = subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, len(subs[k].(*endpointLocalJump).split.tpSrcs))
+	rule = rs[0].(*midonet.Rule)
+	assert.Equal(t, "jump", rule.Type)
+	assert.Equal(t, &localChainID, rule.JumpChainID)
+	assert.True(t, strings.HasSuffix(k.Name, fmt.Sprintf("/%d", numBuckets(2))))
+	chainID := service.LocalEndpointsChainID("foo/bar/dog", "node2", config)
+	assert.Equal(t, &chainID, rule.Parent.ID)
+}
+
+func TestConverterNodePort(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svcCatDogNodePort,
+		},
+	}}
+	rs, subs, err := c.Convert(key, endpointsCatDog, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 0)
+	assert.Len(t, subs, catDogSubs)
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Endpoints-Port",
+		Name: "bar/cat/192.2.0.1/10.0.0.1/18000/UDP",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Endpoints-Port",
+		Name: "bar/dog/192.2.0.1/10.0.0.4/10200/TCP",
+	})
 }
 
 func TestConverterServiceNoPorts(t *testing.T) {
@@ -206,7 +884,7 @@ func TestConverterServiceNoPorts(t *testing.T) {
 	rs, subs, err := c.Convert(key, endpointsCatDog, config)
 	assert.Nil(t, err)
 	assert.Len(t, rs, 0)
-	assert.Len(t, subs, 6)
+	assert.Len(t, subs, catDogSubs)
 	assert.Contains(t, subs, converter.Key{
 		Kind: "Endpoints-Port",
 		Name: "bar/cat/192.2.0.1/10.0.0.1/18000/UDP",
@@ -273,6 +951,62 @@ func TestConverterClusterIPNone(t *testing.T) {
 	assert.Len(t, subs, 0)
 }
 
+func TestConverterIPv6ClusterIP(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	svc := svcEmptyClusterIP.DeepCopy()
+	svc.Spec.ClusterIP = "fd00:96::10"
+	c := &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svc,
+		},
+	}}
+	// IPv4 endpoints are ignored for an IPv6 ClusterIP.
+	rs, subs, err := c.Convert(key, endpointsCatDog, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 0)
+	assert.Len(t, subs, 0)
+
+	eps := &v1.Endpoints{
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses: []v1.EndpointAddress{
+					{IP: "10.0.0.1"},
+					{IP: "fd00:1::1"},
+				},
+				Ports: []v1.EndpointPort{
+					{Name: "cat", Port: 18000, Protocol: "UDP"},
+				},
+			},
+		},
+	}
+	rs, subs, err = c.Convert(key, eps, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 0)
+	// The endpoint and its jump rules
+	assert.Len(t, subs, 2)
+	k := converter.Key{
+		Kind: "Endpoints-Port",
+		Name: "bar/cat/fd00:96::10/fd00:1::1/18000/UDP",
+	}
+	assert.Contains(t, subs, k)
+	rs, err = subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	dnat := rs[1].(*midonet.Rule)
+	assert.Equal(t, "fd00:1::1", (*dnat.NATTargets)[0].AddressFrom)
+	snat := rs[2].(*midonet.Rule)
+	assert.Equal(t, 0x86dd, snat.DLType)
+	assert.Equal(t, "fd00:1::1", snat.NWSrcAddress)
+	assert.Equal(t, 128, snat.NWSrcLength)
+	assert.Equal(t, "fd00:96::10", (*snat.NATTargets)[0].AddressFrom)
+}
+
 func TestConverterWithoutService(t *testing.T) {
 	key := converter.Key{
 		Kind:      "Endpoints",
@@ -302,3 +1036,50 @@ func TestConverterGetterError(t *testing.T) {
 	_, _, err := c.Convert(key, endpointsCatDog, config)
 	assert.Error(t, err)
 }
+
+func TestConverterPublishNotReadyAddresses(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	eps := endpointsCatDog.DeepCopy()
+	eps.Subsets[1].NotReadyAddresses = []v1.EndpointAddress{
+		{IP: "10.0.0.5"},
+	}
+	epKey := converter.Key{
+		Kind: "Endpoints-Port",
+		Name: "bar/dog/192.2.0.1/10.0.0.5/10200/TCP",
+	}
+	c := &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svcCatDog,
+		},
+	}}
+	_, subs, err := c.Convert(key, eps, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, catDogSubs)
+	assert.NotContains(t, subs, epKey)
+
+	svc := svcCatDog.DeepCopy()
+	svc.Spec.PublishNotReadyAddresses = true
+	c = &endpointsConverter{svcGetter: &objGetter{
+		objs: map[string]interface{}{
+			"foo/bar": svc,
+		},
+	}}
+	_, subs, err = c.Convert(key, eps, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, catDogSubs+2)
+	assert.Contains(t, subs, epKey)
+
+	// The endpoint becomes ready.  Its key doesn't change.
+	eps.Subsets[1].NotReadyAddresses = nil
+	eps.Subsets[1].Addresses = append(eps.Subsets[1].Addresses, v1.EndpointAddress{IP: "10.0.0.5"})
+	_, subs2, err := c.Convert(key, eps, config)
+	assert.Nil(t, err)
+	assert.Equal(t, subs, subs2)
+}
@@ -0,0 +1,256 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package endpoints
+
+import (
+	"net"
+	"sort"
+	"sync"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	discoveryv1 "github.com/midonet/midonet-kubernetes/pkg/apis/discovery/v1"
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/service"
+)
+
+// serviceIndex is the name of the index of EndpointSlices by
+// the namespace/name key of their Service.
+const serviceIndex = "service"
+
+// sliceIndexer is the subset of cache.Indexer the EndpointSlice
+// converter uses.
+type sliceIndexer interface {
+	ByIndex(indexName, indexedValue string) ([]interface{}, error)
+}
+
+// serviceKey returns the namespace/name key of the Service the given
+// EndpointSlice belongs to, or an empty string if the EndpointSlice
+// doesn't belong to a Service.
+func serviceKey(slice *discoveryv1.EndpointSlice) string {
+	name := slice.Labels[discoveryv1.LabelServiceName]
+	if name == "" {
+		return ""
+	}
+	return slice.Namespace + "/" + name
+}
+
+func indexByService(obj interface{}) ([]string, error) {
+	k := serviceKey(obj.(*discoveryv1.EndpointSlice))
+	if k == "" {
+		return nil, nil
+	}
+	return []string{k}, nil
+}
+
+// splitCache caches the translations of the EndpointSlices of Services.
+// The traffic to a Service is split among the endpoints in all
+// EndpointSlices of the Service.  Instead of computing the split
+// for each EndpointSlice, it's computed once for the Service and
+// shared among its EndpointSlices.
+type splitCache struct {
+	svcGetter cache.KeyGetter
+	slices    sliceIndexer
+
+	mu      sync.Mutex
+	entries map[string]*serviceSplit
+}
+
+// serviceSplit is a cached translation of the EndpointSlices of a Service.
+type serviceSplit struct {
+	// objs is the Service and its EndpointSlices the translation was
+	// computed from.  Objects in informer caches are never modified
+	// in place.  Thus, comparing pointers is enough to see if the
+	// translation is still valid.
+	objs []interface{}
+	// subs is the sub resources, grouped by the EndpointSlice name.
+	subs map[string]converter.SubResourceMap
+}
+
+func newSplitCache(svcGetter cache.KeyGetter, slices sliceIndexer) *splitCache {
+	return &splitCache{
+		svcGetter: svcGetter,
+		slices:    slices,
+		entries:   make(map[string]*serviceSplit),
+	}
+}
+
+func sameObjects(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the sub resources for the EndpointSlices of the Service
+// with the given namespace/name key, grouped by the EndpointSlice name.
+// It returns nil if the Service doesn't exist or isn't translatable.
+func (c *splitCache) get(svcKey string, config *converter.Config) (map[string]converter.SubResourceMap, error) {
+	svcObj, exists, err := c.svcGetter.GetByKey(svcKey)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !exists {
+		// Ignore EndpointSlices without the corresponding service.
+		// Note: This might or might not be transient.
+		delete(c.entries, svcKey)
+		return nil, nil
+	}
+	svc := svcObj.(*v1.Service)
+	if !service.Translatable(&svc.Spec) {
+		// Ignore EndpointSlices without a ClusterIP.
+		delete(c.entries, svcKey)
+		return nil, nil
+	}
+	objs, err := c.slices.ByIndex(serviceIndex, svcKey)
+	if err != nil {
+		return nil, err
+	}
+	slices := make([]*discoveryv1.EndpointSlice, 0, len(objs))
+	for _, o := range objs {
+		slices = append(slices, o.(*discoveryv1.EndpointSlice))
+	}
+	// Sort EndpointSlices so that the owner of an endpoint which
+	// appears in multiple EndpointSlices is deterministic.
+	// It can happen transiently while the endpoint is moving
+	// between EndpointSlices.
+	sort.Slice(slices, func(i, j int) bool {
+		return slices[i].Name < slices[j].Name
+	})
+	key := []interface{}{svc}
+	for _, s := range slices {
+		key = append(key, s)
+	}
+	if e, ok := c.entries[svcKey]; ok && sameObjects(e.objs, key) {
+		return e.subs, nil
+	}
+	_, svcName, err := cache.SplitMetaNamespaceKey(svcKey)
+	if err != nil {
+		return nil, err
+	}
+	subs := convertEndpoints(svcName, &svc.Spec, sliceEndpoints(svcKey, svc.Spec.ClusterIP, slices, svc.Spec.PublishNotReadyAddresses), config)
+	c.entries[svcKey] = &serviceSplit{objs: key, subs: subs}
+	return subs, nil
+}
+
+type endpointSliceConverter struct {
+	splits *splitCache
+}
+
+func newEndpointSliceConverter(splits *splitCache) converter.Converter {
+	return &endpointSliceConverter{splits}
+}
+
+// addressType returns the type of the EndpointSlices for the Service
+// with the given ClusterIP.
+func addressType(svcIP string) discoveryv1.AddressType {
+	if net.ParseIP(svcIP).To4() != nil {
+		return discoveryv1.AddressTypeIPv4
+	}
+	return discoveryv1.AddressTypeIPv6
+}
+
+// sliceEndpoints returns the endpoints in the given EndpointSlices,
+// grouped by the port name.
+// An endpoint which appears in multiple EndpointSlices is owned by
+// the first one.
+func sliceEndpoints(key string, svcIP string, slices []*discoveryv1.EndpointSlice, publishNotReady bool) map[string][]endpoint {
+	m := make(map[string][]endpoint, 0)
+	seen := make(map[endpoint]bool)
+	typ := addressType(svcIP)
+	for _, s := range slices {
+		if s.AddressType != typ {
+			// Endpoints of the other family for a dual-stack
+			// Service, or FQDN ones which we don't support.
+			continue
+		}
+		for _, e := range s.Endpoints {
+			if len(e.Addresses) == 0 || net.ParseIP(e.Addresses[0]) == nil {
+				continue
+			}
+			if !publishNotReady && e.Conditions.Ready != nil && !*e.Conditions.Ready {
+				continue
+			}
+			nodeName := ""
+			if e.NodeName != nil {
+				nodeName = *e.NodeName
+			}
+			for _, p := range s.Ports {
+				if p.Port == nil {
+					// "All ports", which we don't support.
+					continue
+				}
+				portName := ""
+				if p.Name != nil {
+					portName = *p.Name
+				}
+				protocol := v1.ProtocolTCP
+				if p.Protocol != nil {
+					protocol = *p.Protocol
+				}
+				if _, err := converter.ProtocolNumber(protocol); err != nil {
+					// The service converter doesn't create
+					// the chain for the port either.
+					continue
+				}
+				ep := endpoint{
+					endpointsKey: key,
+					portName:     portName,
+					svcIP:        svcIP,
+					// Consumers are expected to use only the
+					// first address.
+					ip:       e.Addresses[0],
+					port:     int(*p.Port),
+					protocol: protocol,
+					nodeName: nodeName,
+				}
+				if seen[ep] {
+					continue
+				}
+				seen[ep] = true
+				ep.slice = s.Name
+				m[portName] = append(m[portName], ep)
+			}
+		}
+	}
+	return m
+}
+
+func (c *endpointSliceConverter) Convert(key converter.Key, obj interface{}, config *converter.Config) ([]converter.BackendResource, converter.SubResourceMap, error) {
+	resources := make([]converter.BackendResource, 0)
+	slice := obj.(*discoveryv1.EndpointSlice)
+	svcKey := serviceKey(slice)
+	if svcKey == "" {
+		// Ignore EndpointSlices which don't belong to a Service.
+		return nil, nil, nil
+	}
+	// The traffic to the Service is split among the endpoints in
+	// all EndpointSlices of the Service.  This EndpointSlice only
+	// translates its own endpoints, though.
+	subs, err := c.splits.get(svcKey, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resources, subs[slice.Name], nil
+}
@@ -0,0 +1,422 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package endpoints
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	discoveryv1 "github.com/midonet/midonet-kubernetes/pkg/apis/discovery/v1"
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func protocolPtr(p v1.Protocol) *v1.Protocol {
+	return &p
+}
+
+var (
+	sliceCatDog = &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "bar-a",
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: "bar",
+			},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}},
+			{
+				Addresses:  []string{"10.0.0.2"},
+				Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(true)},
+			},
+		},
+		Ports: []discoveryv1.EndpointPort{
+			{Name: strPtr("cat"), Port: int32Ptr(18000), Protocol: protocolPtr("UDP")},
+			{Name: strPtr("dog"), Port: int32Ptr(10200), Protocol: protocolPtr("TCP")},
+		},
+	}
+
+	sliceDog = &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "bar-b",
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: "bar",
+			},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.3"}},
+			{Addresses: []string{"10.0.0.4"}},
+			{
+				Addresses:  []string{"10.0.0.5"},
+				Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(false)},
+			},
+		},
+		Ports: []discoveryv1.EndpointPort{
+			{Name: strPtr("dog"), Port: int32Ptr(10200), Protocol: protocolPtr("TCP")},
+		},
+	}
+)
+
+type sliceGetter struct {
+	slices map[string][]interface{}
+}
+
+func (s *sliceGetter) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	return s.slices[indexedValue], nil
+}
+
+func newTestSplitCache() *splitCache {
+	return newSplitCache(
+		&objGetter{
+			objs: map[string]interface{}{
+				"foo/bar": svcCatDog,
+			},
+		},
+		&sliceGetter{
+			slices: map[string][]interface{}{
+				"foo/bar": {sliceCatDog, sliceDog},
+			},
+		},
+	)
+}
+
+func newTestSliceConverter() *endpointSliceConverter {
+	return &endpointSliceConverter{newTestSplitCache()}
+}
+
+// withoutSlice returns the key with the EndpointSlice name removed.
+func withoutSlice(k converter.Key) converter.Key {
+	for _, name := range []string{"/bar-a", "/bar-b"} {
+		k.Name = strings.Replace(k.Name, name, "", 1)
+	}
+	return k
+}
+
+func TestSliceConverter(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := newTestSliceConverter()
+	key := converter.Key{
+		Kind:      "EndpointSlice",
+		Namespace: "foo",
+		Name:      "bar-a",
+	}
+	_, subsA, err := c.Convert(key, sliceCatDog, config)
+	assert.Nil(t, err)
+	assert.Len(t, subKeys(subsA, "Endpoints-Port", ""), 4)
+	key.Name = "bar-b"
+	_, subsB, err := c.Convert(key, sliceDog, config)
+	assert.Nil(t, err)
+	assert.Len(t, subKeys(subsB, "Endpoints-Port", ""), 2)
+	// The keys include the name of the EndpointSlice so that
+	// they don't collide when an endpoint moves between
+	// EndpointSlices.
+	assert.Equal(t, []converter.Key{
+		{Kind: "Endpoints-Port", Name: "bar/dog/192.2.0.1/10.0.0.3/10200/TCP/bar-b"},
+		{Kind: "Endpoints-Port", Name: "bar/dog/192.2.0.1/10.0.0.4/10200/TCP/bar-b"},
+	}, subKeys(subsB, "Endpoints-Port", ""))
+	// Other than that, the union should be the same as the translation
+	// of the equivalent Endpoints.
+	ec := &endpointsConverter{svcGetter: c.splits.svcGetter}
+	_, subs, err := ec.Convert(converter.Key{
+		Kind:      "Endpoints",
+		Namespace: "foo",
+		Name:      "bar",
+	}, endpointsCatDog, config)
+	assert.Nil(t, err)
+	union := make(converter.SubResourceMap)
+	for _, m := range []converter.SubResourceMap{subsA, subsB} {
+		for k, sub := range m {
+			union[withoutSlice(k)] = sub
+		}
+	}
+	assert.Equal(t, len(subs), len(subsA)+len(subsB))
+	for k := range subs {
+		assert.Contains(t, union, k)
+	}
+	// The jump rule refers to the chain of the endpoint in the same
+	// EndpointSlice.
+	keys := subKeys(subsB, "Endpoints-Jump", "bar/dog/192.2.0.1/10.0.0.3/10200/TCP/bar-b/")
+	assert.NotEmpty(t, keys)
+	jumpKey := keys[0]
+	rs, err := subsB[jumpKey].Convert(jumpKey, config)
+	assert.Nil(t, err)
+	epKey := converter.Key{Kind: "Endpoints-Port", Name: "bar/dog/192.2.0.1/10.0.0.3/10200/TCP/bar-b"}
+	epChainID := converter.IDForKey("Endpoint", epKey.Key(), config)
+	for _, r := range rs {
+		assert.Equal(t, epChainID, *r.(*midonet.Rule).JumpChainID)
+	}
+}
+
+func TestSliceConverterMovedEndpoint(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := newTestSliceConverter()
+	key := converter.Key{
+		Kind:      "EndpointSlice",
+		Namespace: "foo",
+		Name:      "bar-b",
+	}
+	_, oldSubs, err := c.Convert(key, sliceDog, config)
+	assert.Nil(t, err)
+
+	// 10.0.0.3 moved from "bar-b" to "bar-c".
+	newSlice := sliceDog.DeepCopy()
+	newSlice.Endpoints = newSlice.Endpoints[1:]
+	moved := sliceDog.DeepCopy()
+	moved.Name = "bar-c"
+	moved.Endpoints = moved.Endpoints[:1]
+	c.splits.slices.(*sliceGetter).slices["foo/bar"] = []interface{}{sliceCatDog, newSlice, moved}
+	_, subsB, err := c.Convert(key, newSlice, config)
+	assert.Nil(t, err)
+	key.Name = "bar-c"
+	_, subsC, err := c.Convert(key, moved, config)
+	assert.Nil(t, err)
+	// The Translations of the new owner don't collide with
+	// the stale ones of the old owner.
+	for k := range subsC {
+		assert.NotContains(t, oldSubs, k)
+		assert.NotContains(t, subsB, k)
+	}
+	assert.Len(t, subKeys(subsC, "Endpoints-Port", ""), 1)
+}
+
+func TestSliceConverterDuplicate(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := newTestSliceConverter()
+	dup := sliceDog.DeepCopy()
+	dup.Name = "bar-c"
+	c.splits.slices.(*sliceGetter).slices["foo/bar"] = []interface{}{sliceCatDog, sliceDog, dup}
+	key := converter.Key{
+		Kind:      "EndpointSlice",
+		Namespace: "foo",
+		Name:      "bar-c",
+	}
+	_, subs, err := c.Convert(key, dup, config)
+	assert.Nil(t, err)
+	// The endpoints are owned by "bar-b".
+	assert.Len(t, subs, 0)
+}
+
+func TestSliceConverterWithoutService(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := newTestSliceConverter()
+	slice := sliceDog.DeepCopy()
+	slice.Labels = nil
+	key := converter.Key{
+		Kind:      "EndpointSlice",
+		Namespace: "foo",
+		Name:      "bar-b",
+	}
+	_, subs, err := c.Convert(key, slice, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 0)
+}
+
+func TestSliceConverterAddressType(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := newTestSliceConverter()
+	v6 := sliceDog.DeepCopy()
+	v6.Name = "bar-c"
+	v6.AddressType = discoveryv1.AddressTypeIPv6
+	v6.Endpoints = []discoveryv1.Endpoint{
+		{Addresses: []string{"fd00:1::3"}},
+	}
+	c.splits.slices.(*sliceGetter).slices["foo/bar"] = []interface{}{sliceCatDog, sliceDog, v6}
+	key := converter.Key{
+		Kind:      "EndpointSlice",
+		Namespace: "foo",
+		Name:      "bar-c",
+	}
+	// Ignored for an IPv4 ClusterIP
+	_, subs, err := c.Convert(key, v6, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 0)
+
+	svc := svcCatDog.DeepCopy()
+	svc.Spec.ClusterIP = "fd00:96::10"
+	c.splits.svcGetter.(*objGetter).objs["foo/bar"] = svc
+	_, subs, err = c.Convert(key, v6, config)
+	assert.Nil(t, err)
+	assert.Equal(t, []converter.Key{
+		{Kind: "Endpoints-Port", Name: "bar/dog/fd00:96::10/fd00:1::3/10200/TCP/bar-c"},
+	}, subKeys(subs, "Endpoints-Port", ""))
+	// The IPv4 ones are ignored for an IPv6 ClusterIP
+	key.Name = "bar-b"
+	_, subs, err = c.Convert(key, sliceDog, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 0)
+}
+
+func TestSplitCache(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := newTestSplitCache()
+	subs, err := c.get("foo/bar", config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 2)
+	// Computed once for the Service.
+	again, err := c.get("foo/bar", config)
+	assert.Nil(t, err)
+	assert.Equal(t, reflect.ValueOf(subs).Pointer(), reflect.ValueOf(again).Pointer())
+	// Recomputed when an EndpointSlice is updated.
+	newSlice := sliceDog.DeepCopy()
+	c.slices.(*sliceGetter).slices["foo/bar"] = []interface{}{sliceCatDog, newSlice}
+	again, err = c.get("foo/bar", config)
+	assert.Nil(t, err)
+	assert.NotEqual(t, reflect.ValueOf(subs).Pointer(), reflect.ValueOf(again).Pointer())
+	assert.Equal(t, subs, again)
+
+	subs, err = c.get("foo/baz", config)
+	assert.Nil(t, err)
+	assert.Nil(t, subs)
+}
+
+func TestSiblingsEventHandler(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	queue := workqueue.New()
+	defer queue.ShutDown()
+	splits := newTestSplitCache()
+	slices := splits.slices.(*sliceGetter).slices
+	svcs := splits.svcGetter.(*objGetter).objs
+	h := newSiblingsEventHandler(splits, config, queue)
+	drain := func() []string {
+		var keys []string
+		for queue.Len() > 0 {
+			key, _ := queue.Get()
+			keys = append(keys, key.(string))
+			queue.Done(key)
+		}
+		return keys
+	}
+	update := func(old, new *discoveryv1.EndpointSlice) {
+		objs := []interface{}{}
+		for _, o := range slices["foo/bar"] {
+			if o == old {
+				o = new
+			}
+			objs = append(objs, o)
+		}
+		slices["foo/bar"] = objs
+		h.OnUpdate(old, new)
+	}
+
+	h.(cache.ResourceEventHandlerFuncs).AddFunc(sliceDog)
+	assert.ElementsMatch(t, []string{"foo/bar-a", "foo/bar-b"}, drain())
+	h.(cache.ResourceEventHandlerFuncs).AddFunc(sliceCatDog)
+	assert.Empty(t, drain())
+
+	// Changes which don't affect the translations.
+	// The controller queues the EndpointSlice itself.
+	newSlice := sliceDog.DeepCopy()
+	newSlice.Labels["foo"] = "bar"
+	newSlice.Endpoints[0].Conditions.Serving = boolPtr(true)
+	newSlice.Endpoints[1].Conditions.Ready = boolPtr(true)
+	update(sliceDog, newSlice)
+	assert.Empty(t, drain())
+
+	// An endpoint became not ready.  Only the EndpointSlices
+	// whose endpoints gain or lose buckets are queued.
+	oldSlice := newSlice
+	newSlice = oldSlice.DeepCopy()
+	newSlice.Endpoints[1].Conditions.Ready = boolPtr(false)
+	update(oldSlice, newSlice)
+	assert.Contains(t, drain(), "foo/bar-b")
+
+	// A port which only the other EndpointSlice has was changed.
+	newCat := sliceCatDog.DeepCopy()
+	newCat.Ports[0].Port = int32Ptr(18001)
+	update(sliceCatDog, newCat)
+	assert.Equal(t, []string{"foo/bar-a"}, drain())
+
+	svc := svcCatDog.DeepCopy()
+	svc.Namespace = "foo"
+	svc.Name = "bar"
+	svcs["foo/bar"] = svc
+	h.OnUpdate(svcCatDog, svc)
+	assert.Empty(t, drain())
+	newSvc := svc.DeepCopy()
+	newSvc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "192.0.2.100"}}
+	svcs["foo/bar"] = newSvc
+	h.OnUpdate(svc, newSvc)
+	assert.Empty(t, drain())
+	svc = newSvc
+	newSvc = svc.DeepCopy()
+	newSvc.Spec.SessionAffinity = v1.ServiceAffinityClientIP
+	svcs["foo/bar"] = newSvc
+	h.OnUpdate(svc, newSvc)
+	assert.ElementsMatch(t, []string{"foo/bar-a", "foo/bar-b"}, drain())
+
+	delete(svcs, "foo/bar")
+	h.OnDelete(newSvc)
+	assert.ElementsMatch(t, []string{"foo/bar-a", "foo/bar-b"}, drain())
+}
+
+func TestSliceConverterPublishNotReadyAddresses(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := newTestSliceConverter()
+	svc := svcCatDog.DeepCopy()
+	svc.Spec.PublishNotReadyAddresses = true
+	c.splits.svcGetter.(*objGetter).objs["foo/bar"] = svc
+	key := converter.Key{
+		Kind:      "EndpointSlice",
+		Namespace: "foo",
+		Name:      "bar-b",
+	}
+	_, subs, err := c.Convert(key, sliceDog, config)
+	assert.Nil(t, err)
+	assert.Len(t, subKeys(subs, "Endpoints-Port", ""), 3)
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Endpoints-Port",
+		Name: "bar/dog/192.2.0.1/10.0.0.5/10200/TCP/bar-b",
+	})
+}
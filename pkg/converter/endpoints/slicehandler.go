@@ -0,0 +1,126 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package endpoints
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	discoveryv1 "github.com/midonet/midonet-kubernetes/pkg/apis/discovery/v1"
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+)
+
+// sortedKeys returns the sorted keys of the given sub resources.
+func sortedKeys(subs converter.SubResourceMap) []converter.Key {
+	keys := make([]converter.Key, 0, len(subs))
+	for k := range subs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Kind != keys[j].Kind {
+			return keys[i].Kind < keys[j].Kind
+		}
+		return keys[i].Name < keys[j].Name
+	})
+	return keys
+}
+
+// newSiblingsEventHandler creates an event handler which queues
+// the EndpointSlices of a Service whose translations are changed by
+// a change of the Service or one of its EndpointSlices.  The translation
+// of an EndpointSlice depends on the other EndpointSlices of the Service
+// because the traffic is split among all of their endpoints.
+// As the keys of the sub resources include their contents, only
+// the EndpointSlices with a different set of keys are queued.
+// Other changes of an EndpointSlice, e.g. its labels, only need
+// the EndpointSlice itself to be re-translated, which the controller
+// queues by itself.
+func newSiblingsEventHandler(splits *splitCache, config *converter.Config, queue workqueue.Interface) cache.ResourceEventHandler {
+	var mu sync.Mutex
+	// The keys of the sub resources of EndpointSlices when they
+	// were queued last time, by the Service and EndpointSlice names.
+	known := make(map[string]map[string][]converter.Key)
+	queueSiblings := func(obj interface{}) {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = d.Obj
+		}
+		var svcKey string
+		switch o := obj.(type) {
+		case *v1.Service:
+			k, err := cache.MetaNamespaceKeyFunc(o)
+			if err != nil {
+				return
+			}
+			svcKey = k
+		case *discoveryv1.EndpointSlice:
+			svcKey = serviceKey(o)
+		}
+		if svcKey == "" {
+			return
+		}
+		subs, err := splits.get(svcKey, config)
+		if err != nil {
+			log.WithError(err).WithField("service", svcKey).Error("Failed to translate EndpointSlices")
+			return
+		}
+		ns, _, err := cache.SplitMetaNamespaceKey(svcKey)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		old := known[svcKey]
+		cur := make(map[string][]converter.Key, len(subs))
+		for name, m := range subs {
+			cur[name] = sortedKeys(m)
+		}
+		add := func(name string) {
+			k := ns + "/" + name
+			log.WithField("key", k).Debug("Queueing for sibling changes")
+			queue.Add(k)
+		}
+		for name, keys := range cur {
+			if !reflect.DeepEqual(old[name], keys) {
+				add(name)
+			}
+		}
+		for name := range old {
+			if _, ok := cur[name]; !ok {
+				add(name)
+			}
+		}
+		if len(cur) == 0 {
+			delete(known, svcKey)
+		} else {
+			known[svcKey] = cur
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: queueSiblings,
+		UpdateFunc: func(old, new interface{}) {
+			// The EndpointSlice might have moved to another Service.
+			queueSiblings(old)
+			queueSiblings(new)
+		},
+		DeleteFunc: queueSiblings,
+	}
+}
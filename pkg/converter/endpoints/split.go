@@ -0,0 +1,553 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package endpoints
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+// trafficSplit describes a part of the traffic to a service port.
+// It matches one of either tpSrcs or srcNets.
+type trafficSplit struct {
+	// A string representation of the split.  Suitable to be used
+	// as a part of Keys.
+	name    string
+	tpSrcs  []midonet.PortRange
+	srcNets []*net.IPNet
+}
+
+// bucketsPerEndpoint is the minimum average number of buckets for
+// an endpoint.  See numBuckets.
+const bucketsPerEndpoint = 4
+
+// maxBuckets is the maximum number of buckets.  It's the largest power
+// of two which doesn't exceed the number of ports in any of portSegments
+// so that every bucket has some ports in each of them.
+const maxBuckets = 4096
+
+// numBuckets returns the number of buckets to split the traffic to
+// a service port with n endpoints into.
+// Each bucket is assigned to one of the endpoints with bucketOwners.
+// As the assignment is random, the more buckets, the more even the split
+// is.  However, each bucket of an endpoint needs its own ranges in its
+// jump rules unless it happens to be adjacent to another one.  With 4 to 8
+// buckets per endpoint, the deviation of the share of an endpoint is
+// typically around 40%.
+// We only change the number of buckets when n crosses a power of two,
+// because it changes the split of every bucket.
+// REVISIT: With more than maxBuckets endpoints, some of them don't get
+// any traffic.
+func numBuckets(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	p := 1
+	for p < n && bucketsPerEndpoint*p < maxBuckets {
+		p *= 2
+	}
+	return bucketsPerEndpoint * p
+}
+
+// endpointSeed returns the hash of the endpoint.  See bucketWeight.
+func endpointSeed(ep *endpoint) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%d", ep.ip, ep.port)
+	return h.Sum64()
+}
+
+// bucketWeight returns the weight of the endpoint with the given seed
+// for the bucket.  See bucketOwners.
+func bucketWeight(bucket int, seed uint64) uint64 {
+	// Mix them with the finalizer of MurmurHash3.
+	x := seed ^ uint64(bucket)*0x9e3779b97f4a7c15
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// bucketOwners assigns each of the buckets to one of the endpoints
+// and returns the indexes of the endpoints.
+// We use rendezvous hashing, i.e. a bucket is assigned to the endpoint
+// with the highest weight for the bucket.  Thus, when an endpoint is
+// removed, only its buckets are re-assigned to the other endpoints.
+// When an endpoint is added, it only takes some buckets from the others.
+// The other buckets are kept intact, and so are the jump rules of
+// the endpoints which neither gain nor lose buckets.
+func bucketOwners(eps []endpoint, buckets int) []int {
+	seeds := make([]uint64, len(eps))
+	for i := range eps {
+		seeds[i] = endpointSeed(&eps[i])
+	}
+	owners := make([]int, buckets)
+	for b := range owners {
+		var best uint64
+		for i, seed := range seeds {
+			w := bucketWeight(b, seed)
+			if i == 0 || w > best {
+				owners[b] = i
+				best = w
+			}
+		}
+	}
+	return owners
+}
+
+// splitTraffic splits the traffic to a service port among the given
+// endpoints and returns the part for each of them, in the same order.
+// The part is nil if the endpoint doesn't get any traffic.
+// If affinity is true, the traffic is split by source addresses of
+// the family of the service, taking the networks of the cluster into
+// account.  Otherwise, it's split by L4 source ports.
+func splitTraffic(eps []endpoint, affinity, ipv6 bool, clusterNets []*net.IPNet) []*trafficSplit {
+	buckets := numBuckets(len(eps))
+	owned := make([][]int, len(eps))
+	for b, i := range bucketOwners(eps, buckets) {
+		owned[i] = append(owned[i], b)
+	}
+	splits := make([]*trafficSplit, len(eps))
+	for i := range eps {
+		splits[i] = bucketSplit(owned[i], buckets, affinity, ipv6, clusterNets)
+	}
+	return splits
+}
+
+// bucketRun is a run of contiguous buckets, inclusive.
+type bucketRun struct {
+	first int
+	last  int
+}
+
+// bucketRuns returns the runs of the given sorted buckets.
+func bucketRuns(buckets []int) []bucketRun {
+	var runs []bucketRun
+	for _, b := range buckets {
+		if l := len(runs); l > 0 && runs[l-1].last+1 == b {
+			runs[l-1].last = b
+			continue
+		}
+		runs = append(runs, bucketRun{first: b, last: b})
+	}
+	return runs
+}
+
+// bucketSplit returns the part of the traffic to a service port in
+// the given sorted buckets, out of n.  See splitTraffic.
+// It returns nil if the part is empty.
+func bucketSplit(buckets []int, n int, affinity, ipv6 bool, clusterNets []*net.IPNet) *trafficSplit {
+	runs := bucketRuns(buckets)
+	var names []string
+	for _, r := range runs {
+		if r.first == r.last {
+			names = append(names, fmt.Sprintf("%d", r.first))
+		} else {
+			names = append(names, fmt.Sprintf("%d-%d", r.first, r.last))
+		}
+	}
+	// The buckets identify the split.
+	s := &trafficSplit{name: fmt.Sprintf("%s/%d", strings.Join(names, "."), n)}
+	switch {
+	case affinity && ipv6:
+		for _, r := range runs {
+			for _, blk := range r.blocks() {
+				s.srcNets = append(s.srcNets, nthIPv6Nets(blk.first>>blk.bits, n>>blk.bits, clusterNets)...)
+			}
+		}
+	case affinity:
+		var ranges []addressRange
+		for _, r := range runs {
+			ranges = append(ranges, spanAddressRanges(r.first, r.last, n, clusterNets)...)
+		}
+		for _, r := range mergeAddressRanges(ranges) {
+			s.srcNets = append(s.srcNets, r.cidrs()...)
+		}
+	default:
+		var ranges []midonet.PortRange
+		for _, r := range runs {
+			ranges = append(ranges, spanPortRanges(r.first, r.last, n)...)
+		}
+		s.tpSrcs = mergePortRanges(ranges)
+	}
+	if len(s.srcNets) == 0 && len(s.tpSrcs) == 0 {
+		// E.g. the endpoint has no buckets, or the cluster
+		// networks cover the whole part.
+		return nil
+	}
+	if affinity {
+		// The same buckets match different traffic with session
+		// affinity, and also depending on the cluster networks.
+		s.name = fmt.Sprintf("%s/ClientIP-%08x", s.name, netsDigest(s.srcNets))
+	}
+	return s
+}
+
+// netsDigest returns a short digest of the given networks.
+func netsDigest(nets []*net.IPNet) uint32 {
+	h := fnv.New32a()
+	for _, n := range nets {
+		fmt.Fprintf(h, "%s,", n)
+	}
+	return h.Sum32()
+}
+
+// bucketBlock is an aligned block of 2^bits buckets.
+type bucketBlock struct {
+	first int
+	bits  uint
+}
+
+// blocks returns the smallest list of aligned blocks which covers
+// the run.  Like addressRange.cidrs, it's necessary because we can
+// only split IPv6 addresses with prefixes.
+func (r bucketRun) blocks() []bucketBlock {
+	var blocks []bucketBlock
+	for b := r.first; b <= r.last; {
+		bits := uint(0)
+		for b%(2<<bits) == 0 && b+(2<<bits)-1 <= r.last {
+			bits++
+		}
+		blocks = append(blocks, bucketBlock{first: b, bits: bits})
+		b += 1 << bits
+	}
+	return blocks
+}
+
+// rules returns copies of the given rule, with conditions to match
+// the split.
+func (s *trafficSplit) rules(baseID uuid.UUID, rule *midonet.Rule) []converter.BackendResource {
+	var resources []converter.BackendResource
+	for i := range s.tpSrcs {
+		tpSrc := s.tpSrcs[i]
+		r := *rule
+		id := converter.SubID(baseID, fmt.Sprintf("%d-%d", tpSrc.Start, tpSrc.End))
+		r.ID = &id
+		r.TPSrc = &tpSrc
+		resources = append(resources, &r)
+	}
+	for _, n := range s.srcNets {
+		r := *rule
+		id := converter.SubID(baseID, n.String())
+		r.ID = &id
+		r.DLType = converter.EtherType(n.IP)
+		// Note: A zero-length prefix matches everything.
+		// We can't express it with NWSrcLength as it's omitempty.
+		ones, _ := n.Mask.Size()
+		if ones > 0 {
+			r.NWSrcAddress = n.IP.String()
+			r.NWSrcLength = ones
+		}
+		resources = append(resources, &r)
+	}
+	return resources
+}
+
+// portSegments are the segments of L4 source ports to split.
+// Clients usually pick source ports from an ephemeral port range,
+// which is much narrower than the whole range.  E.g. 32768-60999 on Linux
+// and 49152-65535 (the IANA suggestion) on most of the other OSes.
+// If we split the whole range into contiguous ranges, a few endpoints
+// would get all the traffic from such clients.  Instead, we split each
+// of these segments so that the traffic from either of the ephemeral
+// port ranges is evenly spread.
+// Note: We don't use port 0, partly because midonet.PortRange can't
+// represent it.
+var portSegments = []midonet.PortRange{
+	{Start: 1, End: 32767},
+	{Start: 32768, End: 49151},
+	{Start: 49152, End: 60999},
+	{Start: 61000, End: 65535},
+}
+
+// spanPortRanges splits each of portSegments into n ranges of roughly
+// equal sizes and returns the first-th to the last-th ones.  We use
+// the ranges to spread the traffic among endpoints of a service port.
+func spanPortRanges(first, last, n int) []midonet.PortRange {
+	var ranges []midonet.PortRange
+	for _, seg := range portSegments {
+		size := seg.End - seg.Start + 1
+		r := midonet.PortRange{
+			Start: seg.Start + first*size/n,
+			End:   seg.Start + (last+1)*size/n - 1,
+		}
+		if r.Start > r.End {
+			// Too many buckets for the segment.
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return mergePortRanges(ranges)
+}
+
+// mergePortRanges sorts the given ranges and merges adjacent ones.
+func mergePortRanges(ranges []midonet.PortRange) []midonet.PortRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start < ranges[j].Start
+	})
+	var merged []midonet.PortRange
+	for _, r := range ranges {
+		if l := len(merged); l > 0 && merged[l-1].End+1 == r.Start {
+			merged[l-1].End = r.End
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// addressRange is a range of IPv4 addresses, inclusive.
+type addressRange struct {
+	first uint32
+	last  uint32
+}
+
+// networkRange returns the range of an IPv4 network.
+func networkRange(n *net.IPNet) addressRange {
+	ip := n.IP.To4()
+	ones, _ := n.Mask.Size()
+	first := binary.BigEndian.Uint32(ip)
+	return addressRange{
+		first: first,
+		last:  first | uint32(uint64(1)<<uint(32-ones)-1),
+	}
+}
+
+// span splits the range into n ranges of roughly equal sizes and
+// returns the first-th to the last-th ones as a range.  It returns false
+// if the range is too small to have any of them.
+func (r addressRange) span(first, last, n int) (addressRange, bool) {
+	size := uint64(r.last) - uint64(r.first) + 1
+	start := uint64(first) * size / uint64(n)
+	end := uint64(last+1) * size / uint64(n)
+	if start == end {
+		return addressRange{}, false
+	}
+	return addressRange{
+		first: r.first + uint32(start),
+		last:  r.first + uint32(end-1),
+	}, true
+}
+
+// subtract returns the parts of the range which are not covered by
+// any of the given ranges.
+func (r addressRange) subtract(others []addressRange) []addressRange {
+	sorted := append([]addressRange(nil), others...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].first < sorted[j].first
+	})
+	var ranges []addressRange
+	next := uint64(r.first)
+	for _, o := range sorted {
+		if uint64(o.last) < next || o.first > r.last {
+			continue
+		}
+		if uint64(o.first) > next {
+			ranges = append(ranges, addressRange{
+				first: uint32(next),
+				last:  o.first - 1,
+			})
+		}
+		next = uint64(o.last) + 1
+	}
+	if next <= uint64(r.last) {
+		ranges = append(ranges, addressRange{
+			first: uint32(next),
+			last:  r.last,
+		})
+	}
+	return ranges
+}
+
+// spanAddressRanges splits the IPv4 address space into n parts of
+// roughly equal sizes and returns the first-th to the last-th ones.
+// We use the ranges to spread the traffic among endpoints of a service
+// port, when the service has ClientIP session affinity.
+// Most of the clients are usually Pods.  If we split the whole address
+// space into contiguous ranges, the cluster networks, e.g. 10.1.0.0/16,
+// would likely be in a single range, i.e. the traffic from every Pods
+// would reach the same endpoint.  Thus we split each of the cluster
+// networks and the rest of the address space separately.
+// REVISIT: The split is still coarse.  E.g. as the PodCIDR of a Node is
+// usually contiguous, Pods on a Node likely reach the same endpoint.
+func spanAddressRanges(first, last, n int, clusterNets []*net.IPNet) []addressRange {
+	var ranges []addressRange
+	var clusterRanges []addressRange
+	for _, cn := range clusterNets {
+		if cn.IP.To4() == nil {
+			continue
+		}
+		cr := networkRange(cn)
+		clusterRanges = append(clusterRanges, cr)
+		if r, ok := cr.span(first, last, n); ok {
+			ranges = append(ranges, r)
+		}
+	}
+	whole := addressRange{first: 0, last: 0xffffffff}
+	if r, ok := whole.span(first, last, n); ok {
+		ranges = append(ranges, r.subtract(clusterRanges)...)
+	}
+	return ranges
+}
+
+// mergeAddressRanges sorts the given ranges and merges adjacent ones.
+func mergeAddressRanges(ranges []addressRange) []addressRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].first < ranges[j].first
+	})
+	var merged []addressRange
+	for _, r := range ranges {
+		if l := len(merged); l > 0 && uint64(merged[l-1].last)+1 == uint64(r.first) {
+			merged[l-1].last = r.last
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func uint32ToIP(n uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
+
+func (r addressRange) bounds() (net.IP, net.IP) {
+	return uint32ToIP(r.first), uint32ToIP(r.last)
+}
+
+// cidrs returns the smallest list of CIDRs which covers the range.
+// It's necessary because MidoNet rules can only match addresses
+// with prefixes.
+func (r addressRange) cidrs() []*net.IPNet {
+	var nets []*net.IPNet
+	start := uint64(r.first)
+	end := uint64(r.last)
+	for start <= end {
+		// Find the largest block which is aligned to start and
+		// doesn't exceed end.
+		ones := 32
+		for ones > 0 {
+			size := uint64(1) << uint(32-ones+1)
+			if start%size != 0 || start+size-1 > end {
+				break
+			}
+			ones--
+		}
+		nets = append(nets, &net.IPNet{
+			IP:   uint32ToIP(uint32(start)),
+			Mask: net.CIDRMask(ones, 32),
+		})
+		start += uint64(1) << uint(32-ones)
+	}
+	return nets
+}
+
+// nthIPv6Nets is the IPv6 counterpart of spanAddressRanges, for a single
+// part.  As n is always a power of two (see numBuckets), the parts are
+// prefixes and we don't need to deal with arbitrary ranges of 128-bit
+// addresses.  See bucketRun.blocks.
+func nthIPv6Nets(i, n int, clusterNets []*net.IPNet) []*net.IPNet {
+	bits := 0
+	for 1<<uint(bits) < n {
+		bits++
+	}
+	var nets []*net.IPNet
+	var v6ClusterNets []*net.IPNet
+	for _, cn := range clusterNets {
+		if cn.IP.To4() != nil {
+			continue
+		}
+		v6ClusterNets = append(v6ClusterNets, cn)
+		if p, ok := nthPrefix(cn, i, bits); ok {
+			nets = append(nets, p)
+		}
+	}
+	whole := &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	if p, ok := nthPrefix(whole, i, bits); ok {
+		nets = append(nets, subtractNets(p, v6ClusterNets)...)
+	}
+	return nets
+}
+
+// nthPrefix splits the IPv6 network into 2^bits prefixes and returns
+// the i-th one.  Like addressRange.nth, it returns false if the network
+// is too small to have the i-th one.
+func nthPrefix(n *net.IPNet, i, bits int) (*net.IPNet, bool) {
+	ones, _ := n.Mask.Size()
+	if excess := ones + bits - 128; excess > 0 {
+		// Only every 2^excess-th part has an address.
+		if (i+1)&(1<<uint(excess)-1) != 0 {
+			return nil, false
+		}
+		i >>= uint(excess)
+		bits -= excess
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, n.IP.To16())
+	for b := 0; b < bits; b++ {
+		if i&(1<<uint(bits-1-b)) != 0 {
+			pos := ones + b
+			ip[pos/8] |= 0x80 >> uint(pos%8)
+		}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(ones+bits, 128)}, true
+}
+
+// containsNet returns true if the network a contains the network b.
+func containsNet(a, b *net.IPNet) bool {
+	aOnes, _ := a.Mask.Size()
+	bOnes, _ := b.Mask.Size()
+	return aOnes <= bOnes && a.Contains(b.IP)
+}
+
+// subtractNets returns the smallest list of prefixes which covers
+// the parts of the network not covered by any of the given ones.
+func subtractNets(n *net.IPNet, others []*net.IPNet) []*net.IPNet {
+	for _, o := range others {
+		if containsNet(o, n) {
+			return nil
+		}
+	}
+	for _, o := range others {
+		if containsNet(n, o) {
+			// Split into halves until they don't overlap.
+			lower, _ := nthPrefix(n, 0, 1)
+			upper, _ := nthPrefix(n, 1, 1)
+			return append(subtractNets(lower, others), subtractNets(upper, others)...)
+		}
+	}
+	return []*net.IPNet{n}
+}
+
+// lastIP returns the last address of the network.
+func lastIP(n *net.IPNet) net.IP {
+	ip := make(net.IP, len(n.IP))
+	for i := range ip {
+		ip[i] = n.IP[i] | ^n.Mask[i]
+	}
+	return ip
+}
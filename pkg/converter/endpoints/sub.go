@@ -17,10 +17,12 @@ package endpoints
 
 import (
 	"fmt"
+	"net"
 
 	"k8s.io/api/core/v1"
 
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/service"
 	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 )
 
@@ -31,6 +33,11 @@ type endpoint struct {
 	ip           string
 	port         int
 	protocol     v1.Protocol
+	nodeName     string
+
+	// slice is the name of the EndpointSlice this endpoint came from.
+	// Empty for Endpoints.
+	slice string
 }
 
 func (ep *endpoint) portKey() string {
@@ -39,41 +46,25 @@ func (ep *endpoint) portKey() string {
 	return fmt.Sprintf("%s/%s", ep.endpointsKey, ep.portName)
 }
 
+func (ep *endpoint) less(other *endpoint) bool {
+	if ep.ip != other.ip {
+		return ep.ip < other.ip
+	}
+	return ep.port < other.port
+}
+
 func (ep *endpoint) Convert(epKey converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
-	// REVISIT: An assumption here is that, if ServicePort.Name is empty,
-	// the corresponding EndpointPort.Name is also empty.  It isn't clear
-	// to me (yamamoto) from the documentation.
-	portKey := ep.portKey()
-	portChainID := converter.IDForKey("ServicePort", portKey, config)
 	baseID := converter.IDForKey("Endpoint", epKey.Key(), config)
 	epChainID := baseID
-	epJumpRuleID := converter.SubID(baseID, "Jump to Endpoint")
 	epDNATRuleID := converter.SubID(baseID, "DNAT")
 	epSNATRuleID := converter.SubID(baseID, "SNAT")
+	ip := net.ParseIP(ep.ip)
 	return []converter.BackendResource{
 		&midonet.Chain{
 			ID:       &epChainID,
 			Name:     fmt.Sprintf("KUBE-SEP-%s", epKey.Key()),
 			TenantID: config.Tenant,
 		},
-		// REVISIT: kube-proxy implements load-balancing with its
-		// equivalent of this rule, using iptables probabilistic
-		// match.  We can probably implement something similar
-		// here if the backend has the following functionalities.
-		//
-		//   1. probabilistic match
-		//   2. applyIfExists equivalent
-		//
-		// For now, we just install a normal 100% matching rule.
-		// It means that the endpoint which happens to have its
-		// jump rule the earliest in the chain handles 100% of
-		// traffic.
-		&midonet.Rule{
-			Parent:      midonet.Parent{ID: &portChainID},
-			ID:          &epJumpRuleID,
-			Type:        "jump",
-			JumpChainID: &epChainID,
-		},
 		&midonet.Rule{
 			Parent: midonet.Parent{ID: &epChainID},
 			ID:     &epDNATRuleID,
@@ -104,9 +95,9 @@ func (ep *endpoint) Convert(epKey converter.Key, config *converter.Config) ([]co
 			Parent:       midonet.Parent{ID: &epChainID},
 			ID:           &epSNATRuleID,
 			Type:         "snat",
-			DLType:       0x800,
+			DLType:       converter.EtherType(ip),
 			NWSrcAddress: ep.ip,
-			NWSrcLength:  32,
+			NWSrcLength:  converter.HostPrefixLength(ip),
 			NATTargets: &[]midonet.NATTarget{
 				{
 					AddressFrom: ep.svcIP,
@@ -120,3 +111,87 @@ func (ep *endpoint) Convert(epKey converter.Key, config *converter.Config) ([]co
 		},
 	}, nil
 }
+
+// endpointJump is a sub resource to represent jump rules from
+// the service port chain to an endpoint chain.
+type endpointJump struct {
+	portKey string
+	epKey   converter.Key
+	split   trafficSplit
+}
+
+func (j *endpointJump) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	// REVISIT: An assumption here is that, if ServicePort.Name is empty,
+	// the corresponding EndpointPort.Name is also empty.  It isn't clear
+	// to me (yamamoto) from the documentation.
+	portChainID := converter.IDForKey("ServicePort", j.portKey, config)
+	epChainID := converter.IDForKey("Endpoint", j.epKey.Key(), config)
+	baseID := converter.IDForKey("EndpointJump", key.Key(), config)
+	// kube-proxy implements load-balancing with its equivalent
+	// of these rules, using iptables probabilistic match.
+	// As MidoNet doesn't have probabilistic match, we split
+	// the traffic deterministically with L4 source port ranges,
+	// or source address ranges.  See split.go.
+	return j.split.rules(baseID, &midonet.Rule{
+		Parent:      midonet.Parent{ID: &portChainID},
+		Type:        "jump",
+		JumpChainID: &epChainID,
+	}), nil
+}
+
+// endpointLocal is a sub resource to represent the chain for an endpoint
+// in the chain for the endpoints local to a Node.  It's used for Services
+// with externalTrafficPolicy=Local.
+// Unlike the endpoint chain, we don't SNAT here so that the endpoint
+// can see the client address.
+type endpointLocal struct {
+	ep endpoint
+}
+
+func (l *endpointLocal) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	baseID := converter.IDForKey("EndpointLocal", key.Key(), config)
+	chainID := baseID
+	dnatRuleID := converter.SubID(baseID, "DNAT")
+	return []converter.BackendResource{
+		&midonet.Chain{
+			ID:       &chainID,
+			Name:     fmt.Sprintf("KUBE-XLB-SEP-%s", key.Key()),
+			TenantID: config.Tenant,
+		},
+		&midonet.Rule{
+			Parent: midonet.Parent{ID: &chainID},
+			ID:     &dnatRuleID,
+			Type:   "dnat",
+			NATTargets: &[]midonet.NATTarget{
+				{
+					AddressFrom: l.ep.ip,
+					AddressTo:   l.ep.ip,
+					PortFrom:    l.ep.port,
+					PortTo:      l.ep.port,
+				},
+			},
+			FlowAction: "accept",
+		},
+	}, nil
+}
+
+// endpointLocalJump is a sub resource to represent jump rules from
+// the chain for the endpoints local to a Node to the chain for
+// an endpoint.  See endpointJump.
+type endpointLocalJump struct {
+	portKey  string
+	nodeName string
+	localKey converter.Key
+	split    trafficSplit
+}
+
+func (j *endpointLocalJump) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	chainID := service.LocalEndpointsChainID(j.portKey, j.nodeName, config)
+	localChainID := converter.IDForKey("EndpointLocal", j.localKey.Key(), config)
+	baseID := converter.IDForKey("EndpointLocalJump", key.Key(), config)
+	return j.split.rules(baseID, &midonet.Rule{
+		Parent:      midonet.Parent{ID: &chainID},
+		Type:        "jump",
+		JumpChainID: &localChainID,
+	}), nil
+}
@@ -16,6 +16,8 @@
 package converter
 
 import (
+	"net"
+
 	"github.com/google/uuid"
 
 	mncli "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned"
@@ -39,6 +41,22 @@ func ServicesChainID(config *Config) uuid.UUID {
 	return SubID(baseID, "Services Chain")
 }
 
+// HostPortsChainID is the ID of MidoNet Chain which contains the Rules
+// to dispatch the traffic to the addresses of each Nodes to the Chain
+// for hostPorts on the Node.
+func HostPortsChainID(config *Config) uuid.UUID {
+	baseID := MainChainID(config)
+	return SubID(baseID, "Host Ports Chain")
+}
+
+// EgressIPGroupID is the ID of MidoNet IP Address Group which contains
+// the addresses of Pods whose traffic is SNATed to egress IPs of
+// their Namespaces.
+func EgressIPGroupID(config *Config) uuid.UUID {
+	baseID := MainChainID(config)
+	return SubID(baseID, "Egress IP Group")
+}
+
 // MainChainID is the ID of MidoNet Chain which contains the Rules
 // to dispatch to other global Chains including ServicesChainID.
 func MainChainID(config *Config) uuid.UUID {
@@ -51,6 +69,31 @@ func ClusterRouterID(config *Config) uuid.UUID {
 	return SubID(baseID, "Cluster Router")
 }
 
+// The weights of the routes on the cluster router for the egress traffic
+// of Pods.  See EgressRouteDestinations.  An egress IP route for a Pod
+// takes precedence over the egress SNAT route for the PodCIDR of its Node
+// because it has a smaller weight.
+const (
+	EgressIPRouteWeight   = 0
+	EgressSNATRouteWeight = EgressIPRouteWeight + 1
+)
+
+// EgressRouteDestinations returns the destinations of the routes on
+// the cluster router for the egress traffic of Pods, which is not routed
+// by more specific routes.
+// MidoNet uses the routes with the longest destination prefix and, among
+// them, the ones with the smallest weight.  It doesn't prefer a longer
+// source prefix.  The destinations are the two halves of the IPv4 address
+// space, rather than 0.0.0.0/0, so that these routes take precedence over
+// the default route of the cluster router, if any, regardless of its
+// weight.
+func EgressRouteDestinations() []net.IPNet {
+	return []net.IPNet{
+		{IP: net.IPv4(0, 0, 0, 0).To4(), Mask: net.CIDRMask(1, 32)},
+		{IP: net.IPv4(128, 0, 0, 0).To4(), Mask: net.CIDRMask(1, 32)},
+	}
+}
+
 // DefaultTunnelZoneID is the ID of the default MidoNet Tunnel Zone for
 // this deployment.
 func DefaultTunnelZoneID(config *Config) uuid.UUID {
@@ -64,10 +107,13 @@ func globalResources(config *Config) map[Key]([]BackendResource) {
 	mainChainID := baseID
 	clusterRouterID := ClusterRouterID(config)
 	tunnelZoneID := DefaultTunnelZoneID(config)
+	egressIPGroupID := EgressIPGroupID(config)
 	preChainID := SubID(baseID, "Pre Chain")
 	servicesChainID := ServicesChainID(config)
+	hostPortsChainID := HostPortsChainID(config)
 	jumpToPreRuleID := SubID(baseID, "Jump To Pre")
 	jumpToServicesRuleID := SubID(baseID, "Jump To Services")
+	jumpToHostPortsRuleID := SubID(baseID, "Jump To Host Ports")
 	revSNATRuleID := SubID(baseID, "Reverse SNAT")
 	revDNATRuleID := SubID(baseID, "Reverse DNAT")
 	return map[Key]([]BackendResource){
@@ -85,6 +131,12 @@ func globalResources(config *Config) map[Key]([]BackendResource) {
 				TenantID: tenant,
 			},
 		},
+		{Kind: midonetGlobalKind, Name: "egress-ip"}: []BackendResource{
+			&midonet.IPAddrGroup{
+				ID:   &egressIPGroupID,
+				Name: "KUBE-EGRESSIP",
+			},
+		},
 		// Chains shared among Bridges for Nodes
 		{Kind: midonetGlobalKind, Name: mainChainName}: []BackendResource{
 			&midonet.Chain{
@@ -117,6 +169,14 @@ func globalResources(config *Config) map[Key]([]BackendResource) {
 				Type:       "rev_snat",
 				FlowAction: "continue",
 			},
+			// Added later than the above.  Keep them at the end
+			// so that the existing Translation is only extended.
+			&midonet.Chain{
+				ID:       &hostPortsChainID,
+				Name:     "KUBE-HOSTPORTS",
+				TenantID: tenant,
+			},
+			midonet.JumpRule(&jumpToHostPortsRuleID, &mainChainID, &hostPortsChainID),
 		},
 	}
 }
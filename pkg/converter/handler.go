@@ -96,6 +96,9 @@ func (h *converterHandler) Update(strKey string, gvk schema.GroupVersionKind, ob
 		return err
 	}
 	err = h.updater.Update(gvk, obj, converted)
+	if _, ok := err.(*controller.RequeueAfterError); ok {
+		return err
+	}
 	if err != nil {
 		clog.WithError(err).Error("Failed to update")
 		return err
@@ -55,6 +55,37 @@ func IDForKey(kind string, key string, config *Config) uuid.UUID {
 	return idForString(kubernetesSpaceUUID, fmt.Sprintf("%s/%s", kind, key))
 }
 
+// NodeEgressChainID is the ID of MidoNet Chain which dispatches
+// the traffic leaving the Bridge for the Node to the egress Chains
+// of Pods.
+func NodeEgressChainID(nodeName string, config *Config) uuid.UUID {
+	return SubID(IDForKey("Node", nodeName, config), "Egress Chain")
+}
+
+// NodeHostPortsChainID is the ID of MidoNet Chain which contains
+// the Rules for hostPorts of Pods on the Node.
+func NodeHostPortsChainID(nodeName string, config *Config) uuid.UUID {
+	return SubID(IDForKey("Node", nodeName, config), "Host Ports Chain")
+}
+
+// NodePortChainID is the ID of MidoNet Chain which is the outbound
+// filter of the Bridge Port for the Node connectivity.
+func NodePortChainID(nodeName string, config *Config) uuid.UUID {
+	return SubID(IDForKey("Node", nodeName, config), "Node Port Chain")
+}
+
+// NodePortID is the ID of MidoNet Bridge Port for the Node connectivity.
+// It's bound to the interface on the host.
+func NodePortID(nodeName string, config *Config) uuid.UUID {
+	return SubID(IDForKey("Node", nodeName, config), "Node Port")
+}
+
+// NodeRouterPortID is the ID of MidoNet Router Port on the cluster
+// router for the Node.
+func NodeRouterPortID(nodeName string, config *Config) uuid.UUID {
+	return SubID(IDForKey("Node", nodeName, config), "Router Port")
+}
+
 // SubID deterministically generates another MidoNet UUID for the resource
 // identified by the given UUID.  It's used e.g. when more than two MidoNet
 // resources (thus UUIDs) are necessary for a Kubernetes resource.
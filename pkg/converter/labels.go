@@ -26,4 +26,13 @@ const (
 	// That is, Translations which doesn't belong to a particular
 	// Kubernetes resource.  (See global.go)
 	GlobalLabel = "midonet.org/global"
+
+	// EgressGatewayLabel, when set to "true", marks the Node as
+	// a candidate to host egress IPs of Namespaces.
+	EgressGatewayLabel = "midonet.org/egress-gateway"
+
+	// DrainableLabel annotates that the Translation is kept for
+	// a while after it became stale, to drain existing connections.
+	// See NewDrainingTranslationUpdater.
+	DrainableLabel = "midonet.org/drainable"
 )
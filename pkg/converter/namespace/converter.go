@@ -0,0 +1,212 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package namespace
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/node"
+)
+
+// podIndexer is the subset of cache.Indexer the converter uses
+// to find Pods in a namespace.
+type podIndexer interface {
+	ByIndex(indexName, indexedValue string) ([]interface{}, error)
+}
+
+// lister is the subset of cache.Store the converter uses to list
+// Nodes.
+type lister interface {
+	List() []interface{}
+}
+
+type namespaceConverter struct {
+	podIndexer podIndexer
+	nodeLister lister
+}
+
+func newNamespaceConverter(podInformer, nodeInformer cache.SharedIndexInformer) converter.Converter {
+	return &namespaceConverter{
+		podIndexer: podInformer.GetIndexer(),
+		nodeLister: nodeInformer.GetIndexer(),
+	}
+}
+
+// translatablePod returns true if the Pod has the port created by
+// the pod converter.
+func translatablePod(p *v1.Pod) bool {
+	if p.Spec.NodeName == "" || p.Spec.HostNetwork {
+		return false
+	}
+	return p.Status.Phase != v1.PodSucceeded && p.Status.Phase != v1.PodFailed
+}
+
+// usableNode returns true if the Node can host egress IPs.
+func usableNode(n *v1.Node) bool {
+	if n.DeletionTimestamp != nil || n.Spec.PodCIDR == "" {
+		return false
+	}
+	if _, ok := n.Annotations[converter.HostIDAnnotation]; !ok {
+		// The node controller hasn't set up the Node yet.
+		return false
+	}
+	for _, c := range n.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// hostingNode returns the Node to host the egress IP, or nil if
+// there's none.  The preferred Node is used if it's usable.
+// Otherwise, the first usable Node with EgressGatewayLabel in the
+// order of names is used.  It's deterministic so that every
+// conversion agrees with the choice.
+func (c *namespaceConverter) hostingNode(preferred string) *v1.Node {
+	var candidates []*v1.Node
+	for _, obj := range c.nodeLister.List() {
+		n := obj.(*v1.Node)
+		if !usableNode(n) {
+			continue
+		}
+		if n.Name == preferred {
+			return n
+		}
+		if n.Labels[converter.EgressGatewayLabel] == "true" {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates[0]
+}
+
+// podIPs returns the sorted IPv4 addresses of translatable Pods in
+// the namespace.
+func (c *namespaceConverter) podIPs(namespace string) ([]net.IP, error) {
+	objs, err := c.podIndexer.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, obj := range objs {
+		p := obj.(*v1.Pod)
+		if !translatablePod(p) {
+			continue
+		}
+		ip := net.ParseIP(p.Status.PodIP)
+		if ip == nil || ip.To4() == nil {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return ips[i].String() < ips[j].String()
+	})
+	return ips, nil
+}
+
+// egressIPKey returns the key of the egressIP sub resource.
+// As MidoNet Rules are not updateable, it includes everything
+// the Rules depend on.
+func egressIPKey(key converter.Key, ip net.IP, nodeName string, nodeIP net.IP, excludes []string) converter.Key {
+	h := sha1.Sum([]byte(strings.Join(excludes, ",")))
+	return converter.Key{
+		Kind: "Namespace-EgressIP",
+		Name: fmt.Sprintf("%s/egress-ip/%s/%s/%s/%s", key.Name, ip, nodeName, nodeIP, hex.EncodeToString(h[:])[:10]),
+	}
+}
+
+func (c *namespaceConverter) Convert(key converter.Key, obj interface{}, config *converter.Config) ([]converter.BackendResource, converter.SubResourceMap, error) {
+	ns := obj.(*v1.Namespace)
+	ipStr, ok := ns.Annotations[converter.EgressIPAnnotation]
+	if !ok {
+		return nil, nil, nil
+	}
+	clog := log.WithField("namespace", key.Name)
+	ip := net.ParseIP(ipStr)
+	if ip == nil || ip.To4() == nil {
+		// Drop the error as it isn't retriable.
+		// (until the Namespace is updated again)
+		clog.WithField("ip", ipStr).Warn("Invalid egress IP")
+		return nil, nil, nil
+	}
+	subs := make(converter.SubResourceMap)
+	groupKey := converter.Key{
+		Kind: "Namespace-EgressIPGroup",
+		Name: key.Name,
+	}
+	subs[groupKey] = &egressIPGroup{namespace: key.Name}
+	n := c.hostingNode(ns.Annotations[converter.EgressNodeAnnotation])
+	if n == nil {
+		clog.Warn("No Node available to host the egress IP")
+		return nil, subs, nil
+	}
+	si, err := node.GetSubnetInfo(n.Spec.PodCIDR)
+	if err != nil {
+		clog.WithError(err).WithField("node", n.Name).Warn("Failed to parse PodCIDR")
+		return nil, subs, nil
+	}
+	nodeIP := si.NodeIP.IP
+	excludes := node.EgressSNATExcludes(n.Name, n.Status.Addresses, config)
+	subs[egressIPKey(key, ip, n.Name, nodeIP, excludes)] = &egressIP{
+		namespace:       key.Name,
+		nodePortChainID: converter.NodePortChainID(n.Name, config),
+		routerPortID:    converter.NodeRouterPortID(n.Name, config),
+		nodeIP:          nodeIP,
+		ip:              ip,
+		excludes:        excludes,
+	}
+	ips, err := c.podIPs(key.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, podIP := range ips {
+		k := converter.Key{
+			Kind: "Namespace-EgressIPAddr",
+			Name: fmt.Sprintf("%s/%s", key.Name, podIP),
+		}
+		subs[k] = &egressIPAddr{
+			namespace: key.Name,
+			ip:        podIP,
+		}
+		k = converter.Key{
+			Kind: "Namespace-EgressIPRoute",
+			Name: fmt.Sprintf("%s/%s/%s/%s", key.Name, podIP, n.Name, nodeIP),
+		}
+		subs[k] = &egressIPRoute{
+			routerPortID: converter.NodeRouterPortID(n.Name, config),
+			podIP:        podIP,
+			nodeIP:       nodeIP,
+		}
+	}
+	return nil, subs, nil
+}
@@ -0,0 +1,251 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package namespace
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+func newNode(name, podCIDR string, ready bool, labels map[string]string) *v1.Node {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+			Annotations: map[string]string{
+				converter.HostIDAnnotation: "3d5ec4e8-8dc4-4fd2-9d46-e2b3e5ad0b8e",
+			},
+		},
+		Spec: v1.NodeSpec{
+			PodCIDR: podCIDR,
+		},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "192.168.0." + name[len(name)-1:]},
+			},
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: status},
+			},
+		},
+	}
+}
+
+func newPod(ns, name, ip string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+		},
+		Spec: v1.PodSpec{
+			NodeName: "node3",
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			PodIP: ip,
+		},
+	}
+}
+
+var (
+	gateway = map[string]string{converter.EgressGatewayLabel: "true"}
+
+	nsFoo = &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+			Annotations: map[string]string{
+				converter.EgressIPAnnotation:   "192.0.2.10",
+				converter.EgressNodeAnnotation: "node1",
+			},
+		},
+	}
+)
+
+type podGetter struct {
+	pods map[string][]interface{}
+}
+
+func (g *podGetter) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	return g.pods[indexedValue], nil
+}
+
+type nodeLister struct {
+	nodes []interface{}
+}
+
+func (l *nodeLister) List() []interface{} {
+	return l.nodes
+}
+
+func newTestConverter(nodes ...*v1.Node) *namespaceConverter {
+	lister := &nodeLister{}
+	for _, n := range nodes {
+		lister.nodes = append(lister.nodes, n)
+	}
+	return &namespaceConverter{
+		podIndexer: &podGetter{
+			pods: map[string][]interface{}{
+				"foo": {
+					newPod("foo", "web", "10.1.3.10"),
+					newPod("foo", "db", "10.1.3.11"),
+					&v1.Pod{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "host"},
+						Spec:       v1.PodSpec{NodeName: "node3", HostNetwork: true},
+						Status:     v1.PodStatus{Phase: v1.PodRunning, PodIP: "192.168.0.3"},
+					},
+				},
+			},
+		},
+		nodeLister: lister,
+	}
+}
+
+func subKeys(subs converter.SubResourceMap, kind string) []converter.Key {
+	var keys []converter.Key
+	for k := range subs {
+		if k.Kind == kind {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func TestConverterNoEgressIP(t *testing.T) {
+	c := newTestConverter(newNode("node1", "10.1.1.0/24", true, nil))
+	ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "bar"}}
+	rs, subs, err := c.Convert(converter.Key{Kind: "Namespace", Name: "bar"}, ns, &converter.Config{})
+	assert.Nil(t, err)
+	assert.Len(t, rs, 0)
+	assert.Len(t, subs, 0)
+
+	ns.Annotations = map[string]string{converter.EgressIPAnnotation: "foo"}
+	rs, subs, err = c.Convert(converter.Key{Kind: "Namespace", Name: "bar"}, ns, &converter.Config{})
+	assert.Nil(t, err)
+	assert.Len(t, rs, 0)
+	assert.Len(t, subs, 0)
+}
+
+func TestConverter(t *testing.T) {
+	key := converter.Key{Kind: "Namespace", Name: "foo"}
+	config := &converter.Config{
+		Tenant:      "tenant",
+		ClusterCIDR: []string{"10.1.0.0/16"},
+	}
+	c := newTestConverter(
+		newNode("node1", "10.1.1.0/24", true, nil),
+		newNode("node2", "10.1.2.0/24", true, gateway),
+	)
+	rs, subs, err := c.Convert(key, nsFoo, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 0)
+	// group, egress IP, 2 addrs, 2 routes
+	assert.Len(t, subs, 6)
+	assert.Contains(t, subs, converter.Key{Kind: "Namespace-EgressIPGroup", Name: "foo"})
+	keys := subKeys(subs, "Namespace-EgressIP")
+	assert.Len(t, keys, 1)
+	assert.Contains(t, keys[0].Name, "foo/egress-ip/192.0.2.10/node1/10.1.1.2/")
+
+	srs, err := subs[keys[0]].Convert(keys[0], config)
+	assert.Nil(t, err)
+	// chain, 2 returns, SNAT, jump, route
+	assert.Len(t, srs, 6)
+	chainID := *srs[0].(*midonet.Chain).ID
+	assert.Equal(t, "10.1.0.0", srs[1].(*midonet.Rule).NWDstAddress)
+	assert.Equal(t, 1, srs[1].(*midonet.Rule).Position)
+	assert.Equal(t, "192.168.0.1", srs[2].(*midonet.Rule).NWDstAddress)
+	assert.Equal(t, 2, srs[2].(*midonet.Rule).Position)
+	snat := srs[3].(*midonet.Rule)
+	assert.Equal(t, "snat", snat.Type)
+	assert.Equal(t, 3, snat.Position)
+	assert.Equal(t, &chainID, snat.Parent.ID)
+	fooGroupID := groupID("foo", config)
+	assert.Equal(t, &fooGroupID, snat.IPAddrGroupSrc)
+	assert.True(t, snat.MatchForwardFlow)
+	assert.Equal(t, "192.0.2.10", (*snat.NATTargets)[0].AddressFrom)
+	jump := srs[4].(*midonet.Rule)
+	nodePortChainID := converter.NodePortChainID("node1", config)
+	assert.Equal(t, &nodePortChainID, jump.Parent.ID)
+	assert.Equal(t, &chainID, jump.JumpChainID)
+	route := srs[5].(*midonet.Route)
+	assert.Equal(t, "192.0.2.10", route.DstNetworkAddr.String())
+	assert.Equal(t, 32, route.DstNetworkLength)
+	routerPortID := converter.NodeRouterPortID("node1", config)
+	assert.Equal(t, &routerPortID, route.NextHopPort)
+	assert.Equal(t, "10.1.1.2", route.NextHopGateway.String())
+
+	addrKey := converter.Key{Kind: "Namespace-EgressIPAddr", Name: "foo/10.1.3.10"}
+	assert.Contains(t, subs, addrKey)
+	srs, err = subs[addrKey].Convert(addrKey, config)
+	assert.Nil(t, err)
+	assert.Len(t, srs, 2)
+	globalGroupID := converter.EgressIPGroupID(config)
+	assert.Equal(t, &fooGroupID, srs[0].(*midonet.IPAddrGroupAddr).Parent.ID)
+	assert.Equal(t, &globalGroupID, srs[1].(*midonet.IPAddrGroupAddr).Parent.ID)
+
+	routeKey := converter.Key{Kind: "Namespace-EgressIPRoute", Name: "foo/10.1.3.10/node1/10.1.1.2"}
+	assert.Contains(t, subs, routeKey)
+	srs, err = subs[routeKey].Convert(routeKey, config)
+	assert.Nil(t, err)
+	assert.Len(t, srs, 2)
+	var dsts []string
+	for _, r := range srs {
+		route := r.(*midonet.Route)
+		assert.Equal(t, &routerPortID, route.NextHopPort)
+		assert.Equal(t, "10.1.3.10", route.SrcNetworkAddr.String())
+		assert.Equal(t, 32, route.SrcNetworkLength)
+		assert.Equal(t, "10.1.1.2", route.NextHopGateway.String())
+		assert.Equal(t, converter.EgressIPRouteWeight, route.Weight)
+		dsts = append(dsts, fmt.Sprintf("%s/%d", route.DstNetworkAddr, route.DstNetworkLength))
+	}
+	assert.Equal(t, []string{"0.0.0.0/1", "128.0.0.0/1"}, dsts)
+}
+
+func TestConverterFailover(t *testing.T) {
+	key := converter.Key{Kind: "Namespace", Name: "foo"}
+	config := &converter.Config{Tenant: "tenant"}
+	c := newTestConverter(
+		newNode("node1", "10.1.1.0/24", false, gateway),
+		newNode("node4", "10.1.4.0/24", true, gateway),
+		newNode("node2", "10.1.2.0/24", true, gateway),
+		newNode("node3", "10.1.3.0/24", true, nil),
+	)
+	_, subs, err := c.Convert(key, nsFoo, config)
+	assert.Nil(t, err)
+	keys := subKeys(subs, "Namespace-EgressIP")
+	assert.Len(t, keys, 1)
+	assert.Contains(t, keys[0].Name, "foo/egress-ip/192.0.2.10/node2/10.1.2.2/")
+	assert.Contains(t, subs, converter.Key{Kind: "Namespace-EgressIPRoute", Name: "foo/10.1.3.11/node2/10.1.2.2"})
+
+	// No Node to host the egress IP.
+	c = newTestConverter(
+		newNode("node1", "10.1.1.0/24", false, gateway),
+		newNode("node3", "10.1.3.0/24", true, nil),
+	)
+	_, subs, err = c.Convert(key, nsFoo, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 1)
+	assert.Contains(t, subs, converter.Key{Kind: "Namespace-EgressIPGroup", Name: "foo"})
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package namespace
+
+import (
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+)
+
+// hasEgressIP returns true if the Namespace has an egress IP.
+func hasEgressIP(nsGetter cache.KeyGetter, key string) bool {
+	obj, exists, err := nsGetter.GetByKey(key)
+	if err != nil || !exists {
+		return false
+	}
+	_, ok := obj.(*v1.Namespace).Annotations[converter.EgressIPAnnotation]
+	return ok
+}
+
+// newPodEventHandler creates an event handler which queues the Namespace
+// of a Pod when the Pod might join or leave the IPAddrGroup for
+// the Namespace.
+func newPodEventHandler(nsGetter cache.KeyGetter, queue workqueue.Interface) cache.ResourceEventHandler {
+	queueNamespace := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		p, ok := obj.(*v1.Pod)
+		if !ok || !hasEgressIP(nsGetter, p.Namespace) {
+			return
+		}
+		log.WithField("namespace", p.Namespace).Debug("Queueing for Pod changes")
+		queue.Add(p.Namespace)
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: queueNamespace,
+		UpdateFunc: func(old, new interface{}) {
+			// Ignore Pod updates which don't change what we use.
+			// They happen often.
+			oldPod := old.(*v1.Pod)
+			newPod := new.(*v1.Pod)
+			if oldPod.Status.PodIP == newPod.Status.PodIP &&
+				translatablePod(oldPod) == translatablePod(newPod) {
+				return
+			}
+			queueNamespace(new)
+		},
+		DeleteFunc: queueNamespace,
+	}
+}
+
+// newNodeEventHandler creates an event handler which queues Namespaces
+// with egress IPs when the choice of the hosting Node might have been
+// changed.
+func newNodeEventHandler(nsLister cache.KeyListerGetter, queue workqueue.Interface) cache.ResourceEventHandler {
+	queueEgressIPNamespaces := func() {
+		for _, k := range nsLister.ListKeys() {
+			if !hasEgressIP(nsLister, k) {
+				continue
+			}
+			log.WithField("key", k).Debug("Queueing for Node changes")
+			queue.Add(k)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			queueEgressIPNamespaces()
+		},
+		UpdateFunc: func(old, new interface{}) {
+			// Ignore Node status updates which don't change
+			// what we use.  They happen periodically.
+			oldNode := old.(*v1.Node)
+			newNode := new.(*v1.Node)
+			if usableNode(oldNode) == usableNode(newNode) &&
+				reflect.DeepEqual(oldNode.Labels, newNode.Labels) &&
+				reflect.DeepEqual(oldNode.Status.Addresses, newNode.Status.Addresses) {
+				return
+			}
+			queueEgressIPNamespaces()
+		},
+		DeleteFunc: func(obj interface{}) {
+			queueEgressIPNamespaces()
+		},
+	}
+}
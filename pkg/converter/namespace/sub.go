@@ -0,0 +1,183 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package namespace
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+// groupID returns the ID of the IPAddrGroup for the Pods in
+// the Namespace.
+func groupID(namespace string, config *converter.Config) uuid.UUID {
+	return converter.IDForKey("Namespace Egress IP Group", namespace, config)
+}
+
+// egressIPGroup is a sub resource to represent the IPAddrGroup for
+// the Pods in the Namespace.
+type egressIPGroup struct {
+	namespace string
+}
+
+func (g *egressIPGroup) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	id := groupID(g.namespace, config)
+	return []converter.BackendResource{
+		&midonet.IPAddrGroup{
+			ID:   &id,
+			Name: fmt.Sprintf("KUBE-EGRESSIP-%s", g.namespace),
+		},
+	}, nil
+}
+
+// egressIPAddr is a sub resource to represent the address of a Pod in
+// the IPAddrGroup for the Namespace and the global IPAddrGroup.
+type egressIPAddr struct {
+	namespace string
+	ip        net.IP
+}
+
+func (a *egressIPAddr) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	id := groupID(a.namespace, config)
+	globalID := converter.EgressIPGroupID(config)
+	return []converter.BackendResource{
+		midonet.NewIPAddrGroupAddr(&id, a.ip),
+		midonet.NewIPAddrGroupAddr(&globalID, a.ip),
+	}, nil
+}
+
+// egressIP is a sub resource to represent the rules to SNAT
+// the traffic from the Pods in the Namespace to the egress IP
+// on the hosting Node, and a route to forward the traffic to
+// the egress IP to the hosting Node.
+type egressIP struct {
+	namespace       string
+	nodePortChainID uuid.UUID
+	routerPortID    uuid.UUID
+	nodeIP          net.IP
+	ip              net.IP
+	excludes        []string
+}
+
+func (e *egressIP) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	baseID := converter.IDForKey("Namespace Egress IP", key.Key(), config)
+	chainID := baseID
+	jumpRuleID := converter.SubID(baseID, "Jump")
+	snatRuleID := converter.SubID(baseID, "SNAT")
+	routeID := converter.SubID(baseID, "Route")
+	routerID := converter.ClusterRouterID(config)
+	groupID := groupID(e.namespace, config)
+	res := []converter.BackendResource{
+		&midonet.Chain{
+			ID:       &chainID,
+			Name:     fmt.Sprintf("KUBE-EGRESSIP-%s", key.Key()),
+			TenantID: config.Tenant,
+		},
+	}
+	// The rules have explicit positions so that the return rules
+	// precede the SNAT rule.
+	for i, cidr := range e.excludes {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		length, _ := n.Mask.Size()
+		ruleID := converter.SubID(baseID, cidr)
+		res = append(res, &midonet.Rule{
+			Parent:       midonet.Parent{ID: &chainID},
+			ID:           &ruleID,
+			Type:         "return",
+			DLType:       converter.EtherTypeIPv4,
+			NWDstAddress: n.IP.String(),
+			NWDstLength:  length,
+			Position:     i + 1,
+		})
+	}
+	res = append(res, &midonet.Rule{
+		Parent:           midonet.Parent{ID: &chainID},
+		ID:               &snatRuleID,
+		Type:             "snat",
+		DLType:           converter.EtherTypeIPv4,
+		IPAddrGroupSrc:   &groupID,
+		MatchForwardFlow: true,
+		NATTargets: &[]midonet.NATTarget{
+			{
+				AddressFrom: e.ip.String(),
+				AddressTo:   e.ip.String(),
+				// REVISIT: arbitrary port range
+				PortFrom: 30000,
+				PortTo:   60000,
+			},
+		},
+		FlowAction: "continue",
+		Position:   len(e.excludes) + 1,
+	})
+	res = append(res,
+		midonet.JumpRule(&jumpRuleID, &e.nodePortChainID, &chainID),
+		// The return traffic might enter MidoNet on a Node other
+		// than the hosting one, e.g. just after a failover.
+		// Forward it to the hosting Node, whose Bridge reverses
+		// the SNAT.
+		&midonet.Route{
+			Parent:           midonet.Parent{ID: &routerID},
+			ID:               &routeID,
+			DstNetworkAddr:   e.ip,
+			DstNetworkLength: converter.HostPrefixLength(e.ip),
+			SrcNetworkAddr:   net.ParseIP("0.0.0.0"),
+			SrcNetworkLength: 0,
+			NextHopPort:      &e.routerPortID,
+			NextHopGateway:   e.nodeIP,
+			Type:             "Normal",
+		},
+	)
+	return res, nil
+}
+
+// egressIPRoute is a sub resource to represent a route to forward
+// the traffic from a Pod in the Namespace, which is not routed by
+// more specific routes, to the hosting Node.
+type egressIPRoute struct {
+	routerPortID uuid.UUID
+	podIP        net.IP
+	nodeIP       net.IP
+}
+
+func (r *egressIPRoute) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	baseID := converter.IDForKey("Namespace Egress IP Route", key.Key(), config)
+	routerID := converter.ClusterRouterID(config)
+	var res []converter.BackendResource
+	for _, dst := range converter.EgressRouteDestinations() {
+		dstLen, _ := dst.Mask.Size()
+		id := converter.SubID(baseID, dst.String())
+		res = append(res, &midonet.Route{
+			Parent:           midonet.Parent{ID: &routerID},
+			ID:               &id,
+			DstNetworkAddr:   dst.IP,
+			DstNetworkLength: dstLen,
+			SrcNetworkAddr:   r.podIP,
+			SrcNetworkLength: converter.HostPrefixLength(r.podIP),
+			NextHopPort:      &r.routerPortID,
+			NextHopGateway:   r.nodeIP,
+			Type:             "Normal",
+			Weight:           converter.EgressIPRouteWeight,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,527 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package networkpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/node"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/pod"
+)
+
+// podIndexer is the subset of cache.Indexer the converter uses
+// to find Pods in a namespace.
+type podIndexer interface {
+	ByIndex(indexName, indexedValue string) ([]interface{}, error)
+}
+
+// lister is the subset of cache.Store the converter uses to list
+// Namespaces.
+type lister interface {
+	List() []interface{}
+}
+
+type policyConverter struct {
+	podIndexer podIndexer
+	nsLister   lister
+	nodeGetter cache.KeyGetter
+}
+
+func newPolicyConverter(podInformer, nsInformer, nodeInformer cache.SharedIndexInformer) converter.Converter {
+	return &policyConverter{
+		podIndexer: podInformer.GetIndexer(),
+		nsLister:   nsInformer.GetIndexer(),
+		nodeGetter: nodeInformer.GetIndexer(),
+	}
+}
+
+// translatablePod returns true if the Pod has the port created by
+// the pod converter.
+func translatablePod(p *v1.Pod) bool {
+	if p.Spec.NodeName == "" || p.Spec.HostNetwork {
+		return false
+	}
+	return p.Status.Phase != v1.PodSucceeded && p.Status.Phase != v1.PodFailed
+}
+
+// selectPods returns translatable Pods matching the selector
+// in the namespace.
+func (c *policyConverter) selectPods(namespace string, selector labels.Selector) ([]*v1.Pod, error) {
+	objs, err := c.podIndexer.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var pods []*v1.Pod
+	for _, obj := range objs {
+		p := obj.(*v1.Pod)
+		if !translatablePod(p) || !selector.Matches(labels.Set(p.Labels)) {
+			continue
+		}
+		pods = append(pods, p)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, nil
+}
+
+// selectNamespaces returns names of Namespaces matching the selector.
+func (c *policyConverter) selectNamespaces(selector labels.Selector) []string {
+	var names []string
+	for _, obj := range c.nsLister.List() {
+		ns := obj.(*v1.Namespace)
+		if selector.Matches(labels.Set(ns.Labels)) {
+			names = append(names, ns.Name)
+		}
+	}
+	return names
+}
+
+// peer is a set of addresses of a NetworkPolicyPeer.
+// For an IPBlock, cidr is the address block and except is the excluded
+// address blocks.  For Pods, group is the key of the IPAddrGroup for
+// the addresses of the Pods.
+type peer struct {
+	cidr   string
+	except []string
+	group  *converter.Key
+	pods   []*v1.Pod
+}
+
+// anyPeers represents any addresses.
+var anyPeers = []peer{{}}
+
+// podPeers returns the Pods selected by the NetworkPolicyPeer, grouped
+// by IPAddrGroups.  Usually it's a single group.  For egress, however,
+// Pods are grouped by the resolutions of the ports as named ports are
+// resolved with the peer Pods.
+// The key of a group doesn't depend on the addresses of the Pods so that
+// changes of Pods update the group membership, rather than the Chain
+// for the rule.
+func (c *policyConverter) podPeers(groupKey converter.Key, dir pod.Direction, np *networkingv1.NetworkPolicyPeer, ports []networkingv1.NetworkPolicyPort) ([]peer, error) {
+	namespaces := []string{groupKey.Namespace}
+	if np.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(np.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		namespaces = c.selectNamespaces(selector)
+	}
+	podSelector := labels.Everything()
+	if np.PodSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(np.PodSelector)
+		if err != nil {
+			return nil, err
+		}
+		podSelector = selector
+	}
+	groups := make(map[string][]*v1.Pod)
+	for _, ns := range namespaces {
+		pods, err := c.selectPods(ns, podSelector)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pods {
+			ip := net.ParseIP(p.Status.PodIP)
+			if ip == nil || ip.To4() == nil {
+				continue
+			}
+			var sig string
+			if dir == pod.Egress && len(ports) > 0 {
+				sig = shortHash(fmt.Sprintf("%v", portMatches(ports, p)))
+			}
+			groups[sig] = append(groups[sig], p)
+		}
+	}
+	sigs := make([]string, 0, len(groups))
+	for sig := range groups {
+		sigs = append(sigs, sig)
+	}
+	sort.Strings(sigs)
+	var peers []peer
+	for _, sig := range sigs {
+		k := groupKey
+		if sig != "" {
+			k.Name = fmt.Sprintf("%s/%s", k.Name, sig)
+		}
+		peers = append(peers, peer{
+			group: &k,
+			pods:  groups[sig],
+		})
+	}
+	return peers, nil
+}
+
+func ipBlockPeers(b *networkingv1.IPBlock) ([]peer, error) {
+	_, cidr, err := net.ParseCIDR(b.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	if cidr.IP.To4() == nil {
+		// We only support IPv4.
+		return nil, nil
+	}
+	var except []string
+	for _, e := range b.Except {
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, err
+		}
+		except = append(except, n.String())
+	}
+	sort.Strings(except)
+	return []peer{{cidr: cidr.String(), except: except}}, nil
+}
+
+// peers returns the addresses of the NetworkPolicyPeers of the given
+// NetworkPolicy rule.  An empty list of NetworkPolicyPeers means
+// any addresses.
+func (c *policyConverter) peers(ruleKey converter.Key, dir pod.Direction, rule *policyRule) ([]peer, error) {
+	if len(rule.peers) == 0 {
+		return anyPeers, nil
+	}
+	var peers []peer
+	for j := range rule.peers {
+		np := &rule.peers[j]
+		var ps []peer
+		var err error
+		if np.IPBlock != nil {
+			ps, err = ipBlockPeers(np.IPBlock)
+		} else if np.PodSelector != nil || np.NamespaceSelector != nil {
+			groupKey := converter.Key{
+				Kind:      "NetworkPolicy-Group",
+				Namespace: ruleKey.Namespace,
+				Name:      fmt.Sprintf("%s/%d", ruleKey.Name, j),
+			}
+			ps, err = c.podPeers(groupKey, dir, np, rule.ports)
+		}
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, ps...)
+	}
+	return peers, nil
+}
+
+// portMatch is an L4 condition.  Zero means any.
+type portMatch struct {
+	protocol int
+	port     int
+}
+
+func (m portMatch) String() string {
+	return fmt.Sprintf("%d:%d", m.protocol, m.port)
+}
+
+// resolvePort returns the port number for the given NetworkPolicyPort
+// port, resolving a named port with the containers of the Pod.
+// It returns -1 if the port can't be resolved.
+func resolvePort(port *intstr.IntOrString, protocol v1.Protocol, p *v1.Pod) int {
+	if port == nil {
+		return 0
+	}
+	if port.Type == intstr.Int {
+		return port.IntValue()
+	}
+	if p == nil {
+		// A named port for an address block.  We can't resolve it.
+		return -1
+	}
+	for _, c := range p.Spec.Containers {
+		for _, cp := range c.Ports {
+			if cp.Name == port.StrVal && cp.Protocol == protocol {
+				return int(cp.ContainerPort)
+			}
+		}
+	}
+	return -1
+}
+
+// portMatches returns the L4 conditions for the given ports.
+// A nil slice means any ports.
+func portMatches(ports []networkingv1.NetworkPolicyPort, p *v1.Pod) []portMatch {
+	if len(ports) == 0 {
+		return nil
+	}
+	matches := make([]portMatch, 0)
+	for _, port := range ports {
+		protocol := v1.ProtocolTCP
+		if port.Protocol != nil {
+			protocol = *port.Protocol
+		}
+		proto, err := converter.ProtocolNumber(protocol)
+		if err != nil {
+			log.WithError(err).Warn("Ignoring a port with an unsupported protocol")
+			continue
+		}
+		n := resolvePort(port.Port, protocol, p)
+		if n < 0 {
+			// The named port can't be resolved.
+			continue
+		}
+		matches = append(matches, portMatch{protocol: proto, port: n})
+	}
+	return matches
+}
+
+// match is a condition to accept the traffic.
+// The peer addresses are either cidr or IPAddrGroup with the key group.
+type match struct {
+	cidr   string
+	except []string
+	group  string
+	port   portMatch
+}
+
+func (m match) String() string {
+	if m.group != "" {
+		return fmt.Sprintf("%s/%s", m.group, m.port)
+	}
+	return fmt.Sprintf("%s-%v/%s", m.cidr, m.except, m.port)
+}
+
+// matches returns the conditions for a NetworkPolicy rule applied to
+// the given Pod.
+// Named ports are resolved with the Pod for ingress, and with the peer
+// Pods for egress.
+func matches(p *v1.Pod, dir pod.Direction, peers []peer, ports []networkingv1.NetworkPolicyPort) []match {
+	set := make(map[string]match)
+	for _, peer := range peers {
+		portPod := p
+		if dir == pod.Egress {
+			portPod = nil
+			if len(peer.pods) > 0 {
+				// All Pods in a group have the same resolutions.
+				portPod = peer.pods[0]
+			}
+		}
+		pms := portMatches(ports, portPod)
+		if pms == nil {
+			pms = []portMatch{{}}
+		}
+		for _, pm := range pms {
+			m := match{cidr: peer.cidr, except: peer.except, port: pm}
+			if peer.group != nil {
+				m.group = peer.group.Key()
+			}
+			set[m.String()] = m
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ms := make([]match, 0, len(keys))
+	for _, k := range keys {
+		ms = append(ms, set[k])
+	}
+	return ms
+}
+
+func shortHash(s string) string {
+	h := sha1.Sum([]byte(s))
+	return hex.EncodeToString(h[:])[:10]
+}
+
+func hashOf(ms []match) string {
+	return shortHash(fmt.Sprintf("%v", ms))
+}
+
+func affects(spec *networkingv1.NetworkPolicySpec, dir pod.Direction) bool {
+	if len(spec.PolicyTypes) == 0 {
+		// Ingress is always assumed.  Egress is assumed if
+		// there are egress rules.
+		return dir == pod.Ingress || len(spec.Egress) > 0
+	}
+	for _, t := range spec.PolicyTypes {
+		if string(t) == string(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *policyConverter) nodeCIDR(nodeName string) (string, error) {
+	obj, exists, err := c.nodeGetter.GetByKey(nodeName)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("node %s is not known yet", nodeName)
+	}
+	si, err := node.GetSubnetInfo(obj.(*v1.Node).Spec.PodCIDR)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/32", si.NodeIP.IP), nil
+}
+
+// policyRule is a NetworkPolicyIngressRule or NetworkPolicyEgressRule.
+type policyRule struct {
+	peers []networkingv1.NetworkPolicyPeer
+	ports []networkingv1.NetworkPolicyPort
+}
+
+func policyRules(spec *networkingv1.NetworkPolicySpec, dir pod.Direction) []policyRule {
+	var rules []policyRule
+	if dir == pod.Ingress {
+		for _, r := range spec.Ingress {
+			rules = append(rules, policyRule{peers: r.From, ports: r.Ports})
+		}
+	} else {
+		for _, r := range spec.Egress {
+			rules = append(rules, policyRule{peers: r.To, ports: r.Ports})
+		}
+	}
+	return rules
+}
+
+func (c *policyConverter) Convert(key converter.Key, obj interface{}, config *converter.Config) ([]converter.BackendResource, converter.SubResourceMap, error) {
+	subs := make(converter.SubResourceMap)
+	policy := obj.(*networkingv1.NetworkPolicy)
+	spec := &policy.Spec
+	selector, err := metav1.LabelSelectorAsSelector(&spec.PodSelector)
+	if err != nil {
+		// Not retriable
+		log.WithError(err).WithField("key", key).Error("Invalid podSelector")
+		return nil, nil, nil
+	}
+	pods, err := c.selectPods(policy.Namespace, selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, dir := range []pod.Direction{pod.Ingress, pod.Egress} {
+		if !affects(spec, dir) {
+			continue
+		}
+		err := c.convertDirection(subs, key, policy, pods, dir, config)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return nil, subs, nil
+}
+
+// addGroup adds the sub resources for an IPAddrGroup and its addresses.
+// Each address has its own sub resource so that a change of Pods
+// doesn't re-create the group.
+func addGroup(subs converter.SubResourceMap, groupKey converter.Key, pods []*v1.Pod) {
+	subs[groupKey] = &addrGroup{}
+	for _, p := range pods {
+		ip := net.ParseIP(p.Status.PodIP)
+		subs[converter.Key{
+			Kind:      "NetworkPolicy-GroupAddr",
+			Namespace: groupKey.Namespace,
+			Name:      fmt.Sprintf("%s/%s", groupKey.Name, ip),
+		}] = &groupAddr{
+			group: groupKey.Key(),
+			ip:    ip,
+		}
+	}
+}
+
+func (c *policyConverter) convertDirection(subs converter.SubResourceMap, key converter.Key, policy *networkingv1.NetworkPolicy, pods []*v1.Pod, dir pod.Direction, config *converter.Config) error {
+	dirName := strings.ToLower(string(dir))
+	rules := policyRules(&policy.Spec, dir)
+	peers := make([][]peer, len(rules))
+	for i := range rules {
+		ruleKey := converter.Key{
+			Namespace: key.Namespace,
+			Name:      fmt.Sprintf("%s/%s/%d", key.Name, dirName, i),
+		}
+		ps, err := c.peers(ruleKey, dir, &rules[i])
+		if err != nil {
+			return err
+		}
+		for _, peer := range ps {
+			if peer.group != nil {
+				addGroup(subs, *peer.group, peer.pods)
+			}
+		}
+		peers[i] = ps
+	}
+	for _, p := range pods {
+		podKey := fmt.Sprintf("%s/%s", p.Namespace, p.Name)
+		allowChainID := pod.AllowChainID(podKey, dir, config)
+		// The Pod is isolated for the direction.
+		subs[converter.Key{
+			Kind:      "NetworkPolicy-Isolation",
+			Namespace: key.Namespace,
+			Name:      fmt.Sprintf("%s/%s/%s", key.Name, p.Name, dirName),
+		}] = &podIsolation{
+			chainID: pod.DenyChainID(podKey, dir, config),
+		}
+		if dir == pod.Ingress {
+			// Always allow the traffic from the Node, e.g. for kubelet
+			// probes.
+			nodeCIDR, err := c.nodeCIDR(p.Spec.NodeName)
+			if err != nil {
+				return err
+			}
+			subs[converter.Key{
+				Kind:      "NetworkPolicy-Node",
+				Namespace: key.Namespace,
+				Name:      fmt.Sprintf("%s/%s/%s/%s", key.Name, p.Name, dirName, nodeCIDR),
+			}] = &nodeRule{
+				chainID: allowChainID,
+				cidr:    nodeCIDR,
+			}
+		}
+		for i, rule := range rules {
+			ms := matches(p, dir, peers[i], rule.ports)
+			if len(ms) == 0 {
+				// Nothing is allowed by this rule.
+				continue
+			}
+			// The rules for a NetworkPolicy rule are shared among
+			// the Pods.  As MidoNet Rules are not updateable,
+			// the key includes the hash of the rules.
+			ruleKey := converter.Key{
+				Kind:      fmt.Sprintf("NetworkPolicy-%s", dir),
+				Namespace: key.Namespace,
+				Name:      fmt.Sprintf("%s/%s/%d/%s", key.Name, dirName, i, hashOf(ms)),
+			}
+			subs[ruleKey] = &ruleChain{
+				dir:     dir,
+				matches: ms,
+			}
+			subs[converter.Key{
+				Kind:      "NetworkPolicy-Jump",
+				Namespace: key.Namespace,
+				Name:      fmt.Sprintf("%s/%s", ruleKey.Name, p.Name),
+			}] = &ruleJump{
+				chainID: allowChainID,
+				ruleKey: ruleKey,
+			}
+		}
+	}
+	return nil
+}
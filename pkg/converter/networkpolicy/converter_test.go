@@ -0,0 +1,624 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package networkpolicy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/pod"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+func newPod(ns, name, ip string, labels map[string]string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+			Labels:    labels,
+		},
+		Spec: v1.PodSpec{
+			NodeName: "node1",
+			Containers: []v1.Container{
+				{
+					Ports: []v1.ContainerPort{
+						{Name: "http", ContainerPort: 8080, Protocol: v1.ProtocolTCP},
+					},
+				},
+			},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			PodIP: ip,
+		},
+	}
+}
+
+var (
+	podWeb    = newPod("foo", "web", "10.1.0.10", map[string]string{"app": "web"})
+	podDB     = newPod("foo", "db", "10.1.0.11", map[string]string{"app": "db"})
+	podClient = newPod("bar", "client", "10.1.0.12", map[string]string{"app": "client"})
+
+	nsFoo = &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "foo",
+			Labels: map[string]string{"team": "a"},
+		},
+	}
+	nsBar = &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "bar",
+			Labels: map[string]string{"team": "b"},
+		},
+	}
+
+	node1 = &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node1",
+		},
+		Spec: v1.NodeSpec{
+			PodCIDR: "10.1.0.0/24",
+		},
+	}
+
+	tcp = v1.ProtocolTCP
+)
+
+type podGetter struct {
+	pods map[string][]interface{}
+}
+
+func (g *podGetter) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	return g.pods[indexedValue], nil
+}
+
+type objGetter struct {
+	objs map[string]interface{}
+}
+
+func (s *objGetter) GetByKey(key string) (interface{}, bool, error) {
+	obj, exists := s.objs[key]
+	return obj, exists, nil
+}
+
+func (s *objGetter) List() []interface{} {
+	var l []interface{}
+	for _, obj := range s.objs {
+		l = append(l, obj)
+	}
+	return l
+}
+
+func newTestConverter() *policyConverter {
+	return &policyConverter{
+		podIndexer: &podGetter{
+			pods: map[string][]interface{}{
+				"foo": {podWeb, podDB},
+				"bar": {podClient},
+			},
+		},
+		nsLister: &objGetter{
+			objs: map[string]interface{}{
+				"foo": nsFoo,
+				"bar": nsBar,
+			},
+		},
+		nodeGetter: &objGetter{
+			objs: map[string]interface{}{
+				"node1": node1,
+			},
+		},
+	}
+}
+
+func policyKey(name string) converter.Key {
+	return converter.Key{
+		Kind:      "NetworkPolicy",
+		Namespace: "foo",
+		Name:      name,
+	}
+}
+
+func subsOfKind(subs converter.SubResourceMap, kind string) []converter.Key {
+	var keys []converter.Key
+	for k := range subs {
+		if k.Kind == kind {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func TestConverterDenyAll(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "deny-all",
+		},
+	}
+	c := newTestConverter()
+	_, subs, err := c.Convert(policyKey("deny-all"), policy, config)
+	assert.Nil(t, err)
+	// The isolation and the Node rule for each of web and db.
+	assert.Len(t, subs, 4)
+	k := converter.Key{
+		Kind:      "NetworkPolicy-Isolation",
+		Namespace: "foo",
+		Name:      "deny-all/web/ingress",
+	}
+	assert.Contains(t, subs, k)
+	rs, err := subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 2)
+	rule := rs[0].(*midonet.Rule)
+	assert.Equal(t, "drop", rule.Type)
+	assert.Equal(t, 0x800, rule.DLType)
+	denyChainID := pod.DenyChainID("foo/web", pod.Ingress, config)
+	assert.Equal(t, &denyChainID, rule.Parent.ID)
+	// IPv6 is dropped entirely as the accept rules are IPv4 only.
+	rule = rs[1].(*midonet.Rule)
+	assert.Equal(t, "drop", rule.Type)
+	assert.Equal(t, 0x86dd, rule.DLType)
+	assert.Equal(t, &denyChainID, rule.Parent.ID)
+	assert.NotEqual(t, rs[0].(*midonet.Rule).ID, rule.ID)
+	k = converter.Key{
+		Kind:      "NetworkPolicy-Node",
+		Namespace: "foo",
+		Name:      "deny-all/db/ingress/10.1.0.2/32",
+	}
+	assert.Contains(t, subs, k)
+	rs, err = subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	rule = rs[0].(*midonet.Rule)
+	assert.Equal(t, "accept", rule.Type)
+	assert.Equal(t, "10.1.0.2", rule.NWSrcAddress)
+	assert.Equal(t, 32, rule.NWSrcLength)
+	allowChainID := pod.AllowChainID("foo/db", pod.Ingress, config)
+	assert.Equal(t, &allowChainID, rule.Parent.ID)
+}
+
+func TestConverterEgressOnly(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "egress",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		},
+	}
+	c := newTestConverter()
+	_, subs, err := c.Convert(policyKey("egress"), policy, config)
+	assert.Nil(t, err)
+	// Only the egress isolation for each of web and db.
+	assert.Len(t, subs, 2)
+	k := converter.Key{
+		Kind:      "NetworkPolicy-Isolation",
+		Namespace: "foo",
+		Name:      "egress/web/egress",
+	}
+	assert.Contains(t, subs, k)
+	rs, err := subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	rule := rs[0].(*midonet.Rule)
+	assert.Equal(t, "drop", rule.Type)
+	denyChainID := pod.DenyChainID("foo/web", pod.Egress, config)
+	assert.Equal(t, &denyChainID, rule.Parent.ID)
+}
+
+func TestConverterEgress(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	httpPort := intstr.FromString("http")
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "client",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "web"},
+			},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{
+					To: []networkingv1.NetworkPolicyPeer{
+						{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{"app": "db"},
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &tcp, Port: &httpPort},
+					},
+				},
+			},
+		},
+	}
+	c := newTestConverter()
+	_, subs, err := c.Convert(policyKey("client"), policy, config)
+	assert.Nil(t, err)
+	// ingress isolation, node, egress isolation, rule chain, jump,
+	// group, address
+	assert.Len(t, subs, 7)
+	assert.Len(t, subsOfKind(subs, "NetworkPolicy-Ingress"), 0)
+	chains := subsOfKind(subs, "NetworkPolicy-Egress")
+	assert.Len(t, chains, 1)
+	rs, err := subs[chains[0]].Convert(chains[0], config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 2)
+	rule := rs[1].(*midonet.Rule)
+	assert.Equal(t, "accept", rule.Type)
+	assert.Equal(t, "", rule.NWDstAddress)
+	assert.Equal(t, "", rule.NWSrcAddress)
+	assert.Nil(t, rule.IPAddrGroupSrc)
+	groups := subsOfKind(subs, "NetworkPolicy-Group")
+	assert.Len(t, groups, 1)
+	groupID := groupID(groups[0].Key(), config)
+	assert.Equal(t, &groupID, rule.IPAddrGroupDst)
+	// The named port is resolved with the peer Pod.
+	assert.Equal(t, &midonet.PortRange{Start: 8080, End: 8080}, rule.TPDst)
+	jumps := subsOfKind(subs, "NetworkPolicy-Jump")
+	assert.Len(t, jumps, 1)
+	rs, err = subs[jumps[0]].Convert(jumps[0], config)
+	assert.Nil(t, err)
+	rule = rs[0].(*midonet.Rule)
+	allowChainID := pod.AllowChainID("foo/web", pod.Egress, config)
+	assert.Equal(t, &allowChainID, rule.Parent.ID)
+}
+
+func TestConverterIPBlock(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	httpPort := intstr.FromString("http")
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "external",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "web"},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{
+					To: []networkingv1.NetworkPolicyPeer{
+						{
+							IPBlock: &networkingv1.IPBlock{
+								CIDR:   "192.168.0.0/16",
+								Except: []string{"192.168.2.0/24", "192.168.1.1/32"},
+							},
+						},
+						{
+							IPBlock: &networkingv1.IPBlock{
+								CIDR: "172.16.0.1/12",
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &tcp, Port: &httpPort},
+					},
+				},
+			},
+		},
+	}
+	c := newTestConverter()
+	_, subs, err := c.Convert(policyKey("external"), policy, config)
+	assert.Nil(t, err)
+	// A named port can't be resolved for address blocks.
+	assert.Len(t, subsOfKind(subs, "NetworkPolicy-Egress"), 0)
+
+	port := intstr.FromInt(443)
+	policy.Spec.Egress[0].Ports[0].Port = &port
+	_, subs, err = c.Convert(policyKey("external"), policy, config)
+	assert.Nil(t, err)
+	chains := subsOfKind(subs, "NetworkPolicy-Egress")
+	assert.Len(t, chains, 1)
+	rs, err := subs[chains[0]].Convert(chains[0], config)
+	assert.Nil(t, err)
+	// chain, accept for 172.16.0.0/12, except chain, 2 returns,
+	// accept, jump to the except chain
+	assert.Len(t, rs, 7)
+	chainID := ruleChainID(chains[0], config)
+	rule := rs[1].(*midonet.Rule)
+	assert.Equal(t, "accept", rule.Type)
+	assert.Equal(t, &chainID, rule.Parent.ID)
+	assert.Equal(t, "172.16.0.0", rule.NWDstAddress)
+	assert.Equal(t, 12, rule.NWDstLength)
+	assert.Equal(t, &midonet.PortRange{Start: 443, End: 443}, rule.TPDst)
+	exceptChain := rs[2].(*midonet.Chain)
+	// The returns precede the accept rule.
+	var excepts []string
+	for i, r := range rs[3:5] {
+		rule := r.(*midonet.Rule)
+		assert.Equal(t, "return", rule.Type)
+		assert.Equal(t, exceptChain.ID, rule.Parent.ID)
+		assert.Equal(t, i+1, rule.Position)
+		assert.Nil(t, rule.TPDst)
+		excepts = append(excepts, fmt.Sprintf("%s/%d", rule.NWDstAddress, rule.NWDstLength))
+	}
+	assert.Equal(t, []string{"192.168.1.1/32", "192.168.2.0/24"}, excepts)
+	rule = rs[5].(*midonet.Rule)
+	assert.Equal(t, "accept", rule.Type)
+	assert.Equal(t, exceptChain.ID, rule.Parent.ID)
+	assert.Equal(t, 3, rule.Position)
+	assert.Equal(t, "192.168.0.0", rule.NWDstAddress)
+	assert.Equal(t, 16, rule.NWDstLength)
+	assert.Equal(t, &midonet.PortRange{Start: 443, End: 443}, rule.TPDst)
+	rule = rs[6].(*midonet.Rule)
+	assert.Equal(t, "jump", rule.Type)
+	assert.Equal(t, &chainID, rule.Parent.ID)
+	assert.Equal(t, exceptChain.ID, rule.JumpChainID)
+}
+
+func TestConverterIngress(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	httpPort := intstr.FromString("http")
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "web",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "web"},
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{"app": "db"},
+							},
+						},
+						{
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{"team": "b"},
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						{Protocol: &tcp, Port: &httpPort},
+					},
+				},
+			},
+		},
+	}
+	c := newTestConverter()
+	_, subs, err := c.Convert(policyKey("web"), policy, config)
+	assert.Nil(t, err)
+	// isolation, node, rule chain, jump, 2 groups and their addresses
+	assert.Len(t, subs, 8)
+	chains := subsOfKind(subs, "NetworkPolicy-Ingress")
+	assert.Len(t, chains, 1)
+	rs, err := subs[chains[0]].Convert(chains[0], config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 3)
+	var groups []uuid.UUID
+	for _, r := range rs[1:] {
+		rule := r.(*midonet.Rule)
+		assert.Equal(t, "accept", rule.Type)
+		assert.Equal(t, "", rule.NWSrcAddress)
+		assert.Equal(t, 6, rule.NWProto)
+		assert.Equal(t, &midonet.PortRange{Start: 8080, End: 8080}, rule.TPDst)
+		assert.NotNil(t, rule.IPAddrGroupSrc)
+		groups = append(groups, *rule.IPAddrGroupSrc)
+	}
+	var addrs []string
+	for _, k := range subsOfKind(subs, "NetworkPolicy-GroupAddr") {
+		rs, err := subs[k].Convert(k, config)
+		assert.Nil(t, err)
+		addr := rs[0].(*midonet.IPAddrGroupAddr)
+		assert.Contains(t, groups, *addr.Parent.ID)
+		assert.Equal(t, 4, addr.Version)
+		addrs = append(addrs, addr.Addr.String())
+	}
+	assert.ElementsMatch(t, []string{"10.1.0.11", "10.1.0.12"}, addrs)
+	for _, k := range subsOfKind(subs, "NetworkPolicy-Group") {
+		rs, err := subs[k].Convert(k, config)
+		assert.Nil(t, err)
+		assert.Contains(t, groups, *rs[0].(*midonet.IPAddrGroup).ID)
+	}
+	jumps := subsOfKind(subs, "NetworkPolicy-Jump")
+	assert.Len(t, jumps, 1)
+	rs, err = subs[jumps[0]].Convert(jumps[0], config)
+	assert.Nil(t, err)
+	rule := rs[0].(*midonet.Rule)
+	allowChainID := pod.AllowChainID("foo/web", pod.Ingress, config)
+	assert.Equal(t, &allowChainID, rule.Parent.ID)
+	ruleChainID := ruleChainID(chains[0], config)
+	assert.Equal(t, &ruleChainID, rule.JumpChainID)
+
+	// A change of the peer addresses only changes the group membership.
+	client := *podClient
+	client.Status.PodIP = "10.1.0.13"
+	c.podIndexer.(*podGetter).pods["bar"] = []interface{}{&client}
+	_, subs2, err := c.Convert(policyKey("web"), policy, config)
+	assert.Nil(t, err)
+	assert.Equal(t, chains, subsOfKind(subs2, "NetworkPolicy-Ingress"))
+	assert.ElementsMatch(t, subsOfKind(subs, "NetworkPolicy-Group"), subsOfKind(subs2, "NetworkPolicy-Group"))
+	assert.NotContains(t, subs2, converter.Key{
+		Kind:      "NetworkPolicy-GroupAddr",
+		Namespace: "foo",
+		Name:      "web/ingress/0/1/10.1.0.12",
+	})
+	assert.Contains(t, subs2, converter.Key{
+		Kind:      "NetworkPolicy-GroupAddr",
+		Namespace: "foo",
+		Name:      "web/ingress/0/1/10.1.0.13",
+	})
+
+	// A change of the set of peers changes the key of the rule chain.
+	c.podIndexer.(*podGetter).pods["bar"] = nil
+	_, subs3, err := c.Convert(policyKey("web"), policy, config)
+	assert.Nil(t, err)
+	chains3 := subsOfKind(subs3, "NetworkPolicy-Ingress")
+	assert.Len(t, chains3, 1)
+	assert.NotEqual(t, chains[0], chains3[0])
+}
+
+func TestConverterNoPeers(t *testing.T) {
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "web",
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "web"},
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{"app": "nothing"},
+							},
+						},
+					},
+				},
+				{
+					// Allow all
+				},
+			},
+		},
+	}
+	c := newTestConverter()
+	_, subs, err := c.Convert(policyKey("web"), policy, config)
+	assert.Nil(t, err)
+	chains := subsOfKind(subs, "NetworkPolicy-Ingress")
+	assert.Len(t, chains, 1)
+	rs, err := subs[chains[0]].Convert(chains[0], config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 2)
+	rule := rs[1].(*midonet.Rule)
+	assert.Equal(t, "", rule.NWSrcAddress)
+	assert.Equal(t, 0, rule.NWProto)
+	assert.Nil(t, rule.TPDst)
+}
+
+func TestEventHandlers(t *testing.T) {
+	queue := workqueue.New()
+	defer queue.ShutDown()
+	drain := func() []string {
+		var keys []string
+		for queue.Len() > 0 {
+			key, _ := queue.Get()
+			keys = append(keys, key.(string))
+			queue.Done(key)
+		}
+		return keys
+	}
+	newPolicy := func(ns, name string, peer networkingv1.NetworkPolicyPeer) *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns,
+				Name:      name,
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{
+					{From: []networkingv1.NetworkPolicyPeer{peer}},
+				},
+			},
+		}
+	}
+	policies := &objGetter{
+		objs: map[string]interface{}{
+			// Selects Pods in foo.
+			"foo/local": newPolicy("foo", "local", networkingv1.NetworkPolicyPeer{
+				PodSelector: &metav1.LabelSelector{},
+			}),
+			// Selects Pods in Namespaces with team=b.
+			"baz/team-b": newPolicy("baz", "team-b", networkingv1.NetworkPolicyPeer{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"team": "b"},
+				},
+			}),
+			// Selects only the address block.
+			"baz/block": newPolicy("baz", "block", networkingv1.NetworkPolicyPeer{
+				IPBlock: &networkingv1.IPBlock{CIDR: "192.0.2.0/24"},
+			}),
+		},
+	}
+	namespaces := &objGetter{
+		objs: map[string]interface{}{
+			"foo": nsFoo,
+			"bar": nsBar,
+		},
+	}
+	podHandler := newPodEventHandler(policies, namespaces, queue)
+	nsHandler := newNamespaceEventHandler(policies, queue)
+
+	podHandler.(cache.ResourceEventHandlerFuncs).AddFunc(podWeb)
+	assert.ElementsMatch(t, []string{"foo/local"}, drain())
+	podHandler.OnDelete(podClient)
+	assert.ElementsMatch(t, []string{"baz/team-b"}, drain())
+
+	// Ignored updates.
+	updated := podWeb.DeepCopy()
+	updated.Annotations = map[string]string{"foo": "bar"}
+	podHandler.OnUpdate(podWeb, updated)
+	assert.Equal(t, 0, queue.Len())
+	updated.Labels = map[string]string{"app": "api"}
+	podHandler.OnUpdate(podWeb, updated)
+	assert.ElementsMatch(t, []string{"foo/local"}, drain())
+
+	// A Pod in an unknown Namespace.
+	podHandler.OnDelete(newPod("qux", "web", "10.1.0.13", nil))
+	assert.Equal(t, 0, queue.Len())
+
+	nsHandler.(cache.ResourceEventHandlerFuncs).AddFunc(nsFoo)
+	assert.Equal(t, 0, queue.Len())
+	nsHandler.OnDelete(nsBar)
+	assert.ElementsMatch(t, []string{"baz/team-b"}, drain())
+	newNs := nsFoo.DeepCopy()
+	newNs.Annotations = map[string]string{"foo": "bar"}
+	nsHandler.OnUpdate(nsFoo, newNs)
+	assert.Equal(t, 0, queue.Len())
+	// foo starts matching team-b.
+	newNs.Labels = map[string]string{"team": "b"}
+	nsHandler.OnUpdate(nsFoo, newNs)
+	assert.ElementsMatch(t, []string{"baz/team-b"}, drain())
+	// bar stops matching team-b.
+	newNs = nsBar.DeepCopy()
+	newNs.Labels = nil
+	nsHandler.OnUpdate(nsBar, newNs)
+	assert.ElementsMatch(t, []string{"baz/team-b"}, drain())
+}
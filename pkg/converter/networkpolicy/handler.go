@@ -0,0 +1,146 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package networkpolicy
+
+import (
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// selectsNamespaces returns true if a peer of the NetworkPolicy
+// has a namespaceSelector which matches any of the given Namespace labels.
+func selectsNamespaces(policy *networkingv1.NetworkPolicy, nsLabels []labels.Set) bool {
+	var peers []networkingv1.NetworkPolicyPeer
+	for _, r := range policy.Spec.Ingress {
+		peers = append(peers, r.From...)
+	}
+	for _, r := range policy.Spec.Egress {
+		peers = append(peers, r.To...)
+	}
+	for _, np := range peers {
+		if np.IPBlock != nil || np.NamespaceSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(np.NamespaceSelector)
+		if err != nil {
+			// The converter doesn't select anything with it.
+			continue
+		}
+		for _, l := range nsLabels {
+			if selector.Matches(l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queuePolicies queues NetworkPolicies which might select Pods in
+// a Namespace.  These are the NetworkPolicies in the Namespace, and
+// the ones with a namespaceSelector which matches any of nsLabels.
+// An empty namespace means only the latter.
+func queuePolicies(policyLister lister, queue workqueue.Interface, namespace string, nsLabels []labels.Set) {
+	for _, obj := range policyLister.List() {
+		policy := obj.(*networkingv1.NetworkPolicy)
+		if policy.Namespace != namespace && !selectsNamespaces(policy, nsLabels) {
+			continue
+		}
+		k, err := cache.MetaNamespaceKeyFunc(policy)
+		if err != nil {
+			continue
+		}
+		log.WithField("key", k).Debug("Queueing for Pod or Namespace changes")
+		queue.Add(k)
+	}
+}
+
+// newPodEventHandler creates an event handler which queues
+// NetworkPolicies when a Pod which might affect them is changed.
+func newPodEventHandler(policyLister lister, nsGetter cache.KeyGetter, queue workqueue.Interface) cache.ResourceEventHandler {
+	queueForPod := func(obj interface{}) {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = d.Obj
+		}
+		p, ok := obj.(*v1.Pod)
+		if !ok {
+			return
+		}
+		var nsLabels []labels.Set
+		nsObj, exists, err := nsGetter.GetByKey(p.Namespace)
+		if err != nil {
+			log.WithError(err).WithField("namespace", p.Namespace).Error("Failed to get the Namespace")
+			return
+		}
+		// If the Namespace is not known yet, no namespaceSelector
+		// selects it.  The NetworkPolicies are queued when it's added.
+		if exists {
+			nsLabels = []labels.Set{labels.Set(nsObj.(*v1.Namespace).Labels)}
+		}
+		queuePolicies(policyLister, queue, p.Namespace, nsLabels)
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: queueForPod,
+		UpdateFunc: func(old, new interface{}) {
+			// Ignore Pod updates which don't change what we use.
+			// They happen often.
+			oldPod := old.(*v1.Pod)
+			newPod := new.(*v1.Pod)
+			if reflect.DeepEqual(oldPod.Labels, newPod.Labels) &&
+				oldPod.Spec.NodeName == newPod.Spec.NodeName &&
+				oldPod.Status.PodIP == newPod.Status.PodIP &&
+				translatablePod(oldPod) == translatablePod(newPod) {
+				return
+			}
+			queueForPod(newPod)
+		},
+		DeleteFunc: queueForPod,
+	}
+}
+
+// newNamespaceEventHandler creates an event handler which queues
+// NetworkPolicies with a namespaceSelector which matches the old or new
+// labels of a Namespace.
+func newNamespaceEventHandler(policyLister lister, queue workqueue.Interface) cache.ResourceEventHandler {
+	queueForNamespace := func(obj interface{}) {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = d.Obj
+		}
+		ns, ok := obj.(*v1.Namespace)
+		if !ok {
+			return
+		}
+		queuePolicies(policyLister, queue, "", []labels.Set{labels.Set(ns.Labels)})
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: queueForNamespace,
+		UpdateFunc: func(old, new interface{}) {
+			oldLabels := old.(*v1.Namespace).Labels
+			newLabels := new.(*v1.Namespace).Labels
+			if reflect.DeepEqual(oldLabels, newLabels) {
+				return
+			}
+			queuePolicies(policyLister, queue, "", []labels.Set{labels.Set(oldLabels), labels.Set(newLabels)})
+		},
+		DeleteFunc: queueForNamespace,
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package networkpolicy
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/pod"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+// podIsolation is a sub resource to represent rules to drop the traffic
+// which is not accepted by any NetworkPolicies.
+// As the accept rules are IPv4 only, the IPv6 traffic of an isolated
+// Pod is dropped entirely.
+type podIsolation struct {
+	chainID uuid.UUID
+}
+
+func (i *podIsolation) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	ruleID := converter.IDForKey("NetworkPolicyIsolation", key.Key(), config)
+	ipv6RuleID := converter.SubID(ruleID, "IPv6")
+	return []converter.BackendResource{
+		&midonet.Rule{
+			Parent: midonet.Parent{ID: &i.chainID},
+			ID:     &ruleID,
+			Type:   "drop",
+			DLType: converter.EtherTypeIPv4,
+		},
+		&midonet.Rule{
+			Parent: midonet.Parent{ID: &i.chainID},
+			ID:     &ipv6RuleID,
+			Type:   "drop",
+			DLType: converter.EtherTypeIPv6,
+		},
+	}, nil
+}
+
+// ipRule returns a rule of the given type for IPv4 traffic with
+// the peer in the given CIDR.  The peer is the source for ingress,
+// and the destination for egress.
+func ipRule(chainID uuid.UUID, ruleID uuid.UUID, ruleType string, dir pod.Direction, cidr string) *midonet.Rule {
+	rule := &midonet.Rule{
+		Parent: midonet.Parent{ID: &chainID},
+		ID:     &ruleID,
+		Type:   ruleType,
+		DLType: 0x800,
+	}
+	if cidr == "" {
+		return rule
+	}
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		log.WithError(err).WithField("cidr", cidr).Fatal("Unparsable CIDR")
+	}
+	length, _ := n.Mask.Size()
+	if dir == pod.Egress {
+		rule.NWDstAddress = n.IP.String()
+		rule.NWDstLength = length
+	} else {
+		rule.NWSrcAddress = n.IP.String()
+		rule.NWSrcLength = length
+	}
+	return rule
+}
+
+func groupID(groupKey string, config *converter.Config) uuid.UUID {
+	return converter.IDForKey("NetworkPolicyGroup", groupKey, config)
+}
+
+// acceptRule returns a rule to accept the traffic with the peer
+// matching the given condition.  The excluded addresses are not
+// taken care of.
+func acceptRule(chainID uuid.UUID, ruleID uuid.UUID, dir pod.Direction, m match, config *converter.Config) *midonet.Rule {
+	rule := ipRule(chainID, ruleID, "accept", dir, m.cidr)
+	if m.group != "" {
+		id := groupID(m.group, config)
+		if dir == pod.Egress {
+			rule.IPAddrGroupDst = &id
+		} else {
+			rule.IPAddrGroupSrc = &id
+		}
+	}
+	rule.NWProto = m.port.protocol
+	if m.port.port != 0 {
+		rule.TPDst = &midonet.PortRange{Start: m.port.port, End: m.port.port}
+	}
+	return rule
+}
+
+// addrGroup is a sub resource to represent an IPAddrGroup for
+// the Pods selected by a NetworkPolicyPeer.
+type addrGroup struct{}
+
+func (g *addrGroup) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	id := groupID(key.Key(), config)
+	return []converter.BackendResource{
+		&midonet.IPAddrGroup{
+			ID:   &id,
+			Name: fmt.Sprintf("KUBE-NWP-%s", key.Key()),
+		},
+	}, nil
+}
+
+// groupAddr is a sub resource to represent an address in an addrGroup.
+type groupAddr struct {
+	group string
+	ip    net.IP
+}
+
+func (a *groupAddr) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	id := groupID(a.group, config)
+	return []converter.BackendResource{
+		midonet.NewIPAddrGroupAddr(&id, a.ip),
+	}, nil
+}
+
+// nodeRule is a sub resource to represent a rule to accept
+// the traffic from the given CIDR.
+type nodeRule struct {
+	chainID uuid.UUID
+	cidr    string
+}
+
+func (r *nodeRule) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	ruleID := converter.IDForKey("NetworkPolicyRule", key.Key(), config)
+	return []converter.BackendResource{
+		acceptRule(r.chainID, ruleID, pod.Ingress, match{cidr: r.cidr}, config),
+	}, nil
+}
+
+func ruleChainID(ruleKey converter.Key, config *converter.Config) uuid.UUID {
+	return converter.IDForKey("NetworkPolicyRuleChain", ruleKey.Key(), config)
+}
+
+// ruleChain is a sub resource to represent a chain to accept
+// the traffic allowed by a NetworkPolicyIngressRule or
+// a NetworkPolicyEgressRule.
+type ruleChain struct {
+	dir     pod.Direction
+	matches []match
+}
+
+func (c *ruleChain) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	chainID := ruleChainID(key, config)
+	res := []converter.BackendResource{
+		&midonet.Chain{
+			ID:       &chainID,
+			Name:     fmt.Sprintf("KUBE-NWP-%s", key.Key()),
+			TenantID: config.Tenant,
+		},
+	}
+	for i, m := range c.matches {
+		ruleID := converter.SubID(chainID, m.String())
+		if len(m.except) == 0 {
+			res = append(res, acceptRule(chainID, ruleID, c.dir, m, config))
+			continue
+		}
+		// An IPBlock with exceptions has its own chain, where
+		// the traffic with the excluded addresses returns before
+		// the accept rule.
+		exceptChainID := converter.SubID(chainID, fmt.Sprintf("Except %s", m))
+		res = append(res, &midonet.Chain{
+			ID:       &exceptChainID,
+			Name:     fmt.Sprintf("KUBE-NWP-EXCEPT-%s-%d", key.Key(), i),
+			TenantID: config.Tenant,
+		})
+		for j, e := range m.except {
+			returnID := converter.SubID(exceptChainID, e)
+			rule := ipRule(exceptChainID, returnID, "return", c.dir, e)
+			rule.Position = j + 1
+			res = append(res, rule)
+		}
+		accept := acceptRule(exceptChainID, converter.SubID(exceptChainID, "Accept"), c.dir, m, config)
+		accept.Position = len(m.except) + 1
+		res = append(res, accept)
+		res = append(res, &midonet.Rule{
+			Parent:      midonet.Parent{ID: &chainID},
+			ID:          &ruleID,
+			Type:        "jump",
+			JumpChainID: &exceptChainID,
+		})
+	}
+	return res, nil
+}
+
+// ruleJump is a sub resource to represent a jump rule from the allow
+// chain of a Pod to a ruleChain.
+type ruleJump struct {
+	chainID uuid.UUID
+	ruleKey converter.Key
+}
+
+func (j *ruleJump) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	ruleID := converter.IDForKey("NetworkPolicyJump", key.Key(), config)
+	targetID := ruleChainID(j.ruleKey, config)
+	return []converter.BackendResource{
+		&midonet.Rule{
+			Parent:      midonet.Parent{ID: &j.chainID},
+			ID:          &ruleID,
+			Type:        "jump",
+			JumpChainID: &targetID,
+		},
+	}, nil
+}
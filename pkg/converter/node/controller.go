@@ -16,6 +16,7 @@
 package node
 
 import (
+	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
@@ -30,6 +31,9 @@ import (
 
 // NewController creates a node controller.
 func NewController(si informers.SharedInformerFactory, msi mninformers.SharedInformerFactory, kc *kubernetes.Clientset, mc *mncli.Clientset, recorder record.EventRecorder, config *converter.Config, _ *midonet.Config) *controller.Controller {
+	if err := ValidateEgressSNAT(config); err != nil {
+		log.WithError(err).Fatal("Invalid egress SNAT configuration")
+	}
 	informer := si.Core().V1().Nodes().Informer()
 	updater := converter.NewTranslationUpdater(mc, recorder)
 	handler := converter.NewHandler(newNodeConverter(), updater, config)
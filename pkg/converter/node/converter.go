@@ -33,31 +33,59 @@ func idForKey(key string, config *converter.Config) uuid.UUID {
 	return converter.IDForKey("Node", key, config)
 }
 
-func portIDForKey(key string, config *converter.Config) uuid.UUID {
-	baseID := idForKey(key, config)
-	return converter.SubID(baseID, "Node Port")
-}
-
 type nodeConverter struct{}
 
 func newNodeConverter() converter.Converter {
 	return &nodeConverter{}
 }
 
-func nodeAddresses(nodeKey converter.Key, routerPortID uuid.UUID, nodeIP net.IP, as []v1.NodeAddress) converter.SubResourceMap {
+func isRoutableAddress(a v1.NodeAddress) bool {
+	typ := a.Type
+	return typ == v1.NodeExternalIP || typ == v1.NodeInternalIP
+}
+
+func parseAddress(nodeName string, a v1.NodeAddress) net.IP {
+	ip := net.ParseIP(a.Address)
+	if ip == nil {
+		// REVISIT: can this happen?
+		log.WithFields(log.Fields{
+			"node":    nodeName,
+			"address": a.Address,
+		}).Fatal("Unparsable Node Address")
+	}
+	return ip
+}
+
+// Addresses returns the addresses of the given Node which we route to
+// the Node.  That is, ExternalIP and InternalIP addresses.
+func Addresses(node *v1.Node) []net.IP {
+	var ips []net.IP
+	for _, a := range node.Status.Addresses {
+		if !isRoutableAddress(a) {
+			continue
+		}
+		ips = append(ips, parseAddress(node.Name, a))
+	}
+	return ips
+}
+
+// nodeAddresses returns sub resources for the given Node addresses.
+// IPv6 addresses are routed only when the Node has an IPv6 subnet,
+// i.e. nodeIPv6 is not nil.
+func nodeAddresses(nodeKey converter.Key, routerPortID uuid.UUID, nodeIP, nodeIPv6 net.IP, as []v1.NodeAddress) converter.SubResourceMap {
 	subs := make(converter.SubResourceMap)
 	for _, a := range as {
-		typ := a.Type
-		if typ != v1.NodeExternalIP && typ != v1.NodeInternalIP {
+		if !isRoutableAddress(a) {
 			continue
 		}
-		ip := net.ParseIP(a.Address)
-		if ip == nil {
-			// REVISIT: can this happen?
-			log.WithFields(log.Fields{
-				"node":    nodeKey,
-				"address": a.Address,
-			}).Fatal("Unparsable Node Address")
+		typ := a.Type
+		ip := parseAddress(nodeKey.Name, a)
+		nextHop := nodeIP
+		if ip.To4() == nil {
+			if nodeIPv6 == nil {
+				continue
+			}
+			nextHop = nodeIPv6
 		}
 		key := converter.Key{
 			Kind: "Node-Address",
@@ -65,9 +93,19 @@ func nodeAddresses(nodeKey converter.Key, routerPortID uuid.UUID, nodeIP net.IP,
 		}
 		subs[key] = &nodeAddress{
 			routerPortID: routerPortID,
-			nodeIP:       nodeIP,
+			nodeIP:       nextHop,
 			ip:           ip,
 		}
+		if ip.To4() != nil {
+			key := converter.Key{
+				Kind: "Node-HostPorts",
+				Name: fmt.Sprintf("%s/hostports/%s", nodeKey.Name, ip),
+			}
+			subs[key] = &hostPortsJump{
+				nodeName: nodeKey.Key(),
+				ip:       ip,
+			}
+		}
 	}
 	return subs
 }
@@ -85,10 +123,10 @@ func (c *nodeConverter) Convert(key converter.Key, obj interface{}, config *conv
 	routerID := converter.ClusterRouterID(config)
 	bridgeID := baseID
 	bridgePortID := converter.SubID(baseID, "Bridge Port")
-	nodePortID := portIDForKey(key.Key(), config)
-	nodePortChainID := converter.SubID(baseID, "Node Port Chain")
+	nodePortID := converter.NodePortID(key.Key(), config)
+	nodePortChainID := converter.NodePortChainID(key.Key(), config)
 	nodeSNATRuleID := converter.SubID(baseID, "Node Port SNAT Rule")
-	routerPortID := converter.SubID(baseID, "Router Port")
+	routerPortID := converter.NodeRouterPortID(key.Key(), config)
 	subnetRouteID := converter.SubID(baseID, "Route")
 	spec := obj.(*v1.Node).Spec
 	status := obj.(*v1.Node).Status
@@ -96,7 +134,9 @@ func (c *nodeConverter) Convert(key converter.Key, obj interface{}, config *conv
 	bridgeName := key.Key()
 	si, err := GetSubnetInfo(spec.PodCIDR)
 	if err != nil {
-		log.WithField("node", obj).Fatal("Failed to parse PodCIDR")
+		// Not retriable
+		log.WithError(err).WithField("node", key.Key()).Error("Ignoring Node with invalid PodCIDR")
+		return nil, nil, nil
 	}
 	routerPortSubnet := []*types.IPNet{
 		{IP: si.GatewayIP.IP, Mask: si.GatewayIP.Mask},
@@ -111,8 +151,31 @@ func (c *nodeConverter) Convert(key converter.Key, obj interface{}, config *conv
 		// (until the Node is updated again)
 		return nil, nil, nil
 	}
+	var ipv6SI *SubnetInfo
+	var nodeIPv6 net.IP
+	if s, ok := meta.Annotations[converter.IPv6PodCIDRAnnotation]; ok {
+		ipv6SI, err = GetIPv6SubnetInfo(s)
+		if err != nil {
+			// Not retriable.  Proceed with IPv4 only.
+			log.WithError(err).WithField("node", key.Key()).Error("Ignoring invalid IPv6 PodCIDR")
+			ipv6SI = nil
+		} else {
+			routerPortSubnet = append(routerPortSubnet, &types.IPNet{
+				IP:   ipv6SI.GatewayIP.IP,
+				Mask: ipv6SI.GatewayIP.Mask,
+			})
+			nodeIPv6 = ipv6SI.NodeIP.IP
+		}
+	}
 	mainChainID := converter.MainChainID(config)
-	subs := nodeAddresses(key, routerPortID, nodeIP, status.Addresses)
+	subs := nodeAddresses(key, routerPortID, nodeIP, nodeIPv6, status.Addresses)
+	if ipv6SI != nil {
+		subs[ipv6SubnetKey(key, ipv6SI)] = &nodeIPv6Subnet{
+			routerPortID:    routerPortID,
+			nodePortChainID: nodePortChainID,
+			si:              ipv6SI,
+		}
+	}
 	tunnelZoneID, err := getTunnelZoneID(meta.Annotations[converter.TunnelZoneIDAnnotation], config)
 	if err == nil {
 		tunnelEndpointIP := net.ParseIP(meta.Annotations[converter.TunnelEndpointIPAnnotation])
@@ -153,12 +216,43 @@ func (c *nodeConverter) Convert(key converter.Key, obj interface{}, config *conv
 			MAC:      mac,
 		}
 	}
+	if config.EgressSNAT != EgressSNATDisabled {
+		ip := egressSNATAddress(config.EgressSNAT, status.Addresses)
+		if ip != nil {
+			excludes := EgressSNATExcludes(key.Name, status.Addresses, config)
+			subs[egressSNATKey(key, ip, excludes)] = &egressSNAT{
+				routerPortID:    routerPortID,
+				nodePortChainID: nodePortChainID,
+				subnet:          si.Subnet,
+				nodeIP:          nodeIP,
+				ip:              ip,
+				excludes:        excludes,
+			}
+		}
+	}
+	egressChainID := converter.NodeEgressChainID(key.Key(), config)
+	hostPortsChainID := converter.NodeHostPortsChainID(key.Key(), config)
 	return []converter.BackendResource{
+		// The Chain for hostPorts of Pods on the Node.  It's populated
+		// by the pod controller.
+		&midonet.Chain{
+			ID:       &hostPortsChainID,
+			Name:     fmt.Sprintf("KUBE-HOSTPORTS-%s", key.Key()),
+			TenantID: config.Tenant,
+		},
+		// The outbound filter of the Bridge.  It's populated by
+		// the pod controller.  See pkg/converter/pod/filter.go.
+		&midonet.Chain{
+			ID:       &egressChainID,
+			Name:     fmt.Sprintf("KUBE-NODE-EGRESS-%s", key.Key()),
+			TenantID: config.Tenant,
+		},
 		&midonet.Bridge{
-			ID:              &bridgeID,
-			Name:            bridgeName,
-			TenantID:        config.Tenant,
-			InboundFilterID: &mainChainID,
+			ID:               &bridgeID,
+			Name:             bridgeName,
+			TenantID:         config.Tenant,
+			InboundFilterID:  &mainChainID,
+			OutboundFilterID: &egressChainID,
 		},
 		&midonet.Port{
 			Parent: midonet.Parent{ID: &bridgeID},
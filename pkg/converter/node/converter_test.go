@@ -16,13 +16,17 @@
 package node
 
 import (
+	"fmt"
+	"net"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 )
 
 var (
@@ -82,7 +86,7 @@ func TestConverterWithTunnelZone(t *testing.T) {
 	c := &nodeConverter{}
 	rs, subs, err := c.Convert(key, nodeWithTunnelZone, config)
 	assert.Nil(t, err)
-	assert.Len(t, rs, 9)
+	assert.Len(t, rs, 11)
 	assert.Len(t, subs, 1)
 	assert.Contains(t, subs, converter.Key{
 		Kind: "Node-Tunnel-Endpoint",
@@ -102,7 +106,7 @@ func TestConverterWithMAC(t *testing.T) {
 	c := &nodeConverter{}
 	rs, subs, err := c.Convert(key, nodeWithMAC, config)
 	assert.Nil(t, err)
-	assert.Len(t, rs, 9)
+	assert.Len(t, rs, 11)
 	assert.Len(t, subs, 2)
 	assert.Contains(t, subs, converter.Key{
 		Kind: "Node-ARP",
@@ -126,8 +130,8 @@ func TestConverterWithAddresses(t *testing.T) {
 	c := &nodeConverter{}
 	rs, subs, err := c.Convert(key, nodeWithAddresses, config)
 	assert.Nil(t, err)
-	assert.Len(t, rs, 9)
-	assert.Len(t, subs, 2)
+	assert.Len(t, rs, 11)
+	assert.Len(t, subs, 4)
 	assert.Contains(t, subs, converter.Key{
 		Kind: "Node-Address",
 		Name: "awesome-node/ExternalIP/192.2.0.9",
@@ -136,4 +140,326 @@ func TestConverterWithAddresses(t *testing.T) {
 		Kind: "Node-Address",
 		Name: "awesome-node/InternalIP/192.2.0.10",
 	})
+	k := converter.Key{
+		Kind: "Node-HostPorts",
+		Name: "awesome-node/hostports/192.2.0.10",
+	}
+	assert.Contains(t, subs, k)
+	rs, err = subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	rule := rs[0].(*midonet.Rule)
+	hostPortsChainID := converter.HostPortsChainID(config)
+	assert.Equal(t, &hostPortsChainID, rule.Parent.ID)
+	assert.Equal(t, "192.2.0.10", rule.NWDstAddress)
+	nodeChainID := converter.NodeHostPortsChainID("foo/awesome-node", config)
+	assert.Equal(t, &nodeChainID, rule.JumpChainID)
+}
+
+func TestConverterIPv6PodCIDR(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Node",
+		Namespace: "foo",
+		Name:      "awesome-node",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	obj := nodeWithMAC.DeepCopy()
+	obj.Spec.PodCIDR = "fd00:10:1:2::/64"
+	c := &nodeConverter{}
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 0)
+	assert.Len(t, subs, 0)
+}
+
+func TestConverterDualStack(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Node",
+		Namespace: "foo",
+		Name:      "awesome-node",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	obj := nodeWithAddresses.DeepCopy()
+	obj.Status.Addresses = append(obj.Status.Addresses, v1.NodeAddress{
+		Type:    v1.NodeInternalIP,
+		Address: "fd00:192:2::10",
+	})
+	c := &nodeConverter{}
+
+	// Without the IPv6 PodCIDR, IPv6 addresses are not routed.
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 11)
+	assert.Len(t, subs, 4)
+	routerPort := rs[4].(*midonet.Port)
+	assert.Len(t, routerPort.PortSubnet, 1)
+
+	obj.Annotations[converter.IPv6PodCIDRAnnotation] = "fd00:10:1:2::/64"
+	rs, subs, err = c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 11)
+	assert.Len(t, subs, 6)
+	routerPort = rs[4].(*midonet.Port)
+	assert.Len(t, routerPort.PortSubnet, 2)
+	ipnet := net.IPNet(*routerPort.PortSubnet[1])
+	assert.Equal(t, "fd00:10:1:2::1/64", ipnet.String())
+
+	k := converter.Key{
+		Kind: "Node-Address",
+		Name: "awesome-node/InternalIP/fd00:192:2::10",
+	}
+	assert.Contains(t, subs, k)
+	rs, err = subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	route := rs[0].(*midonet.Route)
+	assert.Equal(t, "fd00:192:2::10", route.DstNetworkAddr.String())
+	assert.Equal(t, 128, route.DstNetworkLength)
+	assert.Equal(t, "::", route.SrcNetworkAddr.String())
+	assert.Equal(t, "fd00:10:1:2::2", route.NextHopGateway.String())
+
+	k = converter.Key{
+		Kind: "Node-IPv6Subnet",
+		Name: "awesome-node/ipv6/fd00:10:1:2::/64",
+	}
+	assert.Contains(t, subs, k)
+	rs, err = subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 2)
+	route = rs[0].(*midonet.Route)
+	assert.Equal(t, "fd00:10:1:2::", route.DstNetworkAddr.String())
+	assert.Equal(t, 64, route.DstNetworkLength)
+	assert.Equal(t, "::", route.SrcNetworkAddr.String())
+	routerPortID := converter.NodeRouterPortID("foo/awesome-node", config)
+	assert.Equal(t, &routerPortID, route.NextHopPort)
+	rule := rs[1].(*midonet.Rule)
+	assert.Equal(t, 0x86dd, rule.DLType)
+	assert.Equal(t, "fd00:10:1:2::2", rule.NWSrcAddress)
+	assert.Equal(t, 128, rule.NWSrcLength)
+	assert.Equal(t, "fd00:10:1:2::1", (*rule.NATTargets)[0].AddressFrom)
+
+	// An invalid IPv6 PodCIDR is ignored.
+	obj.Annotations[converter.IPv6PodCIDRAnnotation] = "10.1.3.0/24"
+	rs, subs, err = c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 11)
+	assert.Len(t, subs, 4)
+}
+
+func TestGetSubnetInfo(t *testing.T) {
+	si, err := GetSubnetInfo("10.1.2.0/24")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.1.2.1/24", si.GatewayIP.String())
+	assert.Equal(t, "10.1.2.2/24", si.NodeIP.String())
+	assert.Equal(t, "10.1.2.0/24", si.Subnet.String())
+
+	_, err = GetSubnetInfo("fd00:10:1:2::/64")
+	assert.Error(t, err)
+	_, err = GetSubnetInfo("")
+	assert.Error(t, err)
+}
+
+func TestGetIPv6SubnetInfo(t *testing.T) {
+	si, err := GetIPv6SubnetInfo("fd00:10:1:2::/64")
+	assert.Nil(t, err)
+	assert.Equal(t, "fd00:10:1:2::1/64", si.GatewayIP.String())
+	assert.Equal(t, "fd00:10:1:2::2/64", si.NodeIP.String())
+	assert.Equal(t, "fd00:10:1:2::/64", si.Subnet.String())
+
+	_, err = GetIPv6SubnetInfo("10.1.2.0/24")
+	assert.Error(t, err)
+}
+
+func TestAddresses(t *testing.T) {
+	ips := Addresses(nodeWithAddresses)
+	assert.Len(t, ips, 2)
+	assert.Equal(t, "192.2.0.9", ips[0].String())
+	assert.Equal(t, "192.2.0.10", ips[1].String())
+}
+
+func TestConverterEgressSNAT(t *testing.T) {
+	key := converter.Key{
+		Kind: "Node",
+		Name: "awesome-node",
+	}
+	config := &converter.Config{
+		Tenant:      "MyTenant",
+		EgressSNAT:  EgressSNATExternal,
+		ClusterCIDR: []string{"10.1.0.0/16", "fd00:1::/64"},
+		ServiceCIDR: []string{"10.96.0.0/12"},
+	}
+	c := &nodeConverter{}
+	_, subs, err := c.Convert(key, nodeWithAddresses, config)
+	assert.Nil(t, err)
+	var keys []converter.Key
+	for k := range subs {
+		if k.Kind == "Node-EgressSNAT" {
+			keys = append(keys, k)
+		}
+	}
+	assert.Len(t, keys, 1)
+	assert.Contains(t, keys[0].Name, "awesome-node/egress-snat/192.2.0.9/")
+	rs, err := subs[keys[0]].Convert(keys[0], config)
+	assert.Nil(t, err)
+	// chain, 5 returns, SNAT, jump, 2 routes
+	assert.Len(t, rs, 10)
+	chainID := *rs[0].(*midonet.Chain).ID
+	var excludes []string
+	for i, r := range rs[1:5] {
+		rule := r.(*midonet.Rule)
+		assert.Equal(t, "return", rule.Type)
+		assert.Equal(t, &chainID, rule.Parent.ID)
+		assert.Equal(t, i+1, rule.Position)
+		excludes = append(excludes, fmt.Sprintf("%s/%d", rule.NWDstAddress, rule.NWDstLength))
+	}
+	assert.Equal(t, []string{"10.1.0.0/16", "10.96.0.0/12", "192.2.0.10/32", "192.2.0.9/32"}, excludes)
+	egressIP := rs[5].(*midonet.Rule)
+	assert.Equal(t, "return", egressIP.Type)
+	assert.Equal(t, 5, egressIP.Position)
+	egressIPGroupID := converter.EgressIPGroupID(config)
+	assert.Equal(t, &egressIPGroupID, egressIP.IPAddrGroupSrc)
+	snat := rs[6].(*midonet.Rule)
+	assert.Equal(t, &chainID, snat.Parent.ID)
+	assert.Equal(t, "snat", snat.Type)
+	assert.Equal(t, 6, snat.Position)
+	assert.Equal(t, "10.1.2.0", snat.NWSrcAddress)
+	assert.Equal(t, 24, snat.NWSrcLength)
+	assert.True(t, snat.MatchForwardFlow)
+	assert.Equal(t, "192.2.0.9", (*snat.NATTargets)[0].AddressFrom)
+	jump := rs[7].(*midonet.Rule)
+	assert.Equal(t, &chainID, jump.JumpChainID)
+	var dsts []string
+	for _, r := range rs[8:] {
+		route := r.(*midonet.Route)
+		assert.Equal(t, "10.1.2.0", route.SrcNetworkAddr.String())
+		assert.Equal(t, 24, route.SrcNetworkLength)
+		assert.Equal(t, "10.1.2.2", route.NextHopGateway.String())
+		assert.Equal(t, converter.EgressSNATRouteWeight, route.Weight)
+		dsts = append(dsts, fmt.Sprintf("%s/%d", route.DstNetworkAddr, route.DstNetworkLength))
+	}
+	assert.Equal(t, []string{"0.0.0.0/1", "128.0.0.0/1"}, dsts)
+
+	config.EgressSNAT = EgressSNATInternal
+	_, subs2, err := c.Convert(key, nodeWithAddresses, config)
+	assert.Nil(t, err)
+	assert.NotContains(t, subs2, keys[0])
+
+	config.EgressSNAT = EgressSNATDisabled
+	_, subs3, err := c.Convert(key, nodeWithAddresses, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs3, 4)
+}
+
+func TestValidateEgressSNAT(t *testing.T) {
+	assert.Nil(t, ValidateEgressSNAT(&converter.Config{}))
+	assert.Nil(t, ValidateEgressSNAT(&converter.Config{EgressSNAT: "internal", ClusterCIDR: []string{"10.1.0.0/16"}}))
+	assert.Nil(t, ValidateEgressSNAT(&converter.Config{EgressSNAT: "internal", ClusterCIDR: []string{"10.1.0.0/16", "fd00:1::/64"}, ServiceCIDR: []string{""}}))
+	assert.Error(t, ValidateEgressSNAT(&converter.Config{EgressSNAT: "foo"}))
+	assert.Error(t, ValidateEgressSNAT(&converter.Config{EgressSNAT: "external", ServiceCIDR: []string{"foo"}}))
+	assert.Error(t, ValidateEgressSNAT(&converter.Config{EgressSNAT: "external", ClusterCIDR: []string{"10.1.0.0/16,fd00:1::/64"}}))
+}
+
+// lookupRoutes returns the routes MidoNet would use for the traffic
+// from src to dst.  I.e. the ones with the longest destination prefix
+// and, among them, the ones with the smallest weight.
+func lookupRoutes(routes []*midonet.Route, src, dst net.IP) []*midonet.Route {
+	var found []*midonet.Route
+	for _, r := range routes {
+		dstNet := net.IPNet{IP: r.DstNetworkAddr, Mask: net.CIDRMask(r.DstNetworkLength, 32)}
+		srcNet := net.IPNet{IP: r.SrcNetworkAddr, Mask: net.CIDRMask(r.SrcNetworkLength, 32)}
+		if !dstNet.Contains(dst) || !srcNet.Contains(src) {
+			continue
+		}
+		if len(found) > 0 {
+			if r.DstNetworkLength < found[0].DstNetworkLength {
+				continue
+			}
+			if r.DstNetworkLength == found[0].DstNetworkLength && r.Weight > found[0].Weight {
+				continue
+			}
+			if r.DstNetworkLength > found[0].DstNetworkLength || r.Weight < found[0].Weight {
+				found = nil
+			}
+		}
+		found = append(found, r)
+	}
+	return found
+}
+
+func TestEgressSNATRoutes(t *testing.T) {
+	key := converter.Key{
+		Kind: "Node",
+		Name: "awesome-node",
+	}
+	config := &converter.Config{
+		Tenant:      "MyTenant",
+		EgressSNAT:  EgressSNATExternal,
+		ClusterCIDR: []string{"10.1.0.0/16"},
+		ServiceCIDR: []string{"10.96.0.0/12"},
+	}
+	c := &nodeConverter{}
+	rs, subs, err := c.Convert(key, nodeWithAddresses, config)
+	assert.Nil(t, err)
+	for k, sub := range subs {
+		srs, err := sub.Convert(k, config)
+		assert.Nil(t, err)
+		rs = append(rs, srs...)
+	}
+	var routes []*midonet.Route
+	for _, r := range rs {
+		if route, ok := r.(*midonet.Route); ok {
+			routes = append(routes, route)
+		}
+	}
+	// The default route of the cluster router, which the operator
+	// might have configured.  Even with the smallest weight, it
+	// doesn't take precedence.
+	uplinkID := uuid.New()
+	defaultRoute := &midonet.Route{
+		DstNetworkAddr: net.ParseIP("0.0.0.0"),
+		SrcNetworkAddr: net.ParseIP("0.0.0.0"),
+		NextHopPort:    &uplinkID,
+	}
+	routes = append(routes, defaultRoute)
+	// An egress IP route for a Pod on the Node.  See pkg/converter/namespace.
+	egressIPGateway := net.ParseIP("10.1.3.2")
+	for _, dst := range converter.EgressRouteDestinations() {
+		dstLen, _ := dst.Mask.Size()
+		routes = append(routes, &midonet.Route{
+			DstNetworkAddr:   dst.IP,
+			DstNetworkLength: dstLen,
+			SrcNetworkAddr:   net.ParseIP("10.1.2.10"),
+			SrcNetworkLength: 32,
+			NextHopGateway:   egressIPGateway,
+			Weight:           converter.EgressIPRouteWeight,
+		})
+	}
+
+	nodeIP := net.ParseIP("10.1.2.2")
+	for _, tc := range []struct {
+		src     string
+		dst     string
+		gateway net.IP
+		uplink  bool
+	}{
+		// The outside of the cluster.  SNATed by the Node.
+		{"10.1.2.5", "8.8.8.8", nodeIP, false},
+		{"10.1.2.5", "198.51.100.1", nodeIP, false},
+		// A Pod on the Node.
+		{"10.1.2.5", "10.1.2.6", nil, false},
+		// The Pod with an egress IP.
+		{"10.1.2.10", "8.8.8.8", egressIPGateway, false},
+		{"10.1.2.10", "198.51.100.1", egressIPGateway, false},
+		// Not from Pods on the Node.
+		{"192.0.2.1", "8.8.8.8", nil, true},
+	} {
+		found := lookupRoutes(routes, net.ParseIP(tc.src), net.ParseIP(tc.dst))
+		if !assert.Len(t, found, 1, "%s -> %s", tc.src, tc.dst) {
+			continue
+		}
+		assert.Equal(t, tc.uplink, found[0] == defaultRoute, "%s -> %s", tc.src, tc.dst)
+		assert.Equal(t, tc.gateway.String(), found[0].NextHopGateway.String(), "%s -> %s", tc.src, tc.dst)
+	}
 }
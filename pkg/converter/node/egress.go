@@ -0,0 +1,222 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package node
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"k8s.io/api/core/v1"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+// Egress SNAT modes.  See config.Config.EgressSNAT.
+const (
+	EgressSNATDisabled = ""
+	EgressSNATInternal = "internal"
+	EgressSNATExternal = "external"
+)
+
+// ValidateEgressSNAT validates the egress SNAT configuration.
+func ValidateEgressSNAT(config *converter.Config) error {
+	switch config.EgressSNAT {
+	case EgressSNATDisabled:
+		return nil
+	case EgressSNATInternal, EgressSNATExternal:
+	default:
+		return fmt.Errorf("unknown egress SNAT mode %q", config.EgressSNAT)
+	}
+	for _, cidrs := range [][]string{config.ClusterCIDR, config.ServiceCIDR} {
+		if _, err := converter.ParseCIDRs(cidrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// egressSNATAddress returns the IPv4 address of the Node to SNAT to,
+// or nil if there's none.
+func egressSNATAddress(mode string, as []v1.NodeAddress) net.IP {
+	types := []v1.NodeAddressType{v1.NodeInternalIP}
+	if mode == EgressSNATExternal {
+		types = []v1.NodeAddressType{v1.NodeExternalIP, v1.NodeInternalIP}
+	}
+	for _, typ := range types {
+		for _, a := range as {
+			if a.Type != typ {
+				continue
+			}
+			ip := net.ParseIP(a.Address)
+			if ip != nil && ip.To4() != nil {
+				return ip
+			}
+		}
+	}
+	return nil
+}
+
+// EgressSNATExcludes returns the destinations of the traffic which
+// is not SNATed even when it's routed to the Node.
+func EgressSNATExcludes(nodeName string, as []v1.NodeAddress, config *converter.Config) []string {
+	var excludes []string
+	for _, cidrs := range [][]string{config.ClusterCIDR, config.ServiceCIDR} {
+		// Validated by ValidateEgressSNAT
+		networks, _ := converter.ParseCIDRs(cidrs)
+		for _, n := range networks {
+			// The egress SNAT is IPv4 only.
+			if n.IP.To4() == nil {
+				continue
+			}
+			excludes = append(excludes, n.String())
+		}
+	}
+	// The traffic to the Node addresses is also routed to the Node.
+	for _, a := range as {
+		if !isRoutableAddress(a) {
+			continue
+		}
+		ip := parseAddress(nodeName, a)
+		if ip.To4() != nil {
+			excludes = append(excludes, fmt.Sprintf("%s/32", ip))
+		}
+	}
+	sort.Strings(excludes)
+	return excludes
+}
+
+// egressSNATKey returns the key of the egressSNAT sub resource.
+// As MidoNet Rules are not updateable, it includes everything
+// the Rules depend on.
+func egressSNATKey(nodeKey converter.Key, ip net.IP, excludes []string) converter.Key {
+	h := sha1.Sum([]byte(strings.Join(excludes, ",")))
+	return converter.Key{
+		Kind: "Node-EgressSNAT",
+		Name: fmt.Sprintf("%s/egress-snat/%s/%s", nodeKey.Name, ip, hex.EncodeToString(h[:])[:10]),
+	}
+}
+
+// egressSNAT is a sub resource to represent a route to forward
+// the traffic from the Pods on the Node to the outside of the cluster
+// to the Node, and the rules to SNAT it to an address of the Node.
+type egressSNAT struct {
+	routerPortID    uuid.UUID
+	nodePortChainID uuid.UUID
+	subnet          net.IPNet
+	nodeIP          net.IP
+	ip              net.IP
+	excludes        []string
+}
+
+func (e *egressSNAT) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	baseID := converter.IDForKey("Node Egress SNAT", key.Key(), config)
+	chainID := baseID
+	jumpRuleID := converter.SubID(baseID, "Jump")
+	snatRuleID := converter.SubID(baseID, "SNAT")
+	routeID := converter.SubID(baseID, "Route")
+	egressIPRuleID := converter.SubID(baseID, "Egress IP")
+	egressIPGroupID := converter.EgressIPGroupID(config)
+	routerID := converter.ClusterRouterID(config)
+	subnetLen, _ := e.subnet.Mask.Size()
+	res := []converter.BackendResource{
+		&midonet.Chain{
+			ID:       &chainID,
+			Name:     fmt.Sprintf("KUBE-NODE-SNAT-%s", key.Key()),
+			TenantID: config.Tenant,
+		},
+	}
+	// The rules have explicit positions so that the return rules
+	// precede the SNAT rule.
+	for i, cidr := range e.excludes {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		length, _ := n.Mask.Size()
+		ruleID := converter.SubID(baseID, cidr)
+		res = append(res, &midonet.Rule{
+			Parent:       midonet.Parent{ID: &chainID},
+			ID:           &ruleID,
+			Type:         "return",
+			DLType:       converter.EtherTypeIPv4,
+			NWDstAddress: n.IP.String(),
+			NWDstLength:  length,
+			Position:     i + 1,
+		})
+	}
+	res = append(res,
+		// The traffic from Pods with egress IPs is SNATed by
+		// the Chains for their Namespaces.
+		// See pkg/converter/namespace.
+		&midonet.Rule{
+			Parent:         midonet.Parent{ID: &chainID},
+			ID:             &egressIPRuleID,
+			Type:           "return",
+			DLType:         converter.EtherTypeIPv4,
+			IPAddrGroupSrc: &egressIPGroupID,
+			Position:       len(e.excludes) + 1,
+		},
+		// Only SNAT new connections so that the return traffic of
+		// the connections from the outside, e.g. via NodePorts,
+		// is not affected.
+		&midonet.Rule{
+			Parent:           midonet.Parent{ID: &chainID},
+			ID:               &snatRuleID,
+			Type:             "snat",
+			DLType:           converter.EtherTypeIPv4,
+			NWSrcAddress:     e.subnet.IP.String(),
+			NWSrcLength:      subnetLen,
+			MatchForwardFlow: true,
+			NATTargets: &[]midonet.NATTarget{
+				{
+					AddressFrom: e.ip.String(),
+					AddressTo:   e.ip.String(),
+					// REVISIT: arbitrary port range
+					PortFrom: 30000,
+					PortTo:   60000,
+				},
+			},
+			FlowAction: "continue",
+			Position:   len(e.excludes) + 2,
+		},
+		midonet.JumpRule(&jumpRuleID, &e.nodePortChainID, &chainID),
+	)
+	// Route the traffic from the Pods on the Node, which is not
+	// routed by more specific routes, to the Node.
+	for _, dst := range converter.EgressRouteDestinations() {
+		dstLen, _ := dst.Mask.Size()
+		routeID := converter.SubID(routeID, dst.String())
+		res = append(res, &midonet.Route{
+			Parent:           midonet.Parent{ID: &routerID},
+			ID:               &routeID,
+			DstNetworkAddr:   dst.IP,
+			DstNetworkLength: dstLen,
+			SrcNetworkAddr:   e.subnet.IP,
+			SrcNetworkLength: subnetLen,
+			NextHopPort:      &e.routerPortID,
+			NextHopGateway:   e.nodeIP,
+			Type:             "Normal",
+			Weight:           converter.EgressSNATRouteWeight,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package node
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+func ipv6SubnetKey(nodeKey converter.Key, si *SubnetInfo) converter.Key {
+	return converter.Key{
+		Kind: "Node-IPv6Subnet",
+		Name: fmt.Sprintf("%s/ipv6/%s", nodeKey.Name, si.Subnet.String()),
+	}
+}
+
+// nodeIPv6Subnet is a sub resource to represent the IPv6 counterparts
+// of the subnet Route and the Node IP SNAT rule of the Node.
+// The IPv6 PodCIDR is given by an annotation and can come and go.
+type nodeIPv6Subnet struct {
+	routerPortID    uuid.UUID
+	nodePortChainID uuid.UUID
+	si              *SubnetInfo
+}
+
+func (s *nodeIPv6Subnet) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	baseID := converter.IDForKey("Node IPv6 Subnet", key.Key(), config)
+	routeID := converter.SubID(baseID, "Route")
+	ruleID := converter.SubID(baseID, "Node Port SNAT Rule")
+	routerID := converter.ClusterRouterID(config)
+	subnetLen, _ := s.si.Subnet.Mask.Size()
+	gatewayIP := s.si.GatewayIP.IP.String()
+	return []converter.BackendResource{
+		&midonet.Route{
+			Parent:           midonet.Parent{ID: &routerID},
+			ID:               &routeID,
+			DstNetworkAddr:   s.si.Subnet.IP,
+			DstNetworkLength: subnetLen,
+			SrcNetworkAddr:   net.ParseIP("::"),
+			SrcNetworkLength: 0,
+			NextHopPort:      &s.routerPortID,
+			Type:             "Normal",
+		},
+		// See the IPv4 rule in the Node converter.
+		&midonet.Rule{
+			Parent:       midonet.Parent{ID: &s.nodePortChainID},
+			ID:           &ruleID,
+			Type:         "snat",
+			DLType:       converter.EtherTypeIPv6,
+			NWSrcAddress: s.si.NodeIP.IP.String(),
+			NWSrcLength:  128,
+			NATTargets: &[]midonet.NATTarget{
+				{
+					AddressFrom: gatewayIP,
+					AddressTo:   gatewayIP,
+					// REVISIT: arbitrary port range
+					PortFrom: 30000,
+					PortTo:   60000,
+				},
+			},
+			FlowAction: "continue",
+		},
+	}, nil
+}
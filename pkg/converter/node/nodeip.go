@@ -16,6 +16,7 @@
 package node
 
 import (
+	"fmt"
 	"net"
 
 	"github.com/containernetworking/plugins/pkg/ip"
@@ -29,19 +30,41 @@ type SubnetInfo struct {
 }
 
 // GetSubnetInfo calculates SubnetInfo from the given podCIDR.
+// Only IPv4 is supported.
 func GetSubnetInfo(podCIDR string) (*SubnetInfo, error) {
-	// Use the first IP for the gateway.
-	// Use the next one for the IP for the interface to connect the node.
-	// This should be consistent with the Node converter.
 	addr, subnet, err := net.ParseCIDR(podCIDR)
 	if err != nil {
 		return nil, err
 	}
+	if addr.To4() == nil {
+		return nil, fmt.Errorf("PodCIDR %s is not IPv4", podCIDR)
+	}
+	return subnetInfo(addr, subnet), nil
+}
+
+// GetIPv6SubnetInfo is the IPv6 counterpart of GetSubnetInfo.
+// As a Kubernetes Node has only a single PodCIDR, the IPv6 one is
+// given by the configuration of midonet-kube-node.
+func GetIPv6SubnetInfo(podCIDR string) (*SubnetInfo, error) {
+	addr, subnet, err := net.ParseCIDR(podCIDR)
+	if err != nil {
+		return nil, err
+	}
+	if addr.To4() != nil {
+		return nil, fmt.Errorf("PodCIDR %s is not IPv6", podCIDR)
+	}
+	return subnetInfo(addr, subnet), nil
+}
+
+func subnetInfo(addr net.IP, subnet *net.IPNet) *SubnetInfo {
+	// Use the first IP for the gateway.
+	// Use the next one for the IP for the interface to connect the node.
+	// This should be consistent with the Node converter.
 	gatewayIP := ip.NextIP(addr)
 	nodeIP := ip.NextIP(gatewayIP)
 	return &SubnetInfo{
 		GatewayIP: net.IPNet{IP: gatewayIP, Mask: subnet.Mask},
 		NodeIP:    net.IPNet{IP: nodeIP, Mask: subnet.Mask},
 		Subnet:    *subnet,
-	}, nil
+	}
 }
@@ -24,6 +24,15 @@ import (
 	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 )
 
+// anyAddress returns the unspecified address of the family of
+// the given IP address.
+func anyAddress(ip net.IP) net.IP {
+	if ip.To4() != nil {
+		return net.ParseIP("0.0.0.0")
+	}
+	return net.ParseIP("::")
+}
+
 type nodeAddress struct {
 	routerPortID uuid.UUID
 	nodeIP       net.IP
@@ -40,8 +49,8 @@ func (i *nodeAddress) Convert(key converter.Key, config *converter.Config) ([]co
 			Parent:           midonet.Parent{ID: &routerID},
 			ID:               &routeID,
 			DstNetworkAddr:   i.ip,
-			DstNetworkLength: 32,
-			SrcNetworkAddr:   net.ParseIP("0.0.0.0"),
+			DstNetworkLength: converter.HostPrefixLength(i.ip),
+			SrcNetworkAddr:   anyAddress(i.ip),
 			SrcNetworkLength: 0,
 			NextHopPort:      &i.routerPortID,
 			NextHopGateway:   i.nodeIP,
@@ -49,3 +58,27 @@ func (i *nodeAddress) Convert(key converter.Key, config *converter.Config) ([]co
 		},
 	}, nil
 }
+
+// hostPortsJump is a sub resource to represent a rule to dispatch
+// the traffic to the Node address to the Chain for hostPorts on the Node.
+type hostPortsJump struct {
+	nodeName string
+	ip       net.IP
+}
+
+func (j *hostPortsJump) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	ruleID := converter.IDForKey("Node HostPorts", key.Key(), config)
+	chainID := converter.HostPortsChainID(config)
+	nodeChainID := converter.NodeHostPortsChainID(j.nodeName, config)
+	return []converter.BackendResource{
+		&midonet.Rule{
+			Parent:       midonet.Parent{ID: &chainID},
+			ID:           &ruleID,
+			Type:         "jump",
+			DLType:       0x800,
+			NWDstAddress: j.ip.String(),
+			NWDstLength:  32,
+			JumpChainID:  &nodeChainID,
+		},
+	}, nil
+}
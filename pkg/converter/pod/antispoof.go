@@ -0,0 +1,169 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package pod
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+// Each Pod port has an inbound filter Chain to drop the traffic with
+// forged source addresses.  The Chain is empty until the MAC address
+// and the IP address of the Pod are known, or when the Pod opts out
+// with AllowSpoofingAnnotation.
+//
+// The IPv6 traffic is checked in a separate Chain, which accepts only
+// the IPv6 address of the Pod, if any, and the addresses used before
+// the Pod has one, i.e. link-local ones and the unspecified address.
+
+func antiSpoofingChainID(key string, config *converter.Config) uuid.UUID {
+	return converter.SubID(idForKey(key, config), "Anti Spoofing Chain")
+}
+
+func antiSpoofingChain(key converter.Key, config *converter.Config) converter.BackendResource {
+	chainID := antiSpoofingChainID(key.Key(), config)
+	return &midonet.Chain{
+		ID:       &chainID,
+		Name:     fmt.Sprintf("KUBE-POD-ANTISPOOF-%s", key.Key()),
+		TenantID: config.Tenant,
+	}
+}
+
+// PortSourceMAC is a sub resource to represent a rule to drop the traffic
+// from the Pod with a source MAC address other than the Pod's.
+type PortSourceMAC struct {
+	ChainID uuid.UUID
+	MAC     net.HardwareAddr
+}
+
+func (p *PortSourceMAC) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	ruleID := converter.IDForKey("PodSourceMAC", key.Key(), config)
+	return []converter.BackendResource{
+		&midonet.Rule{
+			Parent:   midonet.Parent{ID: &p.ChainID},
+			ID:       &ruleID,
+			Type:     "drop",
+			DLSrc:    midonet.HardwareAddr(p.MAC),
+			InvDLSrc: true,
+		},
+	}, nil
+}
+
+// PortSourceIP is a sub resource to represent rules to drop the IPv4
+// traffic from the Pod with a source IP address other than the Pod's,
+// and the ARP packets from the Pod with a sender IP address other than
+// the Pod's.
+type PortSourceIP struct {
+	ChainID uuid.UUID
+	IP      net.IP
+}
+
+func (p *PortSourceIP) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	ruleID := converter.IDForKey("PodSourceIP", key.Key(), config)
+	arpRuleID := converter.SubID(ruleID, "ARP")
+	return []converter.BackendResource{
+		&midonet.Rule{
+			Parent:       midonet.Parent{ID: &p.ChainID},
+			ID:           &ruleID,
+			Type:         "drop",
+			DLType:       converter.EtherTypeIPv4,
+			NWSrcAddress: p.IP.String(),
+			NWSrcLength:  converter.HostPrefixLength(p.IP),
+			InvNWSrc:     true,
+		},
+		// MidoNet matches the sender IP address of ARP packets
+		// as the source IP address.
+		&midonet.Rule{
+			Parent:       midonet.Parent{ID: &p.ChainID},
+			ID:           &arpRuleID,
+			Type:         "drop",
+			DLType:       converter.EtherTypeARP,
+			NWSrcAddress: p.IP.String(),
+			NWSrcLength:  converter.HostPrefixLength(p.IP),
+			InvNWSrc:     true,
+		},
+	}, nil
+}
+
+// ipv6AllowedSources are the source networks of the IPv6 traffic
+// allowed for every Pod.  They are used for Neighbor Discovery.
+var ipv6AllowedSources = []string{
+	"fe80::/10",
+	"::/128",
+}
+
+// PortSourceIPv6 is a sub resource to represent a Chain to drop the IPv6
+// traffic from the Pod with a source IP address other than the allowed
+// ones, and a rule to jump to it.  IP is nil if the Pod doesn't have
+// an IPv6 address.
+type PortSourceIPv6 struct {
+	ChainID uuid.UUID
+	IP      net.IP
+}
+
+func (p *PortSourceIPv6) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	baseID := converter.IDForKey("PodSourceIPv6", key.Key(), config)
+	chainID := baseID
+	jumpRuleID := converter.SubID(baseID, "Jump")
+	dropRuleID := converter.SubID(baseID, "Drop")
+	sources := ipv6AllowedSources
+	if p.IP != nil {
+		sources = append([]string{fmt.Sprintf("%s/128", p.IP)}, sources...)
+	}
+	resources := []converter.BackendResource{
+		&midonet.Chain{
+			ID:       &chainID,
+			Name:     fmt.Sprintf("KUBE-POD-ANTISPOOF6-%s", key.Key()),
+			TenantID: config.Tenant,
+		},
+	}
+	for i, s := range sources {
+		// Validated by the caller or constant
+		_, n, _ := net.ParseCIDR(s)
+		length, _ := n.Mask.Size()
+		ruleID := converter.SubID(baseID, s)
+		resources = append(resources, &midonet.Rule{
+			Parent:       midonet.Parent{ID: &chainID},
+			ID:           &ruleID,
+			Type:         "return",
+			DLType:       converter.EtherTypeIPv6,
+			NWSrcAddress: n.IP.String(),
+			NWSrcLength:  length,
+			Position:     i + 1,
+		})
+	}
+	return append(resources,
+		&midonet.Rule{
+			Parent:   midonet.Parent{ID: &chainID},
+			ID:       &dropRuleID,
+			Type:     "drop",
+			DLType:   converter.EtherTypeIPv6,
+			Position: len(sources) + 1,
+		},
+		&midonet.Rule{
+			Parent:      midonet.Parent{ID: &p.ChainID},
+			ID:          &jumpRuleID,
+			Type:        "jump",
+			DLType:      converter.EtherTypeIPv6,
+			JumpChainID: &chainID,
+		},
+	), nil
+}
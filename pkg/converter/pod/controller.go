@@ -16,9 +16,11 @@
 package pod
 
 import (
+	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 
 	mncli "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned"
@@ -31,9 +33,16 @@ import (
 // NewController creates a pod controller.
 func NewController(si informers.SharedInformerFactory, msi mninformers.SharedInformerFactory, kc *kubernetes.Clientset, mc *mncli.Clientset, recorder record.EventRecorder, config *converter.Config, _ *midonet.Config) *controller.Controller {
 	informer := si.Core().V1().Pods().Informer()
+	err := informer.AddIndexers(cache.Indexers{nodeNameIndex: indexByNodeName})
+	if err != nil {
+		log.WithError(err).Fatal("Failed to add the index")
+	}
 	nodeInformer := si.Core().V1().Nodes().Informer()
 	updater := converter.NewTranslationUpdater(mc, recorder)
-	handler := converter.NewHandler(newPodConverter(nodeInformer), updater, config)
+	handler := converter.NewHandler(newPodConverter(nodeInformer, recorder), updater, config)
 	gvk := v1.SchemeGroupVersion.WithKind("Pod")
-	return controller.NewController(gvk, informer, handler)
+	c := controller.NewController(gvk, informer, handler)
+	// Kick Pods on a Node when the Node gets the host ID.
+	nodeInformer.AddEventHandler(newNodeEventHandler(informer.GetIndexer(), c.GetQueue()))
+	return c
 }
@@ -23,8 +23,10 @@ import (
 	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/k8s"
 	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 )
 
@@ -34,10 +36,14 @@ func idForKey(key string, config *converter.Config) uuid.UUID {
 
 type podConverter struct {
 	nodeGetter cache.KeyGetter
+	recorder   record.EventRecorder
 }
 
-func newPodConverter(nodeInformer cache.SharedIndexInformer) converter.Converter {
-	return &podConverter{nodeInformer.GetIndexer()}
+func newPodConverter(nodeInformer cache.SharedIndexInformer, recorder record.EventRecorder) converter.Converter {
+	return &podConverter{
+		nodeGetter: nodeInformer.GetIndexer(),
+		recorder:   recorder,
+	}
 }
 
 func (c *podConverter) Convert(key converter.Key, obj interface{}, config *converter.Config) ([]converter.BackendResource, converter.SubResourceMap, error) {
@@ -45,9 +51,10 @@ func (c *podConverter) Convert(key converter.Key, obj interface{}, config *conve
 	clog := log.WithField("key", key)
 	baseID := idForKey(key.Key(), config)
 	bridgePortID := baseID
-	spec := obj.(*v1.Pod).Spec
-	meta := obj.(*v1.Pod).ObjectMeta
-	status := obj.(*v1.Pod).Status
+	pod := obj.(*v1.Pod)
+	spec := pod.Spec
+	meta := pod.ObjectMeta
+	status := pod.Status
 	nodeName := spec.NodeName
 	if nodeName == "" {
 		clog.Info("NodeName is not set")
@@ -72,14 +79,52 @@ func (c *podConverter) Convert(key converter.Key, obj interface{}, config *conve
 	node := nodeObj.(*v1.Node)
 	hostID, err := uuid.Parse(node.ObjectMeta.Annotations[converter.HostIDAnnotation])
 	if err != nil {
-		// Retry later.  Note: we don't listen Node events.
+		// Retry later.  The Pod is also queued when the Node gets
+		// the host ID.  See newNodeEventHandler.
 		return nil, nil, err
 	}
-	res := []converter.BackendResource{
+	// Note: The filter chains should be created before the port.
+	res := filterChains(key, Ingress, config)
+	res = append(res, filterChains(key, Egress, config)...)
+	res = append(res, antiSpoofingChain(key, config))
+	ingressChainID := filterChainID(key.Key(), Ingress, config)
+	antiSpoofingChainID := antiSpoofingChainID(key.Key(), config)
+	var portQOSPolicyID *uuid.UUID
+	if _, exists := meta.Annotations[ingressBandwidthAnnotation]; exists {
+		clog.Warnf("%s is not supported", ingressBandwidthAnnotation)
+		ref, err := k8s.GetReferenceForEvent(pod)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.recorder.Eventf(ref, v1.EventTypeWarning, "UnsupportedIngressBandwidth", "%s is not supported", ingressBandwidthAnnotation)
+	}
+	if bw, exists := meta.Annotations[egressBandwidthAnnotation]; exists {
+		kbps, err := parseBandwidth(bw)
+		if err != nil {
+			// Not retriable
+			clog.WithError(err).Errorf("Ignoring invalid %s", egressBandwidthAnnotation)
+		} else {
+			qosPolicyID := qosPolicyID(key.Key(), config)
+			portQOSPolicyID = &qosPolicyID
+			skey := converter.Key{
+				Kind:      "Pod-BandwidthLimit",
+				Namespace: key.Namespace,
+				Name:      fmt.Sprintf("%s/egress-bandwidth", key.Name),
+			}
+			subs[skey] = &PortBandwidthLimit{
+				PolicyID: qosPolicyID,
+				MaxKbps:  kbps,
+			}
+		}
+	}
+	res = append(res, []converter.BackendResource{
 		&midonet.Port{
-			Parent: midonet.Parent{ID: &bridgeID},
-			ID:     &bridgePortID,
-			Type:   "Bridge",
+			Parent:           midonet.Parent{ID: &bridgeID},
+			ID:               &bridgePortID,
+			Type:             "Bridge",
+			InboundFilterID:  &antiSpoofingChainID,
+			OutboundFilterID: &ingressChainID,
+			QOSPolicyID:      portQOSPolicyID,
 		},
 		&midonet.HostInterfacePort{
 			Parent:        midonet.Parent{ID: &hostID},
@@ -87,6 +132,79 @@ func (c *podConverter) Convert(key converter.Key, obj interface{}, config *conve
 			PortID:        &bridgePortID,
 			InterfaceName: IFNameForKey(key.Key()),
 		},
+	}...)
+	ip := net.ParseIP(status.PodIP)
+	if ip != nil && ip.To4() != nil {
+		skey := converter.Key{
+			Kind:      "Pod-Egress",
+			Namespace: key.Namespace,
+			Name:      fmt.Sprintf("%s/egress/%s", key.Name, ip),
+		}
+		subs[skey] = &PortEgress{
+			NodeEgressChainID: converter.NodeEgressChainID(nodeName, config),
+			ChainID:           filterChainID(key.Key(), Egress, config),
+			IP:                ip,
+		}
+		hostPorts(subs, key, &spec, ip, config)
+	}
+	ipv6 := parseIPv6Address(meta.Annotations)
+	if ipv6 != nil {
+		skey := converter.Key{
+			Kind:      "Pod-Egress",
+			Namespace: key.Namespace,
+			Name:      fmt.Sprintf("%s/egress/%s", key.Name, ipv6),
+		}
+		subs[skey] = &PortEgress{
+			NodeEgressChainID: converter.NodeEgressChainID(nodeName, config),
+			ChainID:           filterChainID(key.Key(), Egress, config),
+			IP:                ipv6,
+		}
+	}
+	networks, err := ParseNetworks(meta.Annotations)
+	if err != nil {
+		// Not retriable
+		clog.WithError(err).Errorf("Ignoring invalid %s", converter.NetworksAnnotation)
+	}
+	for _, n := range networks {
+		// Validated by ParseNetworks
+		networkBridgeID, _ := uuid.Parse(n.Bridge)
+		skey := converter.Key{
+			Kind:      "Pod-Network",
+			Namespace: key.Namespace,
+			Name:      fmt.Sprintf("%s/network/%s/%s", key.Name, n.Interface, n.Bridge),
+		}
+		subs[skey] = &PortNetwork{
+			BridgeID:      networkBridgeID,
+			HostID:        hostID,
+			InterfaceName: NetworkIFNameForKey(key.Key(), n.Interface),
+		}
+	}
+	antiSpoofing := meta.Annotations[converter.AllowSpoofingAnnotation] != "true"
+	if antiSpoofing && ip != nil && ip.To4() != nil {
+		skey := converter.Key{
+			Kind:      "Pod-SourceIP",
+			Namespace: key.Namespace,
+			Name:      fmt.Sprintf("%s/srcip/%s", key.Name, ip),
+		}
+		subs[skey] = &PortSourceIP{
+			ChainID: antiSpoofingChainID,
+			IP:      ip,
+		}
+	}
+	if antiSpoofing {
+		name := fmt.Sprintf("%s/srcipv6", key.Name)
+		if ipv6 != nil {
+			name = fmt.Sprintf("%s/%s", name, ipv6)
+		}
+		skey := converter.Key{
+			Kind:      "Pod-SourceIPv6",
+			Namespace: key.Namespace,
+			Name:      name,
+		}
+		subs[skey] = &PortSourceIPv6{
+			ChainID: antiSpoofingChainID,
+			IP:      ipv6,
+		}
 	}
 	macStr, exists := meta.Annotations[converter.MACAnnotation]
 	if exists {
@@ -103,8 +221,19 @@ func (c *podConverter) Convert(key converter.Key, obj interface{}, config *conve
 			PortID:   bridgePortID,
 			MAC:      mac,
 		}
+		if antiSpoofing {
+			skey := converter.Key{
+				Kind:      "Pod-SourceMAC",
+				Namespace: key.Namespace,
+				Name:      fmt.Sprintf("%s/srcmac/%s", key.Name, DNSifyMAC(mac)),
+			}
+			subs[skey] = &PortSourceMAC{
+				ChainID: antiSpoofingChainID,
+				MAC:     mac,
+			}
+		}
 		ip := net.ParseIP(status.PodIP)
-		if ip != nil {
+		if ip != nil && ip.To4() != nil {
 			skey := converter.Key{
 				Kind: "Pod-ARP",
 				Name: fmt.Sprintf("%s/ip/%s/%s", key.Name, ip, DNSifyMAC(mac)),
@@ -118,3 +247,19 @@ func (c *podConverter) Convert(key converter.Key, obj interface{}, config *conve
 	}
 	return res, subs, nil
 }
+
+// parseIPv6Address returns the IPv6 address of the Pod, or nil if
+// it isn't known.
+func parseIPv6Address(annotations map[string]string) net.IP {
+	s, ok := annotations[converter.IPv6AddressAnnotation]
+	if !ok {
+		return nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() != nil {
+		// Not retriable
+		log.WithField("address", s).Errorf("Ignoring invalid %s", converter.IPv6AddressAnnotation)
+		return nil
+	}
+	return ip
+}
@@ -17,13 +17,17 @@ package pod
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 )
 
 var (
@@ -143,8 +147,8 @@ func TestConverter(t *testing.T) {
 	}}
 	rs, subs, err := c.Convert(key, podAwesome, config)
 	assert.Nil(t, err)
-	assert.Len(t, rs, 2)
-	assert.Len(t, subs, 2)
+	assert.Len(t, rs, 15)
+	assert.Len(t, subs, 6)
 	assert.Contains(t, subs, converter.Key{
 		Kind: "Pod-MAC",
 		Name: "awesome-pod/mac/332211112233",
@@ -205,8 +209,8 @@ func TestConverterNoIP(t *testing.T) {
 	}}
 	rs, subs, err := c.Convert(key, podWithoutIP, config)
 	assert.Nil(t, err)
-	assert.Len(t, rs, 2)
-	assert.Len(t, subs, 1)
+	assert.Len(t, rs, 15)
+	assert.Len(t, subs, 3)
 	assert.Contains(t, subs, converter.Key{
 		Kind: "Pod-MAC",
 		Name: "awesome-pod/mac/332211112233",
@@ -229,8 +233,8 @@ func TestConverterWithoutMACAnnotation(t *testing.T) {
 	}}
 	rs, subs, err := c.Convert(key, podLessAwesome, config)
 	assert.Nil(t, err)
-	assert.Len(t, rs, 2)
-	assert.Len(t, subs, 0)
+	assert.Len(t, rs, 15)
+	assert.Len(t, subs, 3)
 }
 
 func TestConverterNoNode(t *testing.T) {
@@ -284,3 +288,476 @@ func TestConverterHostNetwork(t *testing.T) {
 	assert.Len(t, rs, 0)
 	assert.Len(t, subs, 0)
 }
+
+func TestConverterFilterChains(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Pod",
+		Namespace: "foo",
+		Name:      "awesome-pod",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &podConverter{nodeGetter: &objGetter{
+		objs: map[string]interface{}{
+			"awesome-node": nodeAwesome,
+		},
+	}}
+	rs, subs, err := c.Convert(key, podAwesome, config)
+	assert.Nil(t, err)
+	jumps := make(map[uuid.UUID][]uuid.UUID)
+	var port *midonet.Port
+	for _, r := range rs {
+		switch res := r.(type) {
+		case *midonet.Rule:
+			if res.Type == "jump" {
+				parent := *res.Parent.ID
+				assert.Equal(t, len(jumps[parent])+1, res.Position)
+				jumps[parent] = append(jumps[parent], *res.JumpChainID)
+			}
+		case *midonet.Port:
+			port = res
+		}
+	}
+	for _, dir := range []Direction{Ingress, Egress} {
+		chainID := filterChainID("foo/awesome-pod", dir, config)
+		allowChainID := AllowChainID("foo/awesome-pod", dir, config)
+		denyChainID := DenyChainID("foo/awesome-pod", dir, config)
+		assert.Equal(t, []uuid.UUID{allowChainID, denyChainID}, jumps[chainID])
+	}
+	ingressChainID := filterChainID("foo/awesome-pod", Ingress, config)
+	assert.Equal(t, &ingressChainID, port.OutboundFilterID)
+
+	egressKey := converter.Key{
+		Kind:      "Pod-Egress",
+		Namespace: "foo",
+		Name:      "awesome-pod/egress/10.2.2.2",
+	}
+	assert.Contains(t, subs, egressKey)
+	rs, err = subs[egressKey].Convert(egressKey, config)
+	assert.Nil(t, err)
+	rule := rs[0].(*midonet.Rule)
+	nodeEgressChainID := converter.NodeEgressChainID("awesome-node", config)
+	assert.Equal(t, &nodeEgressChainID, rule.Parent.ID)
+	assert.Equal(t, "10.2.2.2", rule.NWSrcAddress)
+	assert.Equal(t, 32, rule.NWSrcLength)
+	egressChainID := filterChainID("foo/awesome-pod", Egress, config)
+	assert.Equal(t, &egressChainID, rule.JumpChainID)
+}
+
+func TestConverterAntiSpoofing(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Pod",
+		Namespace: "foo",
+		Name:      "awesome-pod",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &podConverter{nodeGetter: &objGetter{
+		objs: map[string]interface{}{
+			"awesome-node": nodeAwesome,
+		},
+	}}
+	rs, subs, err := c.Convert(key, podAwesome, config)
+	assert.Nil(t, err)
+	chainID := antiSpoofingChainID("foo/awesome-pod", config)
+	for _, r := range rs {
+		if port, ok := r.(*midonet.Port); ok {
+			assert.Equal(t, &chainID, port.InboundFilterID)
+		}
+	}
+
+	macKey := converter.Key{
+		Kind:      "Pod-SourceMAC",
+		Namespace: "foo",
+		Name:      "awesome-pod/srcmac/332211112233",
+	}
+	assert.Contains(t, subs, macKey)
+	rs, err = subs[macKey].Convert(macKey, config)
+	assert.Nil(t, err)
+	rule := rs[0].(*midonet.Rule)
+	assert.Equal(t, &chainID, rule.Parent.ID)
+	assert.Equal(t, "drop", rule.Type)
+	assert.Equal(t, "33:22:11:11:22:33", rule.DLSrc.String())
+	assert.True(t, rule.InvDLSrc)
+
+	ipKey := converter.Key{
+		Kind:      "Pod-SourceIP",
+		Namespace: "foo",
+		Name:      "awesome-pod/srcip/10.2.2.2",
+	}
+	assert.Contains(t, subs, ipKey)
+	rs, err = subs[ipKey].Convert(ipKey, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 2)
+	for i, dlType := range []int{0x800, 0x806} {
+		rule = rs[i].(*midonet.Rule)
+		assert.Equal(t, &chainID, rule.Parent.ID)
+		assert.Equal(t, "drop", rule.Type)
+		assert.Equal(t, dlType, rule.DLType)
+		assert.Equal(t, "10.2.2.2", rule.NWSrcAddress)
+		assert.Equal(t, 32, rule.NWSrcLength)
+		assert.True(t, rule.InvNWSrc)
+	}
+
+	// Without an IPv6 address, only link-local and unspecified
+	// addresses are allowed.
+	ipv6Key := converter.Key{
+		Kind:      "Pod-SourceIPv6",
+		Namespace: "foo",
+		Name:      "awesome-pod/srcipv6",
+	}
+	assert.Contains(t, subs, ipv6Key)
+	rs, err = subs[ipv6Key].Convert(ipv6Key, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 5)
+	ipv6ChainID := *rs[0].(*midonet.Chain).ID
+	for i, src := range []string{"fe80::/10", "::/128"} {
+		rule = rs[i+1].(*midonet.Rule)
+		assert.Equal(t, &ipv6ChainID, rule.Parent.ID)
+		assert.Equal(t, "return", rule.Type)
+		assert.Equal(t, 0x86dd, rule.DLType)
+		assert.Equal(t, src, fmt.Sprintf("%s/%d", rule.NWSrcAddress, rule.NWSrcLength))
+		assert.Equal(t, i+1, rule.Position)
+	}
+	rule = rs[3].(*midonet.Rule)
+	assert.Equal(t, &ipv6ChainID, rule.Parent.ID)
+	assert.Equal(t, "drop", rule.Type)
+	assert.Equal(t, 0x86dd, rule.DLType)
+	assert.Equal(t, 3, rule.Position)
+	rule = rs[4].(*midonet.Rule)
+	assert.Equal(t, &chainID, rule.Parent.ID)
+	assert.Equal(t, "jump", rule.Type)
+	assert.Equal(t, 0x86dd, rule.DLType)
+	assert.Equal(t, &ipv6ChainID, rule.JumpChainID)
+
+	// Opt out
+	pod := podAwesome.DeepCopy()
+	pod.ObjectMeta.Annotations[converter.AllowSpoofingAnnotation] = "true"
+	_, subs, err = c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 3)
+	assert.NotContains(t, subs, macKey)
+	assert.NotContains(t, subs, ipKey)
+	assert.NotContains(t, subs, ipv6Key)
+}
+
+func TestConverterIPv6PodIP(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Pod",
+		Namespace: "foo",
+		Name:      "awesome-pod",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &podConverter{nodeGetter: &objGetter{
+		objs: map[string]interface{}{
+			"awesome-node": nodeAwesome,
+		},
+	}}
+	pod := podAwesome.DeepCopy()
+	pod.Status.PodIP = "fd00:10:2::2"
+	_, subs, err := c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	for k := range subs {
+		assert.NotEqual(t, "Pod-ARP", k.Kind)
+		assert.NotEqual(t, "Pod-SourceIP", k.Kind)
+	}
+}
+
+func TestConverterIPv6Address(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Pod",
+		Namespace: "foo",
+		Name:      "awesome-pod",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &podConverter{nodeGetter: &objGetter{
+		objs: map[string]interface{}{
+			"awesome-node": nodeAwesome,
+		},
+	}}
+	pod := podAwesome.DeepCopy()
+	pod.ObjectMeta.Annotations[converter.IPv6AddressAnnotation] = "fd00:10:2::2"
+	_, subs, err := c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	assert.Contains(t, subs, converter.Key{
+		Kind:      "Pod-Egress",
+		Namespace: "foo",
+		Name:      "awesome-pod/egress/10.2.2.2",
+	})
+	egressKey := converter.Key{
+		Kind:      "Pod-Egress",
+		Namespace: "foo",
+		Name:      "awesome-pod/egress/fd00:10:2::2",
+	}
+	assert.Contains(t, subs, egressKey)
+	rs, err := subs[egressKey].Convert(egressKey, config)
+	assert.Nil(t, err)
+	rule := rs[0].(*midonet.Rule)
+	assert.Equal(t, 0x86dd, rule.DLType)
+	assert.Equal(t, "fd00:10:2::2", rule.NWSrcAddress)
+	assert.Equal(t, 128, rule.NWSrcLength)
+	egressChainID := filterChainID("foo/awesome-pod", Egress, config)
+	assert.Equal(t, &egressChainID, rule.JumpChainID)
+
+	ipv6Key := converter.Key{
+		Kind:      "Pod-SourceIPv6",
+		Namespace: "foo",
+		Name:      "awesome-pod/srcipv6/fd00:10:2::2",
+	}
+	assert.Contains(t, subs, ipv6Key)
+	rs, err = subs[ipv6Key].Convert(ipv6Key, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 6)
+	rule = rs[1].(*midonet.Rule)
+	assert.Equal(t, "return", rule.Type)
+	assert.Equal(t, "fd00:10:2::2", rule.NWSrcAddress)
+	assert.Equal(t, 128, rule.NWSrcLength)
+	assert.Equal(t, 1, rule.Position)
+	rule = rs[4].(*midonet.Rule)
+	assert.Equal(t, "drop", rule.Type)
+	assert.Equal(t, 4, rule.Position)
+
+	// An IPv4 address in the annotation is ignored.
+	pod.ObjectMeta.Annotations[converter.IPv6AddressAnnotation] = "10.2.2.3"
+	_, subs, err = c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	assert.NotContains(t, subs, converter.Key{
+		Kind:      "Pod-Egress",
+		Namespace: "foo",
+		Name:      "awesome-pod/egress/10.2.2.3",
+	})
+}
+
+func TestConverterBandwidth(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Pod",
+		Namespace: "foo",
+		Name:      "awesome-pod",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	recorder := record.NewFakeRecorder(10)
+	c := &podConverter{
+		nodeGetter: &objGetter{
+			objs: map[string]interface{}{
+				"awesome-node": nodeAwesome,
+			},
+		},
+		recorder: recorder,
+	}
+	portOf := func(rs []converter.BackendResource) *midonet.Port {
+		for _, r := range rs {
+			if port, ok := r.(*midonet.Port); ok {
+				return port
+			}
+		}
+		return nil
+	}
+	bwKey := converter.Key{
+		Kind:      "Pod-BandwidthLimit",
+		Namespace: "foo",
+		Name:      "awesome-pod/egress-bandwidth",
+	}
+
+	// No QoS policy without the annotation.
+	pod := podAwesome.DeepCopy()
+	rs, subs, err := c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	assert.Nil(t, portOf(rs).QOSPolicyID)
+	assert.NotContains(t, subs, bwKey)
+
+	pod.ObjectMeta.Annotations["kubernetes.io/egress-bandwidth"] = "10M"
+	rs2, subs, err := c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	// The list of the resources of the Pod doesn't change.
+	assert.Len(t, rs2, len(rs))
+	policyID := qosPolicyID("foo/awesome-pod", config)
+	assert.Equal(t, &policyID, portOf(rs2).QOSPolicyID)
+	assert.Contains(t, subs, bwKey)
+	rs, err = subs[bwKey].Convert(bwKey, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 2)
+	policy := rs[0].(*midonet.QOSPolicy)
+	assert.Equal(t, &policyID, policy.ID)
+	rule := rs[1].(*midonet.QOSBWLimitRule)
+	assert.Equal(t, &policyID, rule.Parent.ID)
+	assert.Equal(t, 10000, rule.MaxKbps)
+	assert.Len(t, recorder.Events, 0)
+
+	// Invalid values are ignored.
+	pod.ObjectMeta.Annotations["kubernetes.io/egress-bandwidth"] = "foo"
+	rs, subs, err = c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	assert.Nil(t, portOf(rs).QOSPolicyID)
+	assert.NotContains(t, subs, bwKey)
+
+	// Ingress is not supported.
+	delete(pod.ObjectMeta.Annotations, "kubernetes.io/egress-bandwidth")
+	pod.ObjectMeta.Annotations["kubernetes.io/ingress-bandwidth"] = "10M"
+	rs, subs, err = c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	assert.Nil(t, portOf(rs).QOSPolicyID)
+	assert.NotContains(t, subs, bwKey)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning UnsupportedIngressBandwidth")
+}
+
+func TestParseBandwidth(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		kbps int
+		ok   bool
+	}{
+		{"10M", 10000, true},
+		{"1G", 1000000, true},
+		{"1500k", 1500, true},
+		{"100", 0, false},
+		{"foo", 0, false},
+	} {
+		kbps, err := parseBandwidth(tc.s)
+		assert.Equal(t, tc.ok, err == nil, tc.s)
+		assert.Equal(t, tc.kbps, kbps, tc.s)
+	}
+}
+
+func TestConverterHostPort(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Pod",
+		Namespace: "foo",
+		Name:      "awesome-pod",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &podConverter{nodeGetter: &objGetter{
+		objs: map[string]interface{}{
+			"awesome-node": nodeAwesome,
+		},
+	}}
+	pod := podAwesome.DeepCopy()
+	pod.Spec.Containers = []v1.Container{
+		{
+			Ports: []v1.ContainerPort{
+				{ContainerPort: 80, HostPort: 8080},
+				{ContainerPort: 53, HostPort: 53, HostIP: "192.2.0.10", Protocol: v1.ProtocolUDP},
+				{ContainerPort: 443},
+			},
+		},
+	}
+	_, subs, err := c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	var keys []converter.Key
+	for k := range subs {
+		if k.Kind == "Pod-HostPort" {
+			keys = append(keys, k)
+		}
+	}
+	assert.Len(t, keys, 2)
+	chainID := converter.NodeHostPortsChainID("awesome-node", config)
+
+	k := converter.Key{
+		Kind:      "Pod-HostPort",
+		Namespace: "foo",
+		Name:      "awesome-pod/hostport/6/0.0.0.0/8080/10.2.2.2/80",
+	}
+	assert.Contains(t, subs, k)
+	rs, err := subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	rule := rs[0].(*midonet.Rule)
+	assert.Equal(t, &chainID, rule.Parent.ID)
+	assert.Equal(t, "dnat", rule.Type)
+	assert.Equal(t, 6, rule.NWProto)
+	assert.Equal(t, "", rule.NWDstAddress)
+	assert.Equal(t, &midonet.PortRange{Start: 8080, End: 8080}, rule.TPDst)
+	assert.Equal(t, &[]midonet.NATTarget{
+		{AddressFrom: "10.2.2.2", AddressTo: "10.2.2.2", PortFrom: 80, PortTo: 80},
+	}, rule.NATTargets)
+
+	k = converter.Key{
+		Kind:      "Pod-HostPort",
+		Namespace: "foo",
+		Name:      "awesome-pod/hostport/17/192.2.0.10/53/10.2.2.2/53",
+	}
+	assert.Contains(t, subs, k)
+	rs, err = subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	rule = rs[0].(*midonet.Rule)
+	assert.Equal(t, 17, rule.NWProto)
+	assert.Equal(t, "192.2.0.10", rule.NWDstAddress)
+	assert.Equal(t, 32, rule.NWDstLength)
+}
+
+func TestConverterNetworks(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Pod",
+		Namespace: "foo",
+		Name:      "awesome-pod",
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &podConverter{nodeGetter: &objGetter{
+		objs: map[string]interface{}{
+			"awesome-node": nodeAwesome,
+		},
+	}}
+	pod := podAwesome.DeepCopy()
+	pod.ObjectMeta.Annotations[converter.NetworksAnnotation] = `[
+		{"bridge": "0B0AF1D5-6C4F-4D05-A2B2-3C8CE6D5F58E", "address": "192.168.10.5/24"},
+		{"bridge": "2DD3D0A8-7D0B-4C9E-9F6B-0A6A1D3F0E11", "interface": "storage"}
+	]`
+	_, subs, err := c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	netKey := converter.Key{
+		Kind:      "Pod-Network",
+		Namespace: "foo",
+		Name:      "awesome-pod/network/eth1/0B0AF1D5-6C4F-4D05-A2B2-3C8CE6D5F58E",
+	}
+	assert.Contains(t, subs, netKey)
+	assert.Contains(t, subs, converter.Key{
+		Kind:      "Pod-Network",
+		Namespace: "foo",
+		Name:      "awesome-pod/network/storage/2DD3D0A8-7D0B-4C9E-9F6B-0A6A1D3F0E11",
+	})
+	rs, err := subs[netKey].Convert(netKey, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 2)
+	port := rs[0].(*midonet.Port)
+	bridgeID, _ := uuid.Parse("0B0AF1D5-6C4F-4D05-A2B2-3C8CE6D5F58E")
+	assert.Equal(t, &bridgeID, port.Parent.ID)
+	binding := rs[1].(*midonet.HostInterfacePort)
+	assert.Equal(t, port.ID, binding.PortID)
+	assert.Equal(t, "44fb4381-c99d-4389-86c3-fdca765bcbde", binding.HostID.String())
+	assert.Equal(t, IFNameForKey("foo/awesome-pod/eth1"), binding.InterfaceName)
+	assert.NotEqual(t, IFNameForKey("foo/awesome-pod"), binding.InterfaceName)
+
+	// Invalid values are ignored.
+	pod.ObjectMeta.Annotations[converter.NetworksAnnotation] = "foo"
+	_, subs, err = c.Convert(key, pod, config)
+	assert.Nil(t, err)
+	assert.NotContains(t, subs, netKey)
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks(map[string]string{})
+	assert.Nil(t, err)
+	assert.Len(t, networks, 0)
+	for _, s := range []string{
+		`{}`,
+		`[{"bridge": "foo"}]`,
+		`[{"bridge": "0B0AF1D5-6C4F-4D05-A2B2-3C8CE6D5F58E", "interface": "too-long-interface"}]`,
+		`[{"bridge": "0B0AF1D5-6C4F-4D05-A2B2-3C8CE6D5F58E", "address": "192.168.10.5"}]`,
+		`[{"bridge": "0B0AF1D5-6C4F-4D05-A2B2-3C8CE6D5F58E", "address": "fd00::5/64"}]`,
+		`[{"bridge": "0B0AF1D5-6C4F-4D05-A2B2-3C8CE6D5F58E"}, {"bridge": "0B0AF1D5-6C4F-4D05-A2B2-3C8CE6D5F58E", "interface": "eth1"}]`,
+	} {
+		_, err := ParseNetworks(map[string]string{converter.NetworksAnnotation: s})
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package pod
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+// Each Pod has filter chains for the traffic to the Pod (ingress)
+// and for the traffic from the Pod (egress).  Each of them has the
+// fixed set of rules:
+//
+//	1. jump to the allow chain
+//	2. jump to the deny chain
+//
+// The allow chain accepts return flows.  Otherwise, these allow and
+// deny chains are empty unless the networkpolicy controller adds rules
+// to them.  As the rules in each of the allow and deny chains have
+// the same action, the order of them doesn't matter.
+//
+// The ingress chain is the outbound filter of the Pod port, in MidoNet
+// terms.  The egress chain is not the inbound filter of the Pod port.
+// Instead, it's reached from the outbound filter of the Node Bridge
+// so that it sees the traffic after DNAT for Services.
+
+// Direction is the direction of the traffic, from the Pod's viewpoint.
+type Direction string
+
+const (
+	// Ingress is the traffic to the Pod.
+	Ingress = Direction("Ingress")
+	// Egress is the traffic from the Pod.
+	Egress = Direction("Egress")
+)
+
+func filterChainID(key string, dir Direction, config *converter.Config) uuid.UUID {
+	return converter.SubID(idForKey(key, config), fmt.Sprintf("%s Chain", dir))
+}
+
+// AllowChainID returns the ID of the Chain which accepts the traffic
+// to or from the Pod with the given key.
+func AllowChainID(key string, dir Direction, config *converter.Config) uuid.UUID {
+	return converter.SubID(idForKey(key, config), fmt.Sprintf("%s Allow Chain", dir))
+}
+
+// DenyChainID returns the ID of the Chain which drops the traffic
+// to or from the Pod with the given key, if the traffic was not accepted
+// by the allow chain.
+func DenyChainID(key string, dir Direction, config *converter.Config) uuid.UUID {
+	return converter.SubID(idForKey(key, config), fmt.Sprintf("%s Deny Chain", dir))
+}
+
+func filterChains(key converter.Key, dir Direction, config *converter.Config) []converter.BackendResource {
+	chainID := filterChainID(key.Key(), dir, config)
+	allowChainID := AllowChainID(key.Key(), dir, config)
+	denyChainID := DenyChainID(key.Key(), dir, config)
+	allowRuleID := converter.SubID(chainID, "Allow")
+	denyRuleID := converter.SubID(chainID, "Deny")
+	returnFlowRuleID := converter.SubID(allowChainID, "Return Flow")
+	prefix := fmt.Sprintf("KUBE-POD-%s", strings.ToUpper(string(dir)))
+	return []converter.BackendResource{
+		&midonet.Chain{
+			ID:       &allowChainID,
+			Name:     fmt.Sprintf("%s-ALLOW-%s", prefix, key.Key()),
+			TenantID: config.Tenant,
+		},
+		&midonet.Chain{
+			ID:       &denyChainID,
+			Name:     fmt.Sprintf("%s-DENY-%s", prefix, key.Key()),
+			TenantID: config.Tenant,
+		},
+		&midonet.Chain{
+			ID:       &chainID,
+			Name:     fmt.Sprintf("%s-%s", prefix, key.Key()),
+			TenantID: config.Tenant,
+		},
+		&midonet.Rule{
+			Parent:          midonet.Parent{ID: &allowChainID},
+			ID:              &returnFlowRuleID,
+			Type:            "accept",
+			MatchReturnFlow: true,
+		},
+		&midonet.Rule{
+			Parent:      midonet.Parent{ID: &chainID},
+			ID:          &allowRuleID,
+			Type:        "jump",
+			JumpChainID: &allowChainID,
+			Position:    1,
+		},
+		&midonet.Rule{
+			Parent:      midonet.Parent{ID: &chainID},
+			ID:          &denyRuleID,
+			Type:        "jump",
+			JumpChainID: &denyChainID,
+			Position:    2,
+		},
+	}
+}
+
+// PortEgress is a sub resource to represent a rule to dispatch the traffic
+// from the Pod to its egress chain, in the egress chain of the Node.
+type PortEgress struct {
+	NodeEgressChainID uuid.UUID
+	ChainID           uuid.UUID
+	IP                net.IP
+}
+
+func (p *PortEgress) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	ruleID := converter.IDForKey("PodEgress", key.Key(), config)
+	return []converter.BackendResource{
+		&midonet.Rule{
+			Parent:       midonet.Parent{ID: &p.NodeEgressChainID},
+			ID:           &ruleID,
+			Type:         "jump",
+			DLType:       converter.EtherType(p.IP),
+			NWSrcAddress: p.IP.String(),
+			NWSrcLength:  converter.HostPrefixLength(p.IP),
+			JumpChainID:  &p.ChainID,
+		},
+	}, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package pod
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+// hostPorts adds sub resources for hostPorts of the Pod.
+func hostPorts(subs converter.SubResourceMap, key converter.Key, spec *v1.PodSpec, ip net.IP, config *converter.Config) {
+	chainID := converter.NodeHostPortsChainID(spec.NodeName, config)
+	for _, c := range spec.Containers {
+		for _, p := range c.Ports {
+			if p.HostPort == 0 {
+				continue
+			}
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = v1.ProtocolTCP
+			}
+			proto, err := converter.ProtocolNumber(protocol)
+			if err != nil {
+				log.WithError(err).WithField("key", key).Warn("Ignoring a hostPort with an unsupported protocol")
+				continue
+			}
+			// An unspecified hostIP means any addresses of the Node.
+			hostIP := net.IPv4zero
+			if p.HostIP != "" {
+				hostIP = net.ParseIP(p.HostIP)
+				if hostIP == nil || hostIP.To4() == nil {
+					// We only support IPv4.
+					log.WithField("key", key).Warnf("Ignoring a hostPort with an unsupported hostIP %s", p.HostIP)
+					continue
+				}
+			}
+			skey := converter.Key{
+				Kind:      "Pod-HostPort",
+				Namespace: key.Namespace,
+				Name:      fmt.Sprintf("%s/hostport/%d/%s/%d/%s/%d", key.Name, proto, hostIP, p.HostPort, ip, p.ContainerPort),
+			}
+			subs[skey] = &PortHostPort{
+				ChainID:       chainID,
+				Protocol:      proto,
+				HostIP:        hostIP,
+				HostPort:      int(p.HostPort),
+				IP:            ip,
+				ContainerPort: int(p.ContainerPort),
+			}
+		}
+	}
+}
+
+// PortHostPort is a sub resource to represent a rule to DNAT
+// the traffic to a hostPort on the Node to the Pod.
+// The reverse is done by the REV_DNAT rule in the global Chain.
+type PortHostPort struct {
+	ChainID       uuid.UUID
+	Protocol      int
+	HostIP        net.IP
+	HostPort      int
+	IP            net.IP
+	ContainerPort int
+}
+
+func (p *PortHostPort) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	ruleID := converter.IDForKey("PodHostPort", key.Key(), config)
+	rule := &midonet.Rule{
+		Parent:  midonet.Parent{ID: &p.ChainID},
+		ID:      &ruleID,
+		Type:    "dnat",
+		DLType:  converter.EtherTypeIPv4,
+		NWProto: p.Protocol,
+		TPDst:   &midonet.PortRange{Start: p.HostPort, End: p.HostPort},
+		NATTargets: &[]midonet.NATTarget{
+			{
+				AddressFrom: p.IP.String(),
+				AddressTo:   p.IP.String(),
+				PortFrom:    p.ContainerPort,
+				PortTo:      p.ContainerPort,
+			},
+		},
+		FlowAction: "accept",
+	}
+	if !p.HostIP.IsUnspecified() {
+		rule.NWDstAddress = p.HostIP.String()
+		rule.NWDstLength = 32
+	}
+	return []converter.BackendResource{rule}, nil
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package pod
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+// maxIFNameLen is the maximum length of Linux interface names.
+const maxIFNameLen = 15
+
+// Network is an additional network interface of a Pod.
+// See converter.NetworksAnnotation.
+type Network struct {
+	// Bridge is the ID of the MidoNet Bridge to attach the interface.
+	Bridge string `json:"bridge"`
+
+	// Interface is the name of the interface in the Pod.
+	// Defaults to "eth1", "eth2", ... in the order.
+	Interface string `json:"interface,omitempty"`
+
+	// Address is an optional IPv4 address with the prefix length,
+	// e.g. "192.168.10.5/24", to assign to the interface.
+	Address string `json:"address,omitempty"`
+}
+
+// ParseNetworks parses converter.NetworksAnnotation in the given
+// annotations, filling the default interface names.
+func ParseNetworks(annotations map[string]string) ([]Network, error) {
+	s, exists := annotations[converter.NetworksAnnotation]
+	if !exists {
+		return nil, nil
+	}
+	var networks []Network
+	if err := json.Unmarshal([]byte(s), &networks); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i := range networks {
+		n := &networks[i]
+		if _, err := uuid.Parse(n.Bridge); err != nil {
+			return nil, fmt.Errorf("invalid bridge %q: %v", n.Bridge, err)
+		}
+		if n.Interface == "" {
+			n.Interface = fmt.Sprintf("eth%d", i+1)
+		}
+		if len(n.Interface) > maxIFNameLen {
+			return nil, fmt.Errorf("interface name %q is too long", n.Interface)
+		}
+		if seen[n.Interface] {
+			return nil, fmt.Errorf("duplicate interface name %q", n.Interface)
+		}
+		seen[n.Interface] = true
+		if n.Address != "" {
+			ip, _, err := net.ParseCIDR(n.Address)
+			if err != nil {
+				return nil, err
+			}
+			if ip.To4() == nil {
+				return nil, fmt.Errorf("address %q is not IPv4", n.Address)
+			}
+		}
+	}
+	return networks, nil
+}
+
+// NetworkIFNameForKey returns a deterministic host side interface name
+// for the additional network interface of the Pod.
+func NetworkIFNameForKey(key string, ifName string) string {
+	return IFNameForKey(fmt.Sprintf("%s/%s", key, ifName))
+}
+
+// PortNetwork is a sub resource to represent the Bridge Port for
+// an additional network interface of a Pod.
+type PortNetwork struct {
+	BridgeID      uuid.UUID
+	HostID        uuid.UUID
+	InterfaceName string
+}
+
+func (p *PortNetwork) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	portID := converter.IDForKey("Pod Network", key.Key(), config)
+	return []converter.BackendResource{
+		&midonet.Port{
+			Parent: midonet.Parent{ID: &p.BridgeID},
+			ID:     &portID,
+			Type:   "Bridge",
+		},
+		&midonet.HostInterfacePort{
+			Parent:        midonet.Parent{ID: &p.HostID},
+			HostID:        &p.HostID,
+			PortID:        &portID,
+			InterfaceName: p.InterfaceName,
+		},
+	}, nil
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package pod
+
+import (
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+)
+
+// nodeNameIndex is the name of the Pod index by spec.nodeName.
+const nodeNameIndex = "spec.nodeName"
+
+func indexByNodeName(obj interface{}) ([]string, error) {
+	p, ok := obj.(*v1.Pod)
+	if !ok || p.Spec.NodeName == "" {
+		return nil, nil
+	}
+	return []string{p.Spec.NodeName}, nil
+}
+
+// newNodeEventHandler creates an event handler which queues Pods on
+// a Node when the Node annotations the pod converter uses might have
+// been changed.  Otherwise, Pods which failed to convert because of
+// the missing HostIDAnnotation would wait for rate-limited retries.
+func newNodeEventHandler(podIndexer cache.Indexer, queue workqueue.Interface) cache.ResourceEventHandler {
+	queuePods := func(nodeName string) {
+		objs, err := podIndexer.ByIndex(nodeNameIndex, nodeName)
+		if err != nil {
+			log.WithError(err).WithField("node", nodeName).Error("Failed to list Pods on the Node")
+			return
+		}
+		for _, obj := range objs {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err != nil {
+				continue
+			}
+			log.WithField("key", key).Debug("Queueing for Node changes")
+			queue.Add(key)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			queuePods(obj.(*v1.Node).Name)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			// Ignore Node updates which don't change the host ID.
+			// Node status updates happen periodically.
+			oldNode := old.(*v1.Node)
+			newNode := new.(*v1.Node)
+			oldHostID := oldNode.Annotations[converter.HostIDAnnotation]
+			newHostID := newNode.Annotations[converter.HostIDAnnotation]
+			if oldHostID == newHostID {
+				return
+			}
+			queuePods(newNode.Name)
+		},
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package pod
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+)
+
+func newNodeHandlerTestPod(ns, name, nodeName string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+		},
+		Spec: v1.PodSpec{
+			NodeName: nodeName,
+		},
+	}
+}
+
+func TestNodeEventHandler(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{nodeNameIndex: indexByNodeName})
+	indexer.Add(newNodeHandlerTestPod("foo", "pod1", "node1"))
+	indexer.Add(newNodeHandlerTestPod("bar", "pod2", "node1"))
+	indexer.Add(newNodeHandlerTestPod("foo", "pod3", "node2"))
+	indexer.Add(newNodeHandlerTestPod("foo", "pod4", ""))
+	queue := workqueue.New()
+	defer queue.ShutDown()
+	h := newNodeEventHandler(indexer, queue).(cache.ResourceEventHandlerFuncs)
+
+	oldNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node1",
+		},
+	}
+	newNode := oldNode.DeepCopy()
+	newNode.Status.Phase = v1.NodeRunning
+	h.UpdateFunc(oldNode, newNode)
+	assert.Equal(t, 0, queue.Len())
+
+	newNode.Annotations = map[string]string{
+		converter.HostIDAnnotation: "44FB4381-C99D-4389-86C3-FDCA765BCBDE",
+	}
+	h.UpdateFunc(oldNode, newNode)
+	assert.Equal(t, 2, queue.Len())
+	var keys []string
+	for queue.Len() > 0 {
+		key, _ := queue.Get()
+		keys = append(keys, key.(string))
+		queue.Done(key)
+	}
+	assert.ElementsMatch(t, []string{"foo/pod1", "bar/pod2"}, keys)
+
+	h.AddFunc(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}})
+	assert.Equal(t, 1, queue.Len())
+}
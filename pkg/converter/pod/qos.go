@@ -0,0 +1,83 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package pod
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
+)
+
+const (
+	// ingressBandwidthAnnotation is the well-known annotation to limit
+	// the bandwidth of the traffic to the Pod.
+	ingressBandwidthAnnotation = "kubernetes.io/ingress-bandwidth"
+
+	// egressBandwidthAnnotation is the well-known annotation to limit
+	// the bandwidth of the traffic from the Pod.
+	egressBandwidthAnnotation = "kubernetes.io/egress-bandwidth"
+)
+
+// A Pod port has a QoS policy only if the Pod has egressBandwidthAnnotation.
+// The policy is a part of the PortBandwidthLimit sub resource, rather than
+// the Pod's own Translation, so that it's deleted when the annotation is
+// removed.
+// Note: A MidoNet bandwidth limit rule only limits the traffic from
+// the port.  Thus ingressBandwidthAnnotation is not supported.
+
+func qosPolicyID(key string, config *converter.Config) uuid.UUID {
+	return converter.SubID(idForKey(key, config), "QoS Policy")
+}
+
+// parseBandwidth parses a bandwidth annotation value, e.g. "10M",
+// in bits per second and returns it in kbps.
+func parseBandwidth(s string) (int, error) {
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	kbps := q.Value() / 1000
+	if kbps < 1 {
+		return 0, fmt.Errorf("bandwidth %s is too small", s)
+	}
+	return int(kbps), nil
+}
+
+// PortBandwidthLimit is a sub resource to represent the QoS policy
+// with a bandwidth limit rule for the traffic from the Pod.
+type PortBandwidthLimit struct {
+	PolicyID uuid.UUID
+	MaxKbps  int
+}
+
+func (p *PortBandwidthLimit) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	ruleID := converter.IDForKey("PodBandwidthLimit", key.Key(), config)
+	return []converter.BackendResource{
+		&midonet.QOSPolicy{
+			ID:   &p.PolicyID,
+			Name: fmt.Sprintf("KUBE-POD-%s", key.Key()),
+		},
+		&midonet.QOSBWLimitRule{
+			Parent:  midonet.Parent{ID: &p.PolicyID},
+			ID:      &ruleID,
+			MaxKbps: p.MaxKbps,
+		},
+	}, nil
+}
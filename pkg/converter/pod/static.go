@@ -0,0 +1,69 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package pod
+
+import (
+	"fmt"
+	"net"
+)
+
+// ParseStaticIP parses the value of converter.StaticIPAnnotation.
+// The address should be an IPv4 address in the subnet, other than
+// the reserved ones.
+func ParseStaticIP(s string, subnet *net.IPNet, reserved ...net.IP) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid IPv4 address %q", s)
+	}
+	ip = ip.To4()
+	if !subnet.Contains(ip) {
+		return nil, fmt.Errorf("%s is not in %s", ip, subnet)
+	}
+	ones, bits := subnet.Mask.Size()
+	if bits-ones > 1 {
+		network := ip.Mask(subnet.Mask)
+		broadcast := make(net.IP, len(network))
+		for i := range network {
+			broadcast[i] = network[i] | ^subnet.Mask[len(subnet.Mask)-len(network)+i]
+		}
+		reserved = append(reserved, network, broadcast)
+	}
+	for _, r := range reserved {
+		if ip.Equal(r) {
+			return nil, fmt.Errorf("%s is reserved", ip)
+		}
+	}
+	return ip, nil
+}
+
+// ParseStaticMAC parses the value of converter.StaticMACAnnotation.
+// The address should be a unicast Ethernet address.
+func ParseStaticMAC(s string) (net.HardwareAddr, error) {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("%s is not an Ethernet address", mac)
+	}
+	if mac[0]&1 != 0 {
+		return nil, fmt.Errorf("%s is not a unicast address", mac)
+	}
+	if mac.String() == "00:00:00:00:00:00" {
+		return nil, fmt.Errorf("%s is not a valid address", mac)
+	}
+	return mac, nil
+}
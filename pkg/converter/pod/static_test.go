@@ -0,0 +1,65 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package pod
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseStaticIP(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.1.2.0/24")
+	gateway := net.ParseIP("10.1.2.1")
+	for _, tc := range []struct {
+		s  string
+		ok bool
+	}{
+		{"10.1.2.10", true},
+		{"10.1.2.254", true},
+		{"10.1.2.1", false},
+		{"10.1.2.0", false},
+		{"10.1.2.255", false},
+		{"10.1.3.10", false},
+		{"fd00::10", false},
+		{"foo", false},
+	} {
+		ip, err := ParseStaticIP(tc.s, subnet, gateway)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: got %v\nwant ok=%v", tc.s, err, tc.ok)
+		}
+		if tc.ok && !ip.Equal(net.ParseIP(tc.s)) {
+			t.Errorf("got %v\nwant %v", ip, tc.s)
+		}
+	}
+}
+
+func TestParseStaticMAC(t *testing.T) {
+	for _, tc := range []struct {
+		s  string
+		ok bool
+	}{
+		{"02:42:ac:11:00:02", true},
+		{"01:00:5e:00:00:01", false},
+		{"00:00:00:00:00:00", false},
+		{"00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10:00:00:00:01", false},
+		{"foo", false},
+	} {
+		_, err := ParseStaticMAC(tc.s)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: got %v\nwant ok=%v", tc.s, err, tc.ok)
+		}
+	}
+}
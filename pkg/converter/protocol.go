@@ -0,0 +1,70 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package converter
+
+import (
+	"fmt"
+	"net"
+
+	"k8s.io/api/core/v1"
+)
+
+// Ethertypes to match IPv4, ARP and IPv6 with midonet.Rule DLType.
+const (
+	EtherTypeIPv4 = 0x800
+	EtherTypeARP  = 0x806
+	EtherTypeIPv6 = 0x86DD
+)
+
+// ProtocolNumber returns the IP protocol number for the given
+// Kubernetes protocol.
+func ProtocolNumber(protocol v1.Protocol) (int, error) {
+	// Note: Use string literals rather than v1.ProtocolSCTP etc
+	// to avoid depending on a particular version of k8s.io/api.
+	switch protocol {
+	case "TCP":
+		return 6, nil
+	case "UDP":
+		return 17, nil
+	case "SCTP":
+		return 132, nil
+	}
+	return 0, fmt.Errorf("Unsupported protocol %q", protocol)
+}
+
+// EtherType returns the ethertype of the traffic for the given
+// IP address.
+func EtherType(ip net.IP) int {
+	if ip.To4() != nil {
+		return EtherTypeIPv4
+	}
+	return EtherTypeIPv6
+}
+
+// HostPrefixLength returns the prefix length to match the given
+// IP address alone.
+func HostPrefixLength(ip net.IP) int {
+	if ip.To4() != nil {
+		return 32
+	}
+	return 128
+}
+
+// SameFamily returns true if the given IP addresses are both IPv4 or
+// both IPv6.
+func SameFamily(a, b net.IP) bool {
+	return (a.To4() != nil) == (b.To4() != nil)
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package converter
+
+import (
+	"net"
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestProtocolNumber(t *testing.T) {
+	for proto, expected := range map[v1.Protocol]int{
+		"TCP":  6,
+		"UDP":  17,
+		"SCTP": 132,
+	} {
+		actual, err := ProtocolNumber(proto)
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		if actual != expected {
+			t.Errorf("got %v\nwant %v", actual, expected)
+		}
+	}
+}
+
+func TestProtocolNumberUnsupported(t *testing.T) {
+	_, err := ProtocolNumber("DCCP")
+	if err == nil {
+		t.Errorf("unexpected success")
+	}
+}
+
+func TestEtherType(t *testing.T) {
+	for ip, expected := range map[string]int{
+		"10.0.0.1":    0x800,
+		"fd00:96::10": 0x86dd,
+	} {
+		actual := EtherType(net.ParseIP(ip))
+		if actual != expected {
+			t.Errorf("%s: got %v\nwant %v", ip, actual, expected)
+		}
+	}
+}
+
+func TestHostPrefixLength(t *testing.T) {
+	for ip, expected := range map[string]int{
+		"10.0.0.1":    32,
+		"fd00:96::10": 128,
+	} {
+		actual := HostPrefixLength(net.ParseIP(ip))
+		if actual != expected {
+			t.Errorf("%s: got %v\nwant %v", ip, actual, expected)
+		}
+	}
+}
+
+func TestSameFamily(t *testing.T) {
+	v4 := net.ParseIP("10.0.0.1")
+	v6 := net.ParseIP("fd00:96::10")
+	if !SameFamily(v4, net.ParseIP("192.2.0.1")) {
+		t.Errorf("IPv4 addresses are not the same family")
+	}
+	if !SameFamily(v6, net.ParseIP("::1")) {
+		t.Errorf("IPv6 addresses are not the same family")
+	}
+	if SameFamily(v4, v6) {
+		t.Errorf("IPv4 and IPv6 addresses are the same family")
+	}
+}
@@ -31,8 +31,12 @@ import (
 // NewController creates a service controller.
 func NewController(si informers.SharedInformerFactory, msi mninformers.SharedInformerFactory, kc *kubernetes.Clientset, mc *mncli.Clientset, recorder record.EventRecorder, config *converter.Config, _ *midonet.Config) *controller.Controller {
 	informer := si.Core().V1().Services().Informer()
+	nodeInformer := si.Core().V1().Nodes().Informer()
 	updater := converter.NewTranslationUpdater(mc, recorder)
-	handler := converter.NewHandler(newServiceConverter(), updater, config)
+	handler := converter.NewHandler(newServiceConverter(nodeInformer, recorder), updater, config)
 	gvk := v1.SchemeGroupVersion.WithKind("Service")
-	return controller.NewController(gvk, informer, handler)
+	c := controller.NewController(gvk, informer, handler)
+	// Kick NodePort Services when Node addresses are changed.
+	nodeInformer.AddEventHandler(newNodeEventHandler(informer.GetIndexer(), c.GetQueue()))
+	return c
 }
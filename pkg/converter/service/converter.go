@@ -17,50 +17,160 @@ package service
 
 import (
 	"fmt"
+	"hash/fnv"
+	"net"
+	"sort"
 
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/converter/node"
+	"github.com/midonet/midonet-kubernetes/pkg/k8s"
 	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 )
 
-type serviceConverter struct{}
+type serviceConverter struct {
+	nodeLister cache.KeyListerGetter
+	recorder   record.EventRecorder
+}
+
+func newServiceConverter(nodeInformer cache.SharedIndexInformer, recorder record.EventRecorder) converter.Converter {
+	return &serviceConverter{
+		nodeLister: nodeInformer.GetIndexer(),
+		recorder:   recorder,
+	}
+}
+
+// Translatable returns true if a Service with the given spec is
+// translated by this package.  That is, the Service has a ClusterIP
+// and is of a type we support.
+// The endpoints converter uses this to ignore Endpoints for other Services.
+func Translatable(spec *v1.ServiceSpec) bool {
+	switch spec.Type {
+	case v1.ServiceTypeClusterIP, v1.ServiceTypeNodePort, v1.ServiceTypeLoadBalancer:
+	default:
+		return false
+	}
+	svcIP := spec.ClusterIP
+	if svcIP == "" || svcIP == v1.ClusterIPNone {
+		return false
+	}
+	return net.ParseIP(svcIP) != nil
+}
+
+// hasNodePorts returns true if a Service with the given spec has
+// NodePorts allocated.
+func hasNodePorts(spec *v1.ServiceSpec) bool {
+	typ := spec.Type
+	return typ == v1.ServiceTypeNodePort || typ == v1.ServiceTypeLoadBalancer
+}
 
-func newServiceConverter() converter.Converter {
-	return &serviceConverter{}
+// LocalChainID returns the ID of the MidoNet Chain for the traffic to
+// the service port received by the Node.  It's used for the Services
+// with externalTrafficPolicy=Local.  See serviceLocalChain.
+func LocalChainID(portKey string, nodeName string, config *converter.Config) uuid.UUID {
+	return converter.IDForKey("ServicePortLocal", fmt.Sprintf("%s/%s", portKey, nodeName), config)
 }
 
-func (*serviceConverter) Convert(key converter.Key, obj interface{}, config *converter.Config) ([]converter.BackendResource, converter.SubResourceMap, error) {
+// LocalEndpointsChainID returns the ID of the MidoNet Chain for
+// the endpoints of the service port which are local to the Node.
+// The endpoints converter populates the chain.
+func LocalEndpointsChainID(portKey string, nodeName string, config *converter.Config) uuid.UUID {
+	return converter.IDForKey("ServicePortLocalEndpoints", fmt.Sprintf("%s/%s", portKey, nodeName), config)
+}
+
+// nodeIPs returns the addresses of all known Nodes, keyed with
+// Node names.
+func (c *serviceConverter) nodeIPs() (map[string][]net.IP, error) {
+	ips := make(map[string][]net.IP)
+	for _, k := range c.nodeLister.ListKeys() {
+		obj, exists, err := c.nodeLister.GetByKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		n := obj.(*v1.Node)
+		ips[n.ObjectMeta.Name] = node.Addresses(n)
+	}
+	return ips, nil
+}
+
+// affinityTimeout returns the timeout of ClientIP session affinity
+// of the Service, if any.
+func affinityTimeout(spec *v1.ServiceSpec) *int32 {
+	if spec.SessionAffinity != v1.ServiceAffinityClientIP {
+		return nil
+	}
+	config := spec.SessionAffinityConfig
+	if config == nil || config.ClientIP == nil {
+		return nil
+	}
+	return config.ClientIP.TimeoutSeconds
+}
+
+func (c *serviceConverter) Convert(key converter.Key, obj interface{}, config *converter.Config) ([]converter.BackendResource, converter.SubResourceMap, error) {
 	resources := make([]converter.BackendResource, 0)
 	subs := make(converter.SubResourceMap)
-	spec := obj.(*v1.Service).Spec
+	svc := obj.(*v1.Service)
+	spec := svc.Spec
+	status := svc.Status
 	svcIP := spec.ClusterIP
-	if spec.Type != v1.ServiceTypeClusterIP || svcIP == "" || svcIP == v1.ClusterIPNone {
+	if !Translatable(&spec) {
 		return resources, nil, nil
 	}
+	// Only the addresses of the same family as the ClusterIP are
+	// translated below, as the endpoints are of the family.
+	clusterIP := net.ParseIP(svcIP)
+	if timeout := affinityTimeout(&spec); timeout != nil && *timeout != v1.DefaultClientIPServiceAffinitySeconds {
+		// The affinity is implemented by splitting the traffic by
+		// source addresses.  See pkg/converter/endpoints.  It doesn't
+		// time out.
+		log.WithField("service", key).Warn("Ignoring sessionAffinityConfig.clientIP.timeoutSeconds")
+		ref, err := k8s.GetReferenceForEvent(svc)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.recorder.Eventf(ref, v1.EventTypeWarning, "UnsupportedSessionAffinityTimeout", "sessionAffinityConfig.clientIP.timeoutSeconds %d is not supported", *timeout)
+	}
+	local := spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal
+	var nodeIPs map[string][]net.IP
+	if hasNodePorts(&spec) {
+		var err error
+		nodeIPs, err = c.nodeIPs()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 	for _, p := range spec.Ports {
 		// Note: portKey format should be consistent with the
 		// endpoints converter so that it can find the right chain
 		// to add rules. (portChainID)
 		// NameSpace/Name/ServicePort.Name
 		portKey := fmt.Sprintf("%s/%s", key.Key(), p.Name)
+		proto, err := converter.ProtocolNumber(p.Protocol)
+		if err != nil {
+			// Skip the port.  It isn't retriable until the Service
+			// is updated.
+			log.WithError(err).WithField("service", key).Warn("Ignoring a ServicePort")
+			ref, err := k8s.GetReferenceForEvent(svc)
+			if err != nil {
+				return nil, nil, err
+			}
+			c.recorder.Eventf(ref, v1.EventTypeWarning, "UnsupportedProtocol", "ServicePort %q has unsupported protocol %q", p.Name, p.Protocol)
+			continue
+		}
 		portChainID := converter.IDForKey("ServicePort", portKey, config)
 		resources = append(resources, &midonet.Chain{
 			ID:       &portChainID,
 			Name:     fmt.Sprintf("KUBE-SVC-%s", portKey),
 			TenantID: config.Tenant,
 		})
-
-		var proto int
-		switch p.Protocol {
-		case "TCP":
-			proto = 6
-		case "UDP":
-			proto = 17
-		default:
-			log.WithField("protocol", p.Protocol).Fatal("Unknown protocol")
-		}
 		port := int(p.Port)
 		// Use a separate key for sub resource so that those will
 		// be deleted and re-created whenever they got changed.
@@ -73,7 +183,117 @@ func (*serviceConverter) Convert(key converter.Key, obj interface{}, config *con
 			Kind: "Service-Port",
 			Name: fmt.Sprintf("%s/%s/%d/%d", portKey, svcIP, proto, port),
 		}
-		subs[k] = &servicePort{portKey, svcIP, proto, port}
+		subs[k] = &servicePort{portKey: portKey, ip: svcIP, proto: proto, port: port}
+
+		// With externalTrafficPolicy=Local, the traffic received by
+		// a Node is redirected to the chain for the endpoints local
+		// to the Node, rather than the KUBE-SVC- chain.
+		var localNodes []string
+		if local {
+			for nodeName := range nodeIPs {
+				localNodes = append(localNodes, nodeName)
+				k := converter.Key{
+					Kind: "Service-Local",
+					Name: fmt.Sprintf("%s/%s", portKey, nodeName),
+				}
+				subs[k] = &serviceLocalChain{portKey, nodeName}
+			}
+			sort.Strings(localNodes)
+		}
+
+		// ExternalIPs.  Redirect the traffic to the addresses
+		// to the same KUBE-SVC- chain.
+		for _, ipStr := range spec.ExternalIPs {
+			ip := net.ParseIP(ipStr)
+			if ip == nil || !converter.SameFamily(ip, clusterIP) {
+				continue
+			}
+			addExternalPort(subs, portKey, ip, proto, port, localNodes)
+		}
+
+		// LoadBalancer.  Redirect the traffic to the ingress
+		// addresses to the same KUBE-SVC- chain.
+		// Note: The addresses are allocated by the loadbalancer
+		// controller.
+		for _, ing := range status.LoadBalancer.Ingress {
+			ip := net.ParseIP(ing.IP)
+			if ip == nil || !converter.SameFamily(ip, clusterIP) {
+				continue
+			}
+			addExternalPort(subs, portKey, ip, proto, port, localNodes)
+		}
+
+		// NodePort.  Redirect the traffic to the port on every
+		// Node addresses to the same KUBE-SVC- chain.
+		// With externalTrafficPolicy=Local, redirect to the chain
+		// for the Node instead.
+		if p.NodePort == 0 {
+			continue
+		}
+		nodePort := int(p.NodePort)
+		for nodeName, ips := range nodeIPs {
+			localNode := ""
+			if local {
+				localNode = nodeName
+			}
+			for _, ip := range ips {
+				if !converter.SameFamily(ip, clusterIP) {
+					continue
+				}
+				k := converter.Key{
+					Kind: "Service-Port",
+					Name: fmt.Sprintf("%s/%s/%d/%d%s", portKey, ip, proto, nodePort, localSuffix(localNode)),
+				}
+				subs[k] = &servicePort{portKey: portKey, ip: ip.String(), proto: proto, port: nodePort, localNode: localNode}
+			}
+		}
 	}
 	return resources, subs, nil
 }
+
+// addExternalPort adds sub resources to redirect the traffic to
+// an external address of a service port, i.e. one of ExternalIPs or
+// LoadBalancer ingress addresses.
+// With externalTrafficPolicy=Local, localNodes is the sorted names of
+// all Nodes.  Unlike NodePorts, the address itself doesn't tell which
+// Node received the traffic.  Instead, the traffic entering from
+// the interface of a Node is redirected to the chain for the Node.
+// The rest, i.e. the traffic from Pods, uses all endpoints like
+// kube-proxy does.  The rules match disjoint sets of Ports so that
+// their order in the chain doesn't matter.
+func addExternalPort(subs converter.SubResourceMap, portKey string, ip net.IP, proto int, port int, localNodes []string) {
+	name := fmt.Sprintf("%s/%s/%d/%d", portKey, ip, proto, port)
+	if len(localNodes) == 0 {
+		k := converter.Key{
+			Kind: "Service-Port",
+			Name: name,
+		}
+		subs[k] = &servicePort{portKey: portKey, ip: ip.String(), proto: proto, port: port}
+		return
+	}
+	for _, nodeName := range localNodes {
+		k := converter.Key{
+			Kind: "Service-Port",
+			Name: fmt.Sprintf("%s%s", name, localSuffix(nodeName)),
+		}
+		subs[k] = &servicePort{portKey: portKey, ip: ip.String(), proto: proto, port: port, localNode: nodeName, fromNodes: []string{nodeName}}
+	}
+	// The rule excludes the Ports of all Nodes.  Thus the key includes
+	// the set of Nodes as MidoNet Rules are not updateable.
+	h := fnv.New32a()
+	for _, nodeName := range localNodes {
+		fmt.Fprintf(h, "%s,", nodeName)
+	}
+	k := converter.Key{
+		Kind: "Service-Port",
+		Name: fmt.Sprintf("%s/pods/%08x", name, h.Sum32()),
+	}
+	subs[k] = &servicePort{portKey: portKey, ip: ip.String(), proto: proto, port: port, fromNodes: localNodes, invFromNodes: true}
+}
+
+func localSuffix(nodeName string) string {
+	if nodeName == "" {
+		return ""
+	}
+	return fmt.Sprintf("/local/%s", nodeName)
+}
@@ -16,14 +16,75 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
+	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 )
 
+var (
+	nodeFoo = &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "foo"},
+				{Type: v1.NodeExternalIP, Address: "192.2.0.9"},
+				{Type: v1.NodeInternalIP, Address: "192.2.0.10"},
+			},
+		},
+	}
+
+	nodeBar = &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "bar",
+		},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "192.2.0.11"},
+				{Type: v1.NodeInternalIP, Address: "2001:db8::11"},
+			},
+		},
+	}
+)
+
+type objLister struct {
+	objs map[string]interface{}
+}
+
+func (s *objLister) ListKeys() []string {
+	keys := make([]string, 0, len(s.objs))
+	for k := range s.objs {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *objLister) GetByKey(key string) (interface{}, bool, error) {
+	obj, exists := s.objs[key]
+	return obj, exists, nil
+}
+
+type objErrorLister struct{}
+
+func (s *objErrorLister) ListKeys() []string {
+	return []string{"foo"}
+}
+
+func (s *objErrorLister) GetByKey(key string) (interface{}, bool, error) {
+	return nil, false, errors.New("Some error")
+}
+
 func TestConverterUnsupportedType(t *testing.T) {
 	key := converter.Key{
 		Kind:      "Service",
@@ -32,7 +93,7 @@ func TestConverterUnsupportedType(t *testing.T) {
 	}
 	obj := &v1.Service{
 		Spec: v1.ServiceSpec{
-			Type:      v1.ServiceTypeLoadBalancer,
+			Type:      v1.ServiceTypeExternalName,
 			ClusterIP: "192.2.0.1",
 			Ports: []v1.ServicePort{
 				{
@@ -114,6 +175,66 @@ func TestConverterClusterIPNone(t *testing.T) {
 	assert.Len(t, subs, 0)
 }
 
+func TestConverterIPv6ClusterIP(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeNodePort,
+			ClusterIP: "fd00:96::10",
+			Ports: []v1.ServicePort{
+				{
+					Name:     "cat",
+					Protocol: "UDP",
+					Port:     8000,
+					NodePort: 30080,
+				},
+			},
+			ExternalIPs: []string{
+				"192.2.0.10",
+				"fd00:192:2::10",
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &serviceConverter{nodeLister: &objLister{
+		objs: map[string]interface{}{
+			"foo": nodeFoo,
+			"bar": nodeBar,
+		},
+	}}
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 1)
+	assert.Len(t, subs, 3)
+	k := converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/fd00:96::10/17/8000",
+	}
+	assert.Contains(t, subs, k)
+	rs, err = subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	rule := rs[0].(*midonet.Rule)
+	assert.Equal(t, 0x86dd, rule.DLType)
+	assert.Equal(t, "fd00:96::10", rule.NWDstAddress)
+	assert.Equal(t, 128, rule.NWDstLength)
+	// Only the ExternalIPs and the Node addresses of the same family
+	// as the ClusterIP
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/fd00:192:2::10/17/8000",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/2001:db8::11/17/30080",
+	})
+}
+
 func TestConverterNoPorts(t *testing.T) {
 	key := converter.Key{
 		Kind:      "Node",
@@ -177,3 +298,556 @@ func TestConverter(t *testing.T) {
 		Name: "foo/bar/dog/192.2.0.1/6/200",
 	})
 }
+
+func TestConverterNodePort(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeNodePort,
+			ClusterIP: "192.2.0.1",
+			Ports: []v1.ServicePort{
+				{
+					Name:     "cat",
+					Protocol: "UDP",
+					Port:     8000,
+					NodePort: 30080,
+				},
+				{
+					Name:     "dog",
+					Protocol: "TCP",
+					Port:     200,
+					NodePort: 30200,
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &serviceConverter{nodeLister: &objLister{
+		objs: map[string]interface{}{
+			"foo": nodeFoo,
+			"bar": nodeBar,
+		},
+	}}
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 2)
+	assert.Len(t, subs, 8)
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/192.2.0.1/17/8000",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/192.2.0.9/17/30080",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/192.2.0.10/17/30080",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/192.2.0.11/17/30080",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.1/6/200",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.9/6/30200",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.10/6/30200",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.11/6/30200",
+	})
+}
+
+func TestConverterNodePortWithoutNodes(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeNodePort,
+			ClusterIP: "192.2.0.1",
+			Ports: []v1.ServicePort{
+				{
+					Name:     "cat",
+					Protocol: "UDP",
+					Port:     8000,
+					NodePort: 30080,
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &serviceConverter{nodeLister: &objLister{}}
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 1)
+	assert.Len(t, subs, 1)
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/192.2.0.1/17/8000",
+	})
+}
+
+func TestConverterNodePortListerError(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeNodePort,
+			ClusterIP: "192.2.0.1",
+			Ports: []v1.ServicePort{
+				{
+					Name:     "cat",
+					Protocol: "UDP",
+					Port:     8000,
+					NodePort: 30080,
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &serviceConverter{nodeLister: &objErrorLister{}}
+	_, _, err := c.Convert(key, obj, config)
+	assert.Error(t, err)
+}
+
+func TestConverterLoadBalancer(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeLoadBalancer,
+			ClusterIP: "192.2.0.1",
+			Ports: []v1.ServicePort{
+				{
+					Name:     "dog",
+					Protocol: "TCP",
+					Port:     200,
+					NodePort: 30200,
+				},
+			},
+		},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{
+					{IP: "198.51.100.3"},
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &serviceConverter{nodeLister: &objLister{
+		objs: map[string]interface{}{
+			"bar": nodeBar,
+		},
+	}}
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 1)
+	assert.Len(t, subs, 3)
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.1/6/200",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/198.51.100.3/6/200",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.11/6/30200",
+	})
+}
+
+func TestConverterExternalIPs(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:        v1.ServiceTypeClusterIP,
+			ClusterIP:   "192.2.0.1",
+			ExternalIPs: []string{"198.51.100.1", "198.51.100.2"},
+			Ports: []v1.ServicePort{
+				{
+					Name:     "cat",
+					Protocol: "UDP",
+					Port:     8000,
+				},
+				{
+					Name:     "dog",
+					Protocol: "TCP",
+					Port:     200,
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &serviceConverter{}
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 2)
+	assert.Len(t, subs, 6)
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/198.51.100.1/17/8000",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/cat/198.51.100.2/17/8000",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/198.51.100.1/6/200",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/198.51.100.2/6/200",
+	})
+	// Each sub resources should have its own rule ID.
+	ids := make(map[string]bool)
+	for k, sub := range subs {
+		srs, err := sub.Convert(k, config)
+		assert.Nil(t, err)
+		assert.Len(t, srs, 1)
+		ids[srs[0].(*midonet.Rule).ID.String()] = true
+	}
+	assert.Len(t, ids, 6)
+}
+
+func TestConverterSCTP(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeClusterIP,
+			ClusterIP: "192.2.0.1",
+			Ports: []v1.ServicePort{
+				{
+					Name:     "bird",
+					Protocol: "SCTP",
+					Port:     3868,
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &serviceConverter{}
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 1)
+	assert.Len(t, subs, 1)
+	k := converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/bird/192.2.0.1/132/3868",
+	}
+	assert.Contains(t, subs, k)
+	srs, err := subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	assert.Equal(t, 132, srs[0].(*midonet.Rule).NWProto)
+}
+
+func TestConverterUnsupportedProtocol(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "bar",
+		},
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeClusterIP,
+			ClusterIP: "192.2.0.1",
+			Ports: []v1.ServicePort{
+				{
+					Name:     "cat",
+					Protocol: "DCCP",
+					Port:     8000,
+				},
+				{
+					Name:     "dog",
+					Protocol: "TCP",
+					Port:     200,
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	recorder := record.NewFakeRecorder(10)
+	c := &serviceConverter{recorder: recorder}
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 1)
+	assert.Len(t, subs, 1)
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.1/6/200",
+	})
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning UnsupportedProtocol")
+}
+
+func TestConverterSessionAffinityTimeout(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	timeout := v1.DefaultClientIPServiceAffinitySeconds
+	obj := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "bar",
+		},
+		Spec: v1.ServiceSpec{
+			Type:            v1.ServiceTypeClusterIP,
+			ClusterIP:       "192.2.0.1",
+			SessionAffinity: v1.ServiceAffinityClientIP,
+			SessionAffinityConfig: &v1.SessionAffinityConfig{
+				ClientIP: &v1.ClientIPConfig{
+					TimeoutSeconds: &timeout,
+				},
+			},
+			Ports: []v1.ServicePort{
+				{
+					Name:     "dog",
+					Protocol: "TCP",
+					Port:     200,
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	recorder := record.NewFakeRecorder(10)
+	c := &serviceConverter{recorder: recorder}
+	// The default is silently accepted.
+	_, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 1)
+	assert.Len(t, recorder.Events, 0)
+
+	timeout = 60
+	_, subs, err = c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, subs, 1)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning UnsupportedSessionAffinityTimeout")
+}
+
+func TestConverterNodePortLocal(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:                  v1.ServiceTypeNodePort,
+			ClusterIP:             "192.2.0.1",
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal,
+			Ports: []v1.ServicePort{
+				{
+					Name:     "dog",
+					Protocol: "TCP",
+					Port:     200,
+					NodePort: 30200,
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &serviceConverter{nodeLister: &objLister{
+		objs: map[string]interface{}{
+			"foo": nodeFoo,
+			"bar": nodeBar,
+		},
+	}}
+	rs, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	assert.Len(t, rs, 1)
+	assert.Len(t, subs, 6)
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.1/6/200",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Local",
+		Name: "foo/bar/dog/foo",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Local",
+		Name: "foo/bar/dog/bar",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.9/6/30200/local/foo",
+	})
+	assert.Contains(t, subs, converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.10/6/30200/local/foo",
+	})
+	k := converter.Key{
+		Kind: "Service-Port",
+		Name: "foo/bar/dog/192.2.0.11/6/30200/local/bar",
+	}
+	assert.Contains(t, subs, k)
+	srs, err := subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	chainID := LocalChainID("foo/bar/dog", "bar", config)
+	assert.Equal(t, &chainID, srs[0].(*midonet.Rule).JumpChainID)
+
+	// The local chain drops the traffic unless it's DNATed to
+	// a local endpoint.
+	k = converter.Key{
+		Kind: "Service-Local",
+		Name: "foo/bar/dog/bar",
+	}
+	srs, err = subs[k].Convert(k, config)
+	assert.Nil(t, err)
+	assert.Len(t, srs, 4)
+	epChainID := LocalEndpointsChainID("foo/bar/dog", "bar", config)
+	assert.Equal(t, &epChainID, srs[0].(*midonet.Chain).ID)
+	assert.Equal(t, &chainID, srs[1].(*midonet.Chain).ID)
+	jump := srs[2].(*midonet.Rule)
+	assert.Equal(t, &chainID, jump.Parent.ID)
+	assert.Equal(t, &epChainID, jump.JumpChainID)
+	assert.Equal(t, 1, jump.Position)
+	drop := srs[3].(*midonet.Rule)
+	assert.Equal(t, &chainID, drop.Parent.ID)
+	assert.Equal(t, "drop", drop.Type)
+	// The last rule of the chain
+	assert.Equal(t, 2, drop.Position)
+	// Matches everything
+	assert.Equal(t, 0, drop.DLType)
+	assert.Nil(t, drop.TPSrc)
+	assert.Equal(t, "", drop.NWSrcAddress)
+}
+
+func TestConverterLoadBalancerLocal(t *testing.T) {
+	key := converter.Key{
+		Kind:      "Service",
+		Namespace: "foo",
+		Name:      "bar",
+	}
+	obj := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:                  v1.ServiceTypeLoadBalancer,
+			ClusterIP:             "192.2.0.1",
+			ExternalIPs:           []string{"198.51.100.1"},
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal,
+			Ports: []v1.ServicePort{
+				{
+					Name:     "dog",
+					Protocol: "TCP",
+					Port:     200,
+					NodePort: 30200,
+				},
+			},
+		},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{
+					{IP: "198.51.100.100"},
+				},
+			},
+		},
+	}
+	config := &converter.Config{
+		Tenant: "MyTenant",
+	}
+	c := &serviceConverter{nodeLister: &objLister{
+		objs: map[string]interface{}{
+			"foo": nodeFoo,
+			"bar": nodeBar,
+		},
+	}}
+	_, subs, err := c.Convert(key, obj, config)
+	assert.Nil(t, err)
+	// ClusterIP, 2 Service-Local, 3 NodePorts, and 3 for each of
+	// the external addresses
+	assert.Len(t, subs, 12)
+	for _, ip := range []string{"198.51.100.1", "198.51.100.100"} {
+		// The traffic received by a Node goes to its KUBE-XLB- chain.
+		k := converter.Key{
+			Kind: "Service-Port",
+			Name: fmt.Sprintf("foo/bar/dog/%s/6/200/local/bar", ip),
+		}
+		assert.Contains(t, subs, k)
+		srs, err := subs[k].Convert(k, config)
+		assert.Nil(t, err)
+		rule := srs[0].(*midonet.Rule)
+		chainID := LocalChainID("foo/bar/dog", "bar", config)
+		assert.Equal(t, &chainID, rule.JumpChainID)
+		assert.Equal(t, []uuid.UUID{converter.NodePortID("bar", config)}, rule.InPorts)
+		assert.False(t, rule.InvInPorts)
+		assert.Contains(t, subs, converter.Key{
+			Kind: "Service-Port",
+			Name: fmt.Sprintf("foo/bar/dog/%s/6/200/local/foo", ip),
+		})
+
+		// The rest goes to the KUBE-SVC- chain.
+		var rest []converter.Key
+		for k := range subs {
+			if strings.HasPrefix(k.Name, fmt.Sprintf("foo/bar/dog/%s/6/200/pods/", ip)) {
+				rest = append(rest, k)
+			}
+		}
+		assert.Len(t, rest, 1)
+		srs, err = subs[rest[0]].Convert(rest[0], config)
+		assert.Nil(t, err)
+		rule = srs[0].(*midonet.Rule)
+		chainID = converter.IDForKey("ServicePort", "foo/bar/dog", config)
+		assert.Equal(t, &chainID, rule.JumpChainID)
+		assert.Equal(t, []uuid.UUID{
+			converter.NodePortID("bar", config),
+			converter.NodePortID("foo", config),
+		}, rule.InPorts)
+		assert.True(t, rule.InvInPorts)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package service
+
+import (
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// newNodeEventHandler creates an event handler which queues Services
+// with NodePorts when the set of Node addresses might have been changed.
+func newNodeEventHandler(svcLister cache.KeyListerGetter, queue workqueue.Interface) cache.ResourceEventHandler {
+	queueNodePortServices := func() {
+		for _, k := range svcLister.ListKeys() {
+			obj, exists, err := svcLister.GetByKey(k)
+			if err != nil || !exists {
+				continue
+			}
+			if !hasNodePorts(&obj.(*v1.Service).Spec) {
+				continue
+			}
+			log.WithField("key", k).Debug("Queueing for Node changes")
+			queue.Add(k)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			queueNodePortServices()
+		},
+		UpdateFunc: func(old, new interface{}) {
+			// Ignore Node status updates which don't change
+			// addresses.  They happen periodically.
+			oldAddrs := old.(*v1.Node).Status.Addresses
+			newAddrs := new.(*v1.Node).Status.Addresses
+			if reflect.DeepEqual(oldAddrs, newAddrs) {
+				return
+			}
+			queueNodePortServices()
+		},
+		DeleteFunc: func(obj interface{}) {
+			queueNodePortServices()
+		},
+	}
+}
@@ -16,6 +16,11 @@
 package service
 
 import (
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+
 	"github.com/midonet/midonet-kubernetes/pkg/converter"
 	"github.com/midonet/midonet-kubernetes/pkg/midonet"
 )
@@ -25,23 +30,88 @@ type servicePort struct {
 	ip      string
 	proto   int
 	port    int
+	// If non-empty, jump to the chain for the Node, rather than
+	// the KUBE-SVC- chain.
+	localNode string
+	// If non-empty, only match the traffic entering from the Ports
+	// of the Nodes, or from the other Ports if invFromNodes is true.
+	fromNodes    []string
+	invFromNodes bool
 }
 
 func (s *servicePort) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
 	svcsChainID := converter.ServicesChainID(config)
 	jumpRuleID := converter.IDForKey("ServicePortSub", key.Key(), config)
 	portChainID := converter.IDForKey("ServicePort", s.portKey, config)
+	if s.localNode != "" {
+		portChainID = LocalChainID(s.portKey, s.localNode, config)
+	}
+	ip := net.ParseIP(s.ip)
+	var inPorts []uuid.UUID
+	for _, nodeName := range s.fromNodes {
+		inPorts = append(inPorts, converter.NodePortID(nodeName, config))
+	}
 	return []converter.BackendResource{
 		&midonet.Rule{
 			Parent:       midonet.Parent{ID: &svcsChainID},
 			ID:           &jumpRuleID,
-			DLType:       0x800,
+			DLType:       converter.EtherType(ip),
 			NWDstAddress: s.ip,
-			NWDstLength:  32,
+			NWDstLength:  converter.HostPrefixLength(ip),
 			NWProto:      s.proto,
 			TPDst:        &midonet.PortRange{Start: s.port, End: s.port},
+			InPorts:      inPorts,
+			InvInPorts:   s.invFromNodes,
 			Type:         "jump",
 			JumpChainID:  &portChainID,
 		},
 	}, nil
 }
+
+// serviceLocalChain is a sub resource to represent the chain for
+// the traffic to a service port received by a Node, and the chain for
+// the endpoints of the service port, which are local to the Node.
+// Those chains are not a part of the main Translation of the Service,
+// because we want to delete them when Nodes are removed.
+type serviceLocalChain struct {
+	portKey  string
+	nodeName string
+}
+
+func (s *serviceLocalChain) Convert(key converter.Key, config *converter.Config) ([]converter.BackendResource, error) {
+	chainID := LocalChainID(s.portKey, s.nodeName, config)
+	epChainID := LocalEndpointsChainID(s.portKey, s.nodeName, config)
+	jumpRuleID := converter.SubID(chainID, "Jump")
+	dropRuleID := converter.SubID(chainID, "Drop")
+	return []converter.BackendResource{
+		// The endpoints controller adds DNAT rules for the local
+		// endpoints to this chain.  They are kept in a separate chain
+		// so that nothing else is added to the KUBE-XLB- chain below.
+		&midonet.Chain{
+			ID:       &epChainID,
+			Name:     fmt.Sprintf("KUBE-XLB-EP-%s/%s", s.portKey, s.nodeName),
+			TenantID: config.Tenant,
+		},
+		&midonet.Chain{
+			ID:       &chainID,
+			Name:     fmt.Sprintf("KUBE-XLB-%s/%s", s.portKey, s.nodeName),
+			TenantID: config.Tenant,
+		},
+		&midonet.Rule{
+			Parent:      midonet.Parent{ID: &chainID},
+			ID:          &jumpRuleID,
+			Type:        "jump",
+			JumpChainID: &epChainID,
+			Position:    1,
+		},
+		// Drop the traffic if there are no local endpoints, like
+		// kube-proxy does.  Otherwise, it would fall through to
+		// the rest of the chains and reach the ClusterIP itself.
+		&midonet.Rule{
+			Parent:   midonet.Parent{ID: &chainID},
+			ID:       &dropRuleID,
+			Type:     "drop",
+			Position: 2,
+		},
+	}, nil
+}
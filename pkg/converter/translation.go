@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	log "github.com/sirupsen/logrus"
@@ -38,12 +39,16 @@ import (
 
 	mnv1 "github.com/midonet/midonet-kubernetes/pkg/apis/midonet/v1"
 	mncli "github.com/midonet/midonet-kubernetes/pkg/client/clientset/versioned"
+	"github.com/midonet/midonet-kubernetes/pkg/controller"
 	"github.com/midonet/midonet-kubernetes/pkg/k8s"
 )
 
 type translationUpdater struct {
 	client   mncli.Interface
 	recorder record.EventRecorder
+
+	drainingPeriod time.Duration
+	drainableKinds []string
 }
 
 // NewTranslationUpdater returns an updater to store Translation resources.
@@ -54,6 +59,32 @@ func NewTranslationUpdater(client mncli.Interface, recorder record.EventRecorder
 	}
 }
 
+// NewDrainingTranslationUpdater returns an updater to store Translation
+// resources.  Unlike NewTranslationUpdater, stale Translations for Keys
+// of the given kinds are kept for the given period before being deleted,
+// so that existing connections can drain.  A zero period disables
+// draining.
+func NewDrainingTranslationUpdater(client mncli.Interface, recorder record.EventRecorder, period time.Duration, kinds ...string) Updater {
+	return &translationUpdater{
+		client:         client,
+		recorder:       recorder,
+		drainingPeriod: period,
+		drainableKinds: kinds,
+	}
+}
+
+func (u *translationUpdater) drainable(k Key) bool {
+	if u.drainingPeriod <= 0 {
+		return false
+	}
+	for _, kind := range u.drainableKinds {
+		if k.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
 func (u *translationUpdater) Update(parentKind schema.GroupVersionKind, parentObjInterface interface{}, resources map[Key][]BackendResource) error {
 	var parentObj runtime.Object
 	var parentRef *v1.ObjectReference
@@ -115,7 +146,15 @@ func (u *translationUpdater) Update(parentKind schema.GroupVersionKind, parentOb
 	for k, res := range resources {
 		name := k.translationName()
 		name = makeDNS(name)
-		uid, err := u.updateOne(parentRef, ns, name, owners, ownerlabels, finalizers, res)
+		labels := ownerlabels
+		if u.drainable(k) {
+			labels = make(map[string]string)
+			for lk, lv := range ownerlabels {
+				labels[lk] = lv
+			}
+			labels[DrainableLabel] = ""
+		}
+		uid, err := u.updateOne(parentRef, ns, name, owners, labels, finalizers, res)
 		if err != nil {
 			return err
 		}
@@ -158,10 +197,21 @@ func (u *translationUpdater) deleteTranslations(parentRef *v1.ObjectReference, r
 		return err
 	}
 	clog.WithField("objList", objList).Debug("Got Translations")
+	var requeueAfter time.Duration
 	for _, tr := range objList.Items {
 		if contains(keepUIDs, tr.ObjectMeta.UID) {
 			continue
 		}
+		remaining, err := u.drain(parentRef, tr)
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			if requeueAfter == 0 || remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+			continue
+		}
 		err = u.deleteTranslation(tr)
 		if err != nil {
 			return err
@@ -175,9 +225,69 @@ func (u *translationUpdater) deleteTranslations(parentRef *v1.ObjectReference, r
 			}).Info("Global Translation Deleted")
 		}
 	}
+	if requeueAfter > 0 {
+		// Come back to delete the draining Translations.
+		return &controller.RequeueAfterError{After: requeueAfter}
+	}
 	return nil
 }
 
+// drainRemaining returns how long the given stale Translation should be
+// kept, and whether it needs to be marked as draining.
+func drainRemaining(tr *mnv1.Translation, period time.Duration, now time.Time) (time.Duration, bool) {
+	if period <= 0 {
+		return 0, false
+	}
+	if _, ok := tr.ObjectMeta.Labels[DrainableLabel]; !ok {
+		return 0, false
+	}
+	since, ok := tr.ObjectMeta.Annotations[DrainingSinceAnnotation]
+	if !ok {
+		return period, true
+	}
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		// Start over.
+		return period, true
+	}
+	remaining := t.Add(period).Sub(now)
+	if remaining < 0 {
+		return 0, false
+	}
+	return remaining, false
+}
+
+// drain marks the given stale Translation as draining if necessary.
+// It returns how long the Translation should be kept.
+func (u *translationUpdater) drain(parentRef *v1.ObjectReference, tr mnv1.Translation) (time.Duration, error) {
+	now := time.Now()
+	remaining, mark := drainRemaining(&tr, u.drainingPeriod, now)
+	if !mark {
+		return remaining, nil
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				DrainingSinceAnnotation: now.UTC().Format(time.RFC3339),
+			},
+		},
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return 0, err
+	}
+	namespace := tr.ObjectMeta.Namespace
+	name := tr.ObjectMeta.Name
+	_, err = u.client.MidonetV1().Translations(namespace).Patch(name, types.MergePatchType, patchBytes)
+	if err != nil {
+		return 0, err
+	}
+	if parentRef != nil {
+		u.recorder.Eventf(parentRef, v1.EventTypeNormal, "TranslationDraining", "Translation %s/%s UID %s Draining", namespace, name, tr.ObjectMeta.UID)
+	}
+	return remaining, nil
+}
+
 func (u *translationUpdater) deleteTranslation(tr mnv1.Translation) error {
 	namespace := tr.ObjectMeta.Namespace
 	name := tr.ObjectMeta.Name
@@ -245,6 +355,9 @@ func (u *translationUpdater) updateOne(parentRef *v1.ObjectReference, ns, name s
 	}
 	desiredObj := existingObj.DeepCopy()
 	desiredObj.Resources = obj.Resources
+	// The Translation might have been draining.  E.g. an endpoint
+	// which came back.
+	delete(desiredObj.ObjectMeta.Annotations, DrainingSinceAnnotation)
 	desiredData, err := json.Marshal(desiredObj)
 	if err != nil {
 		return "", err
@@ -298,6 +411,8 @@ func checkTranslationUpdate(old *mnv1.Translation, new *mnv1.Translation) {
 // REVISIT: probabaly we should truncate it when too long.
 func makeDNS(name string) string {
 	n := strings.Replace(name, "/", "-", -1)
+	// IPv6 addresses
+	n = strings.Replace(n, ":", "-", -1)
 	n = strings.ToLower(n)
 	// If we changed anything, append the hash of the original string
 	// to maintain uniqueness.
@@ -16,7 +16,11 @@
 package converter
 
 import (
+	"strings"
 	"testing"
+	"time"
+
+	mnv1 "github.com/midonet/midonet-kubernetes/pkg/apis/midonet/v1"
 )
 
 func TestMakeDNS(t *testing.T) {
@@ -42,3 +46,51 @@ func TestMakeDNSWithSlash(t *testing.T) {
 		t.Errorf("got %v\nwant %v", actual, expected)
 	}
 }
+
+func TestMakeDNSWithColon(t *testing.T) {
+	actual := makeDNS("fd00::1")
+	if strings.Contains(actual, ":") {
+		t.Errorf("got %v", actual)
+	}
+	if actual == makeDNS("fd00--1") {
+		t.Errorf("got %v for both", actual)
+	}
+}
+
+func TestDrainRemaining(t *testing.T) {
+	now := time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC)
+	period := 30 * time.Second
+	tr := &mnv1.Translation{}
+	tr.ObjectMeta.Labels = map[string]string{OwnerUIDLabel: "uid"}
+	tr.ObjectMeta.Annotations = map[string]string{}
+	tests := []struct {
+		name         string
+		period       time.Duration
+		drainable    bool
+		since        string
+		expected     time.Duration
+		expectedMark bool
+	}{
+		{"not drainable", period, false, "", 0, false},
+		{"disabled", 0, true, "", 0, false},
+		{"start", period, true, "", period, true},
+		{"draining", period, true, "2018-07-01T00:00:00Z", period, false},
+		{"draining-10s", period, true, "2018-06-30T23:59:50Z", 20 * time.Second, false},
+		{"drained", period, true, "2018-06-30T23:59:00Z", 0, false},
+		{"malformed", period, true, "foo", period, true},
+	}
+	for _, tc := range tests {
+		delete(tr.ObjectMeta.Labels, DrainableLabel)
+		if tc.drainable {
+			tr.ObjectMeta.Labels[DrainableLabel] = ""
+		}
+		delete(tr.ObjectMeta.Annotations, DrainingSinceAnnotation)
+		if tc.since != "" {
+			tr.ObjectMeta.Annotations[DrainingSinceAnnotation] = tc.since
+		}
+		actual, mark := drainRemaining(tr, tc.period, now)
+		if actual != tc.expected || mark != tc.expectedMark {
+			t.Errorf("%s: got %v %v\nwant %v %v", tc.name, actual, mark, tc.expected, tc.expectedMark)
+		}
+	}
+}
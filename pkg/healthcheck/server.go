@@ -0,0 +1,178 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package healthcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Server serves health check node ports for Services on a Node.
+// Like kube-proxy, a health check node port answers 200 only if
+// the Node has local endpoints for the Service.  Otherwise, 503.
+type Server struct {
+	nodeName string
+	svcStore cache.Store
+	epStore  cache.Store
+
+	lock sync.Mutex
+	// health check node port -> service
+	services map[int32]*service
+}
+
+type service struct {
+	key            string
+	localEndpoints int
+	listener       net.Listener
+}
+
+// NewServer creates a Server.  The Server is driven by the Service and
+// Endpoints informers in the given factory.
+func NewServer(nodeName string, si informers.SharedInformerFactory) *Server {
+	svcInformer := si.Core().V1().Services().Informer()
+	epInformer := si.Core().V1().Endpoints().Informer()
+	s := &Server{
+		nodeName: nodeName,
+		svcStore: svcInformer.GetStore(),
+		epStore:  epInformer.GetStore(),
+		services: make(map[int32]*service),
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			s.sync()
+		},
+		UpdateFunc: func(old, new interface{}) {
+			s.sync()
+		},
+		DeleteFunc: func(obj interface{}) {
+			s.sync()
+		},
+	}
+	svcInformer.AddEventHandler(handler)
+	epInformer.AddEventHandler(handler)
+	return s
+}
+
+// countLocalEndpoints returns the number of ready endpoint addresses
+// on the given Node.
+func countLocalEndpoints(eps *v1.Endpoints, nodeName string) int {
+	n := 0
+	for _, s := range eps.Subsets {
+		for _, a := range s.Addresses {
+			if a.NodeName != nil && *a.NodeName == nodeName {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (s *Server) localEndpoints(key string) int {
+	obj, exists, err := s.epStore.GetByKey(key)
+	if err != nil || !exists {
+		return 0
+	}
+	return countLocalEndpoints(obj.(*v1.Endpoints), s.nodeName)
+}
+
+// sync opens and closes health check node ports, and updates
+// the number of local endpoints for them.
+func (s *Server) sync() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	wanted := make(map[int32]string)
+	for _, obj := range s.svcStore.List() {
+		svc := obj.(*v1.Service)
+		// Note: HealthCheckNodePort is allocated only for
+		// LoadBalancer Services with externalTrafficPolicy=Local.
+		port := svc.Spec.HealthCheckNodePort
+		if port == 0 {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(svc)
+		if err != nil {
+			continue
+		}
+		wanted[port] = key
+	}
+	for port, svc := range s.services {
+		if wanted[port] == svc.key {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"service": svc.key,
+			"port":    port,
+		}).Info("Closing health check node port")
+		svc.listener.Close()
+		delete(s.services, port)
+	}
+	for port, key := range wanted {
+		svc, ok := s.services[port]
+		if !ok {
+			clog := log.WithFields(log.Fields{
+				"service": key,
+				"port":    port,
+			})
+			l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+			if err != nil {
+				// Retry on the next event.
+				clog.WithError(err).Error("Failed to open health check node port")
+				continue
+			}
+			clog.Info("Opened health check node port")
+			svc = &service{
+				key:      key,
+				listener: l,
+			}
+			s.services[port] = svc
+			go s.serve(svc)
+		}
+		svc.localEndpoints = s.localEndpoints(key)
+	}
+}
+
+func (s *Server) serve(svc *service) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		count := svc.localEndpoints
+		s.lock.Unlock()
+		ns, name, _ := cache.SplitMetaNamespaceKey(svc.key)
+		w.Header().Set("Content-Type", "application/json")
+		if count == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"service": map[string]string{
+				"namespace": ns,
+				"name":      name,
+			},
+			"localEndpoints": count,
+		})
+	})
+	// Note: Serve returns an error when the listener is closed.
+	http.Serve(svc.listener, mux)
+}
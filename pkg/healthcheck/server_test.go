@@ -0,0 +1,50 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package healthcheck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+)
+
+func TestCountLocalEndpoints(t *testing.T) {
+	node1 := "node1"
+	node2 := "node2"
+	eps := &v1.Endpoints{
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses: []v1.EndpointAddress{
+					{IP: "10.0.0.1", NodeName: &node1},
+					{IP: "10.0.0.2", NodeName: &node2},
+					{IP: "192.0.2.1"},
+				},
+				NotReadyAddresses: []v1.EndpointAddress{
+					{IP: "10.0.0.3", NodeName: &node1},
+				},
+			},
+			{
+				Addresses: []v1.EndpointAddress{
+					{IP: "10.0.0.4", NodeName: &node1},
+				},
+			},
+		},
+	}
+	assert.Equal(t, 2, countLocalEndpoints(eps, "node1"))
+	assert.Equal(t, 1, countLocalEndpoints(eps, "node2"))
+	assert.Equal(t, 0, countLocalEndpoints(eps, "node3"))
+}
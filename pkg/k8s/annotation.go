@@ -60,6 +60,14 @@ func AddPodAnnotation(client *kubernetes.Clientset, namespace, name, key, value
 	return err
 }
 
+func GetPodAnnotation(client *kubernetes.Clientset, namespace, name, key string) (string, error) {
+	pod, err := client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return pod.ObjectMeta.Annotations[key], nil
+}
+
 func DeletePodAnnotation(client *kubernetes.Clientset, namespace, name, key string) error {
 	old, err := client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
 	if err != nil {
@@ -97,3 +105,22 @@ func AddNodeAnnotation(client *kubernetes.Clientset, name, key, value string) er
 	// REVISIT: maybe worth a retry in case of version mismatch?
 	return err
 }
+
+func DeleteNodeAnnotation(client *kubernetes.Clientset, name, key string) error {
+	old, err := client.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	new := old.DeepCopy()
+	delete(new.ObjectMeta.Annotations, key)
+	if len(new.ObjectMeta.Annotations) == 0 {
+		new.ObjectMeta.Annotations = nil
+	}
+	patchBytes, err := makeStrategicMergePatch(old, new, v1.Node{})
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().Nodes().Patch(name, types.StrategicMergePatchType, patchBytes)
+	// REVISIT: maybe worth a retry in case of version mismatch?
+	return err
+}
@@ -0,0 +1,174 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package loadbalancer
+
+import (
+	"net"
+
+	log "github.com/sirupsen/logrus"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/midonet/midonet-kubernetes/pkg/k8s"
+)
+
+type allocatorHandler struct {
+	kc        kubernetes.Interface
+	recorder  record.EventRecorder
+	svcLister cache.KeyListerGetter
+	pool      *pool
+	synced    bool
+}
+
+func newHandler(kc kubernetes.Interface, recorder record.EventRecorder, svcLister cache.KeyListerGetter, cidr string) (*allocatorHandler, error) {
+	pool, err := newPool(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return &allocatorHandler{
+		kc:        kc,
+		recorder:  recorder,
+		svcLister: svcLister,
+		pool:      pool,
+	}, nil
+}
+
+func ingressIPs(svc *v1.Service) []net.IP {
+	var ips []net.IP
+	for _, ing := range svc.Status.LoadBalancer.Ingress {
+		ip := net.ParseIP(ing.IP)
+		if ip == nil {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+func hasIngressIP(svc *v1.Service, ip net.IP) bool {
+	for _, i := range ingressIPs(svc) {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncPool records addresses which have already been allocated,
+// possibly by a previous instance of the controller.
+func (h *allocatorHandler) syncPool() {
+	if h.synced {
+		return
+	}
+	for _, key := range h.svcLister.ListKeys() {
+		obj, exists, err := h.svcLister.GetByKey(key)
+		if err != nil || !exists {
+			continue
+		}
+		svc := obj.(*v1.Service)
+		if svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		for _, ip := range ingressIPs(svc) {
+			if !h.pool.usable(ip) {
+				continue
+			}
+			err := h.pool.assign(key, ip)
+			if err != nil {
+				log.WithError(err).WithField("service", key).Warn("Ignoring a conflicting LoadBalancer address")
+			}
+		}
+	}
+	h.synced = true
+}
+
+func (h *allocatorHandler) ipFor(key string, svc *v1.Service) (net.IP, error) {
+	// Note: net.ParseIP returns nil for an empty string.
+	requested := net.ParseIP(svc.Spec.LoadBalancerIP)
+	ip, ok := h.pool.lookup(key)
+	if ok && (requested == nil || requested.Equal(ip)) {
+		return ip, nil
+	}
+	// Note: The address previously assigned to the Service is
+	// released only after the requested one is assigned.  Thus,
+	// if the requested one is not available, the Service keeps it.
+	return h.pool.allocate(key, requested)
+}
+
+func (h *allocatorHandler) updateStatus(svc *v1.Service, status v1.LoadBalancerStatus) error {
+	new := svc.DeepCopy()
+	new.Status.LoadBalancer = status
+	_, err := h.kc.CoreV1().Services(svc.ObjectMeta.Namespace).UpdateStatus(new)
+	return err
+}
+
+func (h *allocatorHandler) Update(key string, gvk schema.GroupVersionKind, obj interface{}) error {
+	h.syncPool()
+	svc := obj.(*v1.Service)
+	clog := log.WithFields(log.Fields{
+		"service": key,
+	})
+	clog.Debug("loadbalancer Service update handler")
+	ref, err := k8s.GetReferenceForEvent(svc)
+	if err != nil {
+		return err
+	}
+	if svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+		// The Service might have been a LoadBalancer previously.
+		ip, ok := h.pool.lookup(key)
+		if !ok {
+			return nil
+		}
+		if hasIngressIP(svc, ip) {
+			err := h.updateStatus(svc, v1.LoadBalancerStatus{})
+			if err != nil {
+				return err
+			}
+		}
+		h.pool.release(key)
+		h.recorder.Eventf(ref, v1.EventTypeNormal, "LoadBalancerIPReleased", "Released %s", ip)
+		return nil
+	}
+	ip, err := h.ipFor(key, svc)
+	if err != nil {
+		h.recorder.Eventf(ref, v1.EventTypeWarning, "LoadBalancerIPAllocationFailed", "Failed to allocate LoadBalancer IP: %v", err)
+		return err
+	}
+	if hasIngressIP(svc, ip) {
+		/* nothing to do */
+		return nil
+	}
+	err = h.updateStatus(svc, v1.LoadBalancerStatus{
+		Ingress: []v1.LoadBalancerIngress{
+			{IP: ip.String()},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	h.recorder.Eventf(ref, v1.EventTypeNormal, "LoadBalancerIPAllocated", "Allocated %s", ip)
+	return nil
+}
+
+func (h *allocatorHandler) Delete(key string) error {
+	h.syncPool()
+	h.pool.release(key)
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package loadbalancer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func newTestService(name string, lbIP string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      name,
+		},
+		Spec: v1.ServiceSpec{
+			Type:           v1.ServiceTypeLoadBalancer,
+			LoadBalancerIP: lbIP,
+		},
+	}
+}
+
+func newTestHandler(t *testing.T, svcs ...*v1.Service) (*allocatorHandler, *fake.Clientset) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	kc := fake.NewSimpleClientset()
+	for _, svc := range svcs {
+		store.Add(svc)
+		kc.Tracker().Add(svc)
+	}
+	h, err := newHandler(kc, record.NewFakeRecorder(100), store, "192.2.0.0/30")
+	assert.Nil(t, err)
+	return h, kc
+}
+
+// update calls the handler with the current Service as the controller
+// does, and returns the updated one.
+func update(t *testing.T, h *allocatorHandler, kc *fake.Clientset, svc *v1.Service) (*v1.Service, error) {
+	key, _ := cache.MetaNamespaceKeyFunc(svc)
+	cur, err := kc.CoreV1().Services(svc.Namespace).Get(svc.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	cur.Spec = svc.Spec
+	err = h.Update(key, v1.SchemeGroupVersion.WithKind("Service"), cur)
+	new, getErr := kc.CoreV1().Services(svc.Namespace).Get(svc.Name, metav1.GetOptions{})
+	assert.Nil(t, getErr)
+	return new, err
+}
+
+func TestHandlerAllocate(t *testing.T) {
+	a := newTestService("a", "")
+	h, kc := newTestHandler(t, a)
+	svc, err := update(t, h, kc, a)
+	assert.Nil(t, err)
+	assert.Equal(t, []v1.LoadBalancerIngress{{IP: "192.2.0.1"}}, svc.Status.LoadBalancer.Ingress)
+	// No changes
+	svc, err = update(t, h, kc, svc)
+	assert.Nil(t, err)
+	assert.Equal(t, []v1.LoadBalancerIngress{{IP: "192.2.0.1"}}, svc.Status.LoadBalancer.Ingress)
+}
+
+func TestHandlerSyncPool(t *testing.T) {
+	a := newTestService("a", "")
+	a.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "192.2.0.1"}}
+	b := newTestService("b", "")
+	h, kc := newTestHandler(t, a, b)
+	// The address allocated by a previous instance is kept.
+	svc, err := update(t, h, kc, b)
+	assert.Nil(t, err)
+	assert.Equal(t, []v1.LoadBalancerIngress{{IP: "192.2.0.2"}}, svc.Status.LoadBalancer.Ingress)
+}
+
+func TestHandlerRequestedIP(t *testing.T) {
+	a := newTestService("a", "")
+	b := newTestService("b", "")
+	h, kc := newTestHandler(t, a, b)
+	_, err := update(t, h, kc, a)
+	assert.Nil(t, err)
+	svc, err := update(t, h, kc, b)
+	assert.Nil(t, err)
+	assert.Equal(t, []v1.LoadBalancerIngress{{IP: "192.2.0.2"}}, svc.Status.LoadBalancer.Ingress)
+
+	// The requested address is in use.  "b" keeps its address.
+	svc.Spec.LoadBalancerIP = "192.2.0.1"
+	_, err = update(t, h, kc, svc)
+	assert.Error(t, err)
+	ip, ok := h.pool.lookup("foo/b")
+	assert.True(t, ok)
+	assert.Equal(t, "192.2.0.2", ip.String())
+	ip, ok = h.pool.lookup("foo/a")
+	assert.True(t, ok)
+	assert.Equal(t, "192.2.0.1", ip.String())
+
+	// The requested address is not in the pool.
+	svc.Spec.LoadBalancerIP = "198.51.100.1"
+	_, err = update(t, h, kc, svc)
+	assert.Error(t, err)
+	ip, ok = h.pool.lookup("foo/b")
+	assert.True(t, ok)
+	assert.Equal(t, "192.2.0.2", ip.String())
+
+	// Released by "a".  Now "b" can move to the requested address.
+	err = h.Delete("foo/a")
+	assert.Nil(t, err)
+	svc.Spec.LoadBalancerIP = "192.2.0.1"
+	svc, err = update(t, h, kc, svc)
+	assert.Nil(t, err)
+	assert.Equal(t, []v1.LoadBalancerIngress{{IP: "192.2.0.1"}}, svc.Status.LoadBalancer.Ingress)
+	// The old address is released.
+	ip, err = h.pool.allocate("foo/c", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.2.0.2", ip.String())
+}
+
+func TestHandlerNotLoadBalancer(t *testing.T) {
+	a := newTestService("a", "")
+	h, kc := newTestHandler(t, a)
+	svc, err := update(t, h, kc, a)
+	assert.Nil(t, err)
+	assert.Len(t, svc.Status.LoadBalancer.Ingress, 1)
+	svc.Spec.Type = v1.ServiceTypeClusterIP
+	svc, err = update(t, h, kc, svc)
+	assert.Nil(t, err)
+	assert.Empty(t, svc.Status.LoadBalancer.Ingress)
+	_, ok := h.pool.lookup("foo/a")
+	assert.False(t, ok)
+}
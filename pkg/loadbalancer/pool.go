@@ -0,0 +1,132 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package loadbalancer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// pool is a pool of IPv4 addresses for LoadBalancer Services.
+// It isn't goroutine-safe.  It's expected to be used only by
+// the single worker of the controller.
+type pool struct {
+	subnet *net.IPNet
+	// IP address -> Service key
+	owners map[string]string
+	// Service key -> IP address
+	addrs map[string]string
+}
+
+func newPool(cidr string) (*pool, error) {
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if subnet.IP.To4() == nil {
+		return nil, fmt.Errorf("Only IPv4 is supported for LoadBalancer pool: %s", cidr)
+	}
+	return &pool{
+		subnet: subnet,
+		owners: make(map[string]string),
+		addrs:  make(map[string]string),
+	}, nil
+}
+
+// usable returns true if the given IP is in the pool and can be
+// allocated.  The network and broadcast addresses are not usable.
+func (p *pool) usable(ip net.IP) bool {
+	ip4 := ip.To4()
+	if ip4 == nil || !p.subnet.Contains(ip4) {
+		return false
+	}
+	ones, bits := p.subnet.Mask.Size()
+	if bits-ones < 2 {
+		// /31 and /32.  Every addresses are usable.
+		return true
+	}
+	n := binary.BigEndian.Uint32(ip4)
+	first := binary.BigEndian.Uint32(p.subnet.IP.To4())
+	last := first | ^binary.BigEndian.Uint32(net.IP(p.subnet.Mask).To4())
+	return n != first && n != last
+}
+
+// lookup returns the IP address assigned to the Service.
+func (p *pool) lookup(key string) (net.IP, bool) {
+	ip, ok := p.addrs[key]
+	if !ok {
+		return nil, false
+	}
+	return net.ParseIP(ip), true
+}
+
+// assign records the IP address as assigned to the Service.
+// It's used for addresses which have been allocated before,
+// e.g. by a previous instance of the controller.
+func (p *pool) assign(key string, ip net.IP) error {
+	owner, ok := p.owners[ip.String()]
+	if ok && owner != key {
+		return fmt.Errorf("%s is already assigned to %s", ip, owner)
+	}
+	p.release(key)
+	p.owners[ip.String()] = key
+	p.addrs[key] = ip.String()
+	return nil
+}
+
+// allocate allocates an IP address for the Service.  If requested is
+// non-nil, only the address is considered.  Otherwise, the first free
+// address in the pool is used.
+func (p *pool) allocate(key string, requested net.IP) (net.IP, error) {
+	if requested != nil {
+		if !p.usable(requested) {
+			return nil, fmt.Errorf("%s is not in the pool %s", requested, p.subnet)
+		}
+		err := p.assign(key, requested)
+		if err != nil {
+			return nil, err
+		}
+		return requested, nil
+	}
+	first := binary.BigEndian.Uint32(p.subnet.IP.To4())
+	ones, bits := p.subnet.Mask.Size()
+	size := uint64(1) << uint(bits-ones)
+	for i := uint64(0); i < size; i++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, first+uint32(i))
+		if !p.usable(ip) {
+			continue
+		}
+		if _, ok := p.owners[ip.String()]; ok {
+			continue
+		}
+		p.owners[ip.String()] = key
+		p.addrs[key] = ip.String()
+		return ip, nil
+	}
+	return nil, fmt.Errorf("No free address in the pool %s", p.subnet)
+}
+
+// release releases the IP address assigned to the Service, if any.
+func (p *pool) release(key string) {
+	ip, ok := p.addrs[key]
+	if !ok {
+		return
+	}
+	delete(p.addrs, key)
+	delete(p.owners, ip)
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package loadbalancer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPoolInvalid(t *testing.T) {
+	_, err := newPool("192.2.0.0/33")
+	assert.Error(t, err)
+	_, err = newPool("2001:db8::/64")
+	assert.Error(t, err)
+}
+
+func TestPoolAllocate(t *testing.T) {
+	p, err := newPool("192.2.0.0/30")
+	assert.Nil(t, err)
+	ip, err := p.allocate("foo/a", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.2.0.1", ip.String())
+	ip, err = p.allocate("foo/b", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.2.0.2", ip.String())
+	// The broadcast address is not usable.
+	_, err = p.allocate("foo/c", nil)
+	assert.Error(t, err)
+	p.release("foo/a")
+	ip, err = p.allocate("foo/c", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.2.0.1", ip.String())
+	ip, ok := p.lookup("foo/c")
+	assert.True(t, ok)
+	assert.Equal(t, "192.2.0.1", ip.String())
+	_, ok = p.lookup("foo/a")
+	assert.False(t, ok)
+}
+
+func TestPoolAllocateRequested(t *testing.T) {
+	p, err := newPool("192.2.0.0/24")
+	assert.Nil(t, err)
+	ip, err := p.allocate("foo/a", net.ParseIP("192.2.0.100"))
+	assert.Nil(t, err)
+	assert.Equal(t, "192.2.0.100", ip.String())
+	_, err = p.allocate("foo/b", net.ParseIP("192.2.0.100"))
+	assert.Error(t, err)
+	_, err = p.allocate("foo/b", net.ParseIP("192.2.0.0"))
+	assert.Error(t, err)
+	_, err = p.allocate("foo/b", net.ParseIP("198.51.100.1"))
+	assert.Error(t, err)
+	ip, err = p.allocate("foo/b", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.2.0.1", ip.String())
+}
+
+func TestPoolAssign(t *testing.T) {
+	p, err := newPool("192.2.0.0/24")
+	assert.Nil(t, err)
+	err = p.assign("foo/a", net.ParseIP("192.2.0.1"))
+	assert.Nil(t, err)
+	err = p.assign("foo/a", net.ParseIP("192.2.0.1"))
+	assert.Nil(t, err)
+	err = p.assign("foo/b", net.ParseIP("192.2.0.1"))
+	assert.Error(t, err)
+	ip, err := p.allocate("foo/b", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.2.0.2", ip.String())
+}
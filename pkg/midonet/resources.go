@@ -191,6 +191,7 @@ type Port struct {
 	PortMAC          HardwareAddr   `json:"portMac,omitempty"`
 	InboundFilterID  *uuid.UUID     `json:"inboundFilterId,omitempty"`
 	OutboundFilterID *uuid.UUID     `json:"outboundFilterId,omitempty"`
+	QOSPolicyID      *uuid.UUID     `json:"qosPolicyId,omitempty"`
 }
 
 func (*Port) MediaType() string {
@@ -248,6 +249,7 @@ type Route struct {
 	SrcNetworkAddr   net.IP     `json:"srcNetworkAddr"`
 	SrcNetworkLength int        `json:"srcNetworkLength"`
 	Type             string     `json:"type"`
+	Weight           int        `json:"weight,omitempty"`
 }
 
 func (*Route) MediaType() string {
@@ -292,16 +294,40 @@ func (res *Chain) Path(op string) string {
 type Rule struct {
 	midonetResource
 	Parent
-	ID           *uuid.UUID `json:"id,omitempty"`
-	Type         string     `json:"type"`
-	DLType       int        `json:"dlType,omitempty"`
-	NWDstAddress string     `json:"nwDstAddress,omitempty"`
-	NWDstLength  int        `json:"nwDstLength,omitempty"`
-	NWProto      int        `json:"nwProto,omitempty"`
-	NWSrcAddress string     `json:"nwSrcAddress,omitempty"`
-	NWSrcLength  int        `json:"nwSrcLength,omitempty"`
-	TPDst        *PortRange `json:"tpDst,omitempty"`
-	TPSrc        *PortRange `json:"tpSrc,omitempty"`
+	ID           *uuid.UUID   `json:"id,omitempty"`
+	Type         string       `json:"type"`
+	DLSrc        HardwareAddr `json:"dlSrc,omitempty"`
+	DLType       int          `json:"dlType,omitempty"`
+	NWDstAddress string       `json:"nwDstAddress,omitempty"`
+	NWDstLength  int          `json:"nwDstLength,omitempty"`
+	NWProto      int          `json:"nwProto,omitempty"`
+	NWSrcAddress string       `json:"nwSrcAddress,omitempty"`
+	NWSrcLength  int          `json:"nwSrcLength,omitempty"`
+	TPDst        *PortRange   `json:"tpDst,omitempty"`
+	TPSrc        *PortRange   `json:"tpSrc,omitempty"`
+
+	// Match the traffic entering from the Ports, or from the other
+	// Ports if inverted.
+	InPorts    []uuid.UUID `json:"inPorts,omitempty"`
+	InvInPorts bool        `json:"invInPorts,omitempty"`
+
+	// Invert the matches.
+	InvDLSrc bool `json:"invDlSrc,omitempty"`
+	InvNWSrc bool `json:"invNwSrc,omitempty"`
+
+	// Match the addresses in IPAddrGroups, or not in them if inverted.
+	IPAddrGroupDst    *uuid.UUID `json:"ipAddrGroupDst,omitempty"`
+	IPAddrGroupSrc    *uuid.UUID `json:"ipAddrGroupSrc,omitempty"`
+	InvIPAddrGroupDst bool       `json:"invIpAddrGroupDst,omitempty"`
+	InvIPAddrGroupSrc bool       `json:"invIpAddrGroupSrc,omitempty"`
+
+	// Match only the forward (or return) flows of tracked connections.
+	MatchForwardFlow bool `json:"matchForwardFlow,omitempty"`
+	MatchReturnFlow  bool `json:"matchReturnFlow,omitempty"`
+
+	// The 1-origin position in the chain.  Zero means the default
+	// of MidoNet API.  It's only meaningful on creation.
+	Position int `json:"position,omitempty"`
 
 	// JUMP
 	JumpChainID *uuid.UUID `json:"jumpChainId,omitempty"`
@@ -328,6 +354,114 @@ func (res *Rule) Path(op string) string {
 	}
 }
 
+// IPAddrGroup implements https://docs.midonet.org/docs/v5.4/en/rest-api/content/ip-addr-group.html
+type IPAddrGroup struct {
+	midonetResource
+	ID   *uuid.UUID `json:"id,omitempty"`
+	Name string     `json:"name,omitempty"`
+}
+
+func (*IPAddrGroup) MediaType() string {
+	return "application/vnd.org.midonet.IpAddrGroup-v1+json"
+}
+
+func (res *IPAddrGroup) Path(op string) string {
+	switch op {
+	case "POST":
+		return "/ip_addr_groups"
+	case "DELETE", "GET":
+		return fmt.Sprintf("/ip_addr_groups/%s", res.ID)
+	default:
+		return ""
+	}
+}
+
+// IPAddrGroupAddr implements https://docs.midonet.org/docs/v5.4/en/rest-api/content/ip-addr-group-addr.html
+type IPAddrGroupAddr struct {
+	midonetResource
+	Parent
+	Addr    net.IP `json:"addr"`
+	Version int    `json:"version"`
+}
+
+func (*IPAddrGroupAddr) MediaType() string {
+	return "application/vnd.org.midonet.IpAddrGroupAddr-v1+json"
+}
+
+func (res *IPAddrGroupAddr) Path(op string) string {
+	switch op {
+	case "POST":
+		return fmt.Sprintf("/ip_addr_groups/%s/ip_addrs", res.Parent.ID)
+	case "DELETE", "GET":
+		return fmt.Sprintf("/ip_addr_groups/%s/versions/%d/ip_addrs/%s", res.Parent.ID, res.Version, res.Addr)
+	default:
+		return ""
+	}
+}
+
+// NewIPAddrGroupAddr is a convenient function to construct
+// an IPAddrGroupAddr with the version of the given address.
+func NewIPAddrGroupAddr(groupID *uuid.UUID, addr net.IP) *IPAddrGroupAddr {
+	version := 6
+	if addr.To4() != nil {
+		addr = addr.To4()
+		version = 4
+	}
+	return &IPAddrGroupAddr{
+		Parent:  Parent{ID: groupID},
+		Addr:    addr,
+		Version: version,
+	}
+}
+
+// QOSPolicy implements https://docs.midonet.org/docs/latest/rest-api/content/qos-policy.html
+type QOSPolicy struct {
+	midonetResource
+	ID          *uuid.UUID `json:"id,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Shared      bool       `json:"shared"`
+}
+
+func (*QOSPolicy) MediaType() string {
+	return "application/vnd.org.midonet.QosPolicy-v1+json"
+}
+
+func (res *QOSPolicy) Path(op string) string {
+	switch op {
+	case "POST":
+		return "/qos_policies"
+	case "PUT", "DELETE", "GET":
+		return fmt.Sprintf("/qos_policies/%s", res.ID)
+	default:
+		return ""
+	}
+}
+
+// QOSBWLimitRule implements https://docs.midonet.org/docs/latest/rest-api/content/qos-bw-limit-rule.html
+type QOSBWLimitRule struct {
+	midonetResource
+	Parent
+	ID           *uuid.UUID `json:"id,omitempty"`
+	MaxKbps      int        `json:"max_kbps"`
+	MaxBurstKbps int        `json:"max_burst_kbps,omitempty"`
+}
+
+func (*QOSBWLimitRule) MediaType() string {
+	return "application/vnd.org.midonet.QosRuleBWLimit-v1+json"
+}
+
+func (res *QOSBWLimitRule) Path(op string) string {
+	switch op {
+	case "POST":
+		return fmt.Sprintf("/qos_policies/%s/qos_bw_limit_rules", res.Parent.ID)
+	case "PUT", "DELETE", "GET":
+		return fmt.Sprintf("/qos_bw_limit_rules/%s", res.ID)
+	default:
+		return ""
+	}
+}
+
 // Host implements https://docs.midonet.org/docs/v5.4/en/rest-api/content/host.html
 type Host struct {
 	midonetResource
@@ -160,6 +160,61 @@ func TestIP4MACPair(t *testing.T) {
 	}
 }
 
+func TestIPAddrGroupAddr(t *testing.T) {
+	groupID, _ := uuid.Parse("2bdd2d6a-95ff-11e8-bcfa-0015170bebef")
+	res := NewIPAddrGroupAddr(&groupID, net.ParseIP("192.168.1.1"))
+	actual := res.Path("DELETE")
+	expected := "/ip_addr_groups/2bdd2d6a-95ff-11e8-bcfa-0015170bebef/versions/4/ip_addrs/192.168.1.1"
+	if actual != expected {
+		t.Errorf("got %v\nwant %v", actual, expected)
+	}
+	res = NewIPAddrGroupAddr(&groupID, net.ParseIP("2001:db8::1"))
+	actual = res.Path("DELETE")
+	expected = "/ip_addr_groups/2bdd2d6a-95ff-11e8-bcfa-0015170bebef/versions/6/ip_addrs/2001:db8::1"
+	if actual != expected {
+		t.Errorf("got %v\nwant %v", actual, expected)
+	}
+}
+
+func TestQOSPolicy(t *testing.T) {
+	id, _ := uuid.Parse("2bdd2d6a-95ff-11e8-bcfa-0015170bebef")
+	res := &QOSPolicy{
+		ID:   &id,
+		Name: "foo",
+	}
+	actual, err := json.Marshal(res)
+	if err != nil {
+		t.Errorf("got error %v", err)
+	}
+	expected := `{"id":"2bdd2d6a-95ff-11e8-bcfa-0015170bebef","name":"foo","shared":false}`
+	if string(actual) != expected {
+		t.Errorf("got %v\nwant %v", string(actual), expected)
+	}
+}
+
+func TestQOSBWLimitRule(t *testing.T) {
+	policyID, _ := uuid.Parse("2bdd2d6a-95ff-11e8-bcfa-0015170bebef")
+	id, _ := uuid.Parse("dbb7065f-ab57-433c-92b6-84816a9e87be")
+	res := &QOSBWLimitRule{
+		Parent:  Parent{ID: &policyID},
+		ID:      &id,
+		MaxKbps: 1000,
+	}
+	actual, err := json.Marshal(res)
+	if err != nil {
+		t.Errorf("got error %v", err)
+	}
+	expected := `{"id":"dbb7065f-ab57-433c-92b6-84816a9e87be","max_kbps":1000}`
+	if string(actual) != expected {
+		t.Errorf("got %v\nwant %v", string(actual), expected)
+	}
+	path := res.Path("POST")
+	expectedPath := "/qos_policies/2bdd2d6a-95ff-11e8-bcfa-0015170bebef/qos_bw_limit_rules"
+	if path != expectedPath {
+		t.Errorf("got %v\nwant %v", path, expectedPath)
+	}
+}
+
 func TestAPIResources(t *testing.T) {
 	objs := []APIResource{
 		&TunnelZone{},
@@ -175,6 +230,10 @@ func TestAPIResources(t *testing.T) {
 		&HostInterfacePort{},
 		&MACPort{},
 		&IPv4MACPair{},
+		&IPAddrGroup{},
+		&IPAddrGroupAddr{},
+		&QOSPolicy{},
+		&QOSBWLimitRule{},
 	}
 	methods := []string{
 		"GET",
@@ -0,0 +1,36 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package midonet
+
+import (
+	"fmt"
+)
+
+// TunnelOverhead returns the number of bytes the encapsulation for
+// the given type of Tunnel Zone adds to a packet.  It includes
+// the inner Ethernet header, which doesn't count in the MTU of
+// the encapsulated interface.
+func TunnelOverhead(tunnelZoneType string) (int, error) {
+	switch tunnelZoneType {
+	case "vxlan", "vtep":
+		// IPv4 + UDP + VXLAN + Ethernet
+		return 20 + 8 + 8 + 14, nil
+	case "gre":
+		// IPv4 + GRE with a key + Ethernet
+		return 20 + 8 + 14, nil
+	}
+	return 0, fmt.Errorf("unknown tunnel zone type %q", tunnelZoneType)
+}
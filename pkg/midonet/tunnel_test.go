@@ -0,0 +1,40 @@
+// Copyright (C) 2018 Midokura SARL.
+// All rights reserved.
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package midonet
+
+import (
+	"testing"
+)
+
+func TestTunnelOverhead(t *testing.T) {
+	cases := map[string]int{
+		"vxlan": 50,
+		"vtep":  50,
+		"gre":   42,
+	}
+	for typ, expected := range cases {
+		actual, err := TunnelOverhead(typ)
+		if err != nil {
+			t.Errorf("got error %v", err)
+		}
+		if actual != expected {
+			t.Errorf("got %v\nwant %v", actual, expected)
+		}
+	}
+	if _, err := TunnelOverhead("foo"); err == nil {
+		t.Errorf("got no error for an unknown type")
+	}
+}
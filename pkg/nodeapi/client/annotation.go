@@ -78,3 +78,23 @@ func DeletePodAnnotation(namespace, name, key string) (error, string) {
 	}
 	return nil, ""
 }
+
+func GetPodAnnotation(namespace, name, key string) (string, error, string) {
+	client, err := newClient()
+	if err != nil {
+		return "", err, ""
+	}
+	req := &nodeapi.GetPodAnnotationRequest{
+		Namespace: namespace,
+		Name:      name,
+		Key:       key,
+	}
+	reply, err := client.GetPodAnnotation(context.Background(), req)
+	if err != nil {
+		return "", err, ""
+	}
+	if reply.Error != "" {
+		return "", errors.New(reply.Error), reply.Metav1StatusReason
+	}
+	return reply.Value, nil, ""
+}
@@ -37,7 +37,7 @@ func (m *AddPodAnnotationRequest) Reset()         { *m = AddPodAnnotationRequest
 func (m *AddPodAnnotationRequest) String() string { return proto.CompactTextString(m) }
 func (*AddPodAnnotationRequest) ProtoMessage()    {}
 func (*AddPodAnnotationRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_noderpc_23fc216ecb65138b, []int{0}
+	return fileDescriptor_noderpc_688f4e75a3303f08, []int{0}
 }
 func (m *AddPodAnnotationRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_AddPodAnnotationRequest.Unmarshal(m, b)
@@ -97,7 +97,7 @@ func (m *AddPodAnnotationReply) Reset()         { *m = AddPodAnnotationReply{} }
 func (m *AddPodAnnotationReply) String() string { return proto.CompactTextString(m) }
 func (*AddPodAnnotationReply) ProtoMessage()    {}
 func (*AddPodAnnotationReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_noderpc_23fc216ecb65138b, []int{1}
+	return fileDescriptor_noderpc_688f4e75a3303f08, []int{1}
 }
 func (m *AddPodAnnotationReply) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_AddPodAnnotationReply.Unmarshal(m, b)
@@ -144,7 +144,7 @@ func (m *DeletePodAnnotationRequest) Reset()         { *m = DeletePodAnnotationR
 func (m *DeletePodAnnotationRequest) String() string { return proto.CompactTextString(m) }
 func (*DeletePodAnnotationRequest) ProtoMessage()    {}
 func (*DeletePodAnnotationRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_noderpc_23fc216ecb65138b, []int{2}
+	return fileDescriptor_noderpc_688f4e75a3303f08, []int{2}
 }
 func (m *DeletePodAnnotationRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DeletePodAnnotationRequest.Unmarshal(m, b)
@@ -197,7 +197,7 @@ func (m *DeletePodAnnotationReply) Reset()         { *m = DeletePodAnnotationRep
 func (m *DeletePodAnnotationReply) String() string { return proto.CompactTextString(m) }
 func (*DeletePodAnnotationReply) ProtoMessage()    {}
 func (*DeletePodAnnotationReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_noderpc_23fc216ecb65138b, []int{3}
+	return fileDescriptor_noderpc_688f4e75a3303f08, []int{3}
 }
 func (m *DeletePodAnnotationReply) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DeletePodAnnotationReply.Unmarshal(m, b)
@@ -231,11 +231,121 @@ func (m *DeletePodAnnotationReply) GetMetav1StatusReason() string {
 	return ""
 }
 
+type GetPodAnnotationRequest struct {
+	Namespace            string   `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name                 string   `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Key                  string   `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetPodAnnotationRequest) Reset()         { *m = GetPodAnnotationRequest{} }
+func (m *GetPodAnnotationRequest) String() string { return proto.CompactTextString(m) }
+func (*GetPodAnnotationRequest) ProtoMessage()    {}
+func (*GetPodAnnotationRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_noderpc_688f4e75a3303f08, []int{4}
+}
+func (m *GetPodAnnotationRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetPodAnnotationRequest.Unmarshal(m, b)
+}
+func (m *GetPodAnnotationRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetPodAnnotationRequest.Marshal(b, m, deterministic)
+}
+func (dst *GetPodAnnotationRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetPodAnnotationRequest.Merge(dst, src)
+}
+func (m *GetPodAnnotationRequest) XXX_Size() int {
+	return xxx_messageInfo_GetPodAnnotationRequest.Size(m)
+}
+func (m *GetPodAnnotationRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetPodAnnotationRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetPodAnnotationRequest proto.InternalMessageInfo
+
+func (m *GetPodAnnotationRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *GetPodAnnotationRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *GetPodAnnotationRequest) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+type GetPodAnnotationReply struct {
+	Value                string   `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Error                string   `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	Metav1StatusReason   string   `protobuf:"bytes,3,opt,name=metav1_status_reason,json=metav1StatusReason,proto3" json:"metav1_status_reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetPodAnnotationReply) Reset()         { *m = GetPodAnnotationReply{} }
+func (m *GetPodAnnotationReply) String() string { return proto.CompactTextString(m) }
+func (*GetPodAnnotationReply) ProtoMessage()    {}
+func (*GetPodAnnotationReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_noderpc_688f4e75a3303f08, []int{5}
+}
+func (m *GetPodAnnotationReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetPodAnnotationReply.Unmarshal(m, b)
+}
+func (m *GetPodAnnotationReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetPodAnnotationReply.Marshal(b, m, deterministic)
+}
+func (dst *GetPodAnnotationReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetPodAnnotationReply.Merge(dst, src)
+}
+func (m *GetPodAnnotationReply) XXX_Size() int {
+	return xxx_messageInfo_GetPodAnnotationReply.Size(m)
+}
+func (m *GetPodAnnotationReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetPodAnnotationReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetPodAnnotationReply proto.InternalMessageInfo
+
+func (m *GetPodAnnotationReply) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *GetPodAnnotationReply) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *GetPodAnnotationReply) GetMetav1StatusReason() string {
+	if m != nil {
+		return m.Metav1StatusReason
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*AddPodAnnotationRequest)(nil), "nodeapi.AddPodAnnotationRequest")
 	proto.RegisterType((*AddPodAnnotationReply)(nil), "nodeapi.AddPodAnnotationReply")
 	proto.RegisterType((*DeletePodAnnotationRequest)(nil), "nodeapi.DeletePodAnnotationRequest")
 	proto.RegisterType((*DeletePodAnnotationReply)(nil), "nodeapi.DeletePodAnnotationReply")
+	proto.RegisterType((*GetPodAnnotationRequest)(nil), "nodeapi.GetPodAnnotationRequest")
+	proto.RegisterType((*GetPodAnnotationReply)(nil), "nodeapi.GetPodAnnotationReply")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -252,6 +362,7 @@ const _ = grpc.SupportPackageIsVersion4
 type MidoNetKubeNodeClient interface {
 	AddPodAnnotation(ctx context.Context, in *AddPodAnnotationRequest, opts ...grpc.CallOption) (*AddPodAnnotationReply, error)
 	DeletePodAnnotation(ctx context.Context, in *DeletePodAnnotationRequest, opts ...grpc.CallOption) (*DeletePodAnnotationReply, error)
+	GetPodAnnotation(ctx context.Context, in *GetPodAnnotationRequest, opts ...grpc.CallOption) (*GetPodAnnotationReply, error)
 }
 
 type midoNetKubeNodeClient struct {
@@ -280,10 +391,20 @@ func (c *midoNetKubeNodeClient) DeletePodAnnotation(ctx context.Context, in *Del
 	return out, nil
 }
 
+func (c *midoNetKubeNodeClient) GetPodAnnotation(ctx context.Context, in *GetPodAnnotationRequest, opts ...grpc.CallOption) (*GetPodAnnotationReply, error) {
+	out := new(GetPodAnnotationReply)
+	err := c.cc.Invoke(ctx, "/nodeapi.MidoNetKubeNode/GetPodAnnotation", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MidoNetKubeNodeServer is the server API for MidoNetKubeNode service.
 type MidoNetKubeNodeServer interface {
 	AddPodAnnotation(context.Context, *AddPodAnnotationRequest) (*AddPodAnnotationReply, error)
 	DeletePodAnnotation(context.Context, *DeletePodAnnotationRequest) (*DeletePodAnnotationReply, error)
+	GetPodAnnotation(context.Context, *GetPodAnnotationRequest) (*GetPodAnnotationReply, error)
 }
 
 func RegisterMidoNetKubeNodeServer(s *grpc.Server, srv MidoNetKubeNodeServer) {
@@ -326,6 +447,24 @@ func _MidoNetKubeNode_DeletePodAnnotation_Handler(srv interface{}, ctx context.C
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MidoNetKubeNode_GetPodAnnotation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPodAnnotationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MidoNetKubeNodeServer).GetPodAnnotation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/nodeapi.MidoNetKubeNode/GetPodAnnotation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MidoNetKubeNodeServer).GetPodAnnotation(ctx, req.(*GetPodAnnotationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _MidoNetKubeNode_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "nodeapi.MidoNetKubeNode",
 	HandlerType: (*MidoNetKubeNodeServer)(nil),
@@ -338,30 +477,37 @@ var _MidoNetKubeNode_serviceDesc = grpc.ServiceDesc{
 			MethodName: "DeletePodAnnotation",
 			Handler:    _MidoNetKubeNode_DeletePodAnnotation_Handler,
 		},
+		{
+			MethodName: "GetPodAnnotation",
+			Handler:    _MidoNetKubeNode_GetPodAnnotation_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "noderpc.proto",
 }
 
-func init() { proto.RegisterFile("noderpc.proto", fileDescriptor_noderpc_23fc216ecb65138b) }
-
-var fileDescriptor_noderpc_23fc216ecb65138b = []byte{
-	// 269 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x52, 0xcd, 0x4a, 0x03, 0x31,
-	0x10, 0xb6, 0xb6, 0x2a, 0x1d, 0x10, 0xcb, 0x58, 0x31, 0x2c, 0x22, 0x35, 0x5e, 0x3c, 0x2d, 0xfe,
-	0x3c, 0x41, 0xc1, 0x9b, 0x58, 0x64, 0x05, 0xaf, 0x6b, 0xb6, 0x99, 0xc3, 0xe2, 0x36, 0x13, 0x93,
-	0x6c, 0xa1, 0xaf, 0xe8, 0x53, 0xc9, 0x66, 0x17, 0x05, 0x6d, 0x7b, 0xd2, 0xdb, 0x7c, 0x3f, 0xe1,
-	0xe3, 0x9b, 0x09, 0x1c, 0x1a, 0xd6, 0xe4, 0xec, 0x3c, 0xb5, 0x8e, 0x03, 0xe3, 0x41, 0x03, 0x95,
-	0x2d, 0xa5, 0x87, 0xd3, 0xa9, 0xd6, 0x4f, 0xac, 0xa7, 0xc6, 0x70, 0x50, 0xa1, 0x64, 0x93, 0xd1,
-	0x7b, 0x4d, 0x3e, 0xe0, 0x19, 0x0c, 0x8d, 0x5a, 0x90, 0xb7, 0x6a, 0x4e, 0xa2, 0x37, 0xe9, 0x5d,
-	0x0d, 0xb3, 0x6f, 0x02, 0x11, 0x06, 0x0d, 0x10, 0xbb, 0x51, 0x88, 0x33, 0x8e, 0xa0, 0xff, 0x46,
-	0x2b, 0xd1, 0x8f, 0x54, 0x33, 0xe2, 0x18, 0xf6, 0x96, 0xaa, 0xaa, 0x49, 0x0c, 0x22, 0xd7, 0x02,
-	0x99, 0xc3, 0xc9, 0xef, 0x50, 0x5b, 0x45, 0x3b, 0x39, 0xc7, 0xae, 0x8b, 0x6b, 0x01, 0x5e, 0xc3,
-	0x78, 0x41, 0x41, 0x2d, 0x6f, 0x72, 0x1f, 0x54, 0xa8, 0x7d, 0xee, 0x48, 0x79, 0x36, 0x5d, 0x34,
-	0xb6, 0xda, 0x73, 0x94, 0xb2, 0xa8, 0xc8, 0x57, 0x48, 0xee, 0xa9, 0xa2, 0x40, 0xff, 0x55, 0x4c,
-	0x16, 0x20, 0xd6, 0x26, 0xfc, 0x61, 0x8b, 0xdb, 0x8f, 0x1e, 0x1c, 0x3d, 0x96, 0x9a, 0x67, 0x14,
-	0x1e, 0xea, 0x82, 0x66, 0xac, 0x09, 0x5f, 0x60, 0xf4, 0x73, 0x75, 0x38, 0x49, 0xbb, 0x6b, 0xa6,
-	0x1b, 0x4e, 0x99, 0x9c, 0x6f, 0x71, 0xd8, 0x6a, 0x25, 0x77, 0x30, 0x87, 0xe3, 0x35, 0x7d, 0xf0,
-	0xf2, 0xeb, 0xe1, 0xe6, 0x7d, 0x26, 0x17, 0xdb, 0x4d, 0x31, 0xa0, 0xd8, 0x8f, 0x1f, 0xef, 0xee,
-	0x33, 0x00, 0x00, 0xff, 0xff, 0x44, 0xa0, 0x0e, 0x78, 0x89, 0x02, 0x00, 0x00,
+func init() { proto.RegisterFile("noderpc.proto", fileDescriptor_noderpc_688f4e75a3303f08) }
+
+var fileDescriptor_noderpc_688f4e75a3303f08 = []byte{
+	// 315 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x53, 0x4d, 0x4b, 0xc3, 0x40,
+	0x10, 0xb5, 0x1f, 0x2a, 0x1d, 0x10, 0xcb, 0xd8, 0xd2, 0x10, 0xa4, 0xd4, 0x78, 0xf1, 0x54, 0xfc,
+	0xf8, 0x05, 0x05, 0xc1, 0x83, 0x58, 0x24, 0x42, 0x6f, 0x12, 0x37, 0xdd, 0x39, 0x04, 0xd3, 0xdd,
+	0x75, 0x77, 0x53, 0xe8, 0xdf, 0xf1, 0x97, 0x4a, 0x36, 0xc1, 0x96, 0xb6, 0x09, 0x1e, 0xec, 0x6d,
+	0x67, 0xe6, 0x65, 0xdf, 0xbc, 0xbc, 0xb7, 0x70, 0x26, 0x24, 0x27, 0xad, 0xe6, 0x63, 0xa5, 0xa5,
+	0x95, 0x78, 0x9a, 0x97, 0x4c, 0x25, 0x81, 0x81, 0xc1, 0x84, 0xf3, 0x57, 0xc9, 0x27, 0x42, 0x48,
+	0xcb, 0x6c, 0x22, 0x45, 0x48, 0x5f, 0x19, 0x19, 0x8b, 0x97, 0xd0, 0x11, 0x6c, 0x41, 0x46, 0xb1,
+	0x39, 0x79, 0x8d, 0x51, 0xe3, 0xa6, 0x13, 0xae, 0x1b, 0x88, 0xd0, 0xce, 0x0b, 0xaf, 0xe9, 0x06,
+	0xee, 0x8c, 0x5d, 0x68, 0x7d, 0xd2, 0xca, 0x6b, 0xb9, 0x56, 0x7e, 0xc4, 0x1e, 0x1c, 0x2f, 0x59,
+	0x9a, 0x91, 0xd7, 0x76, 0xbd, 0xa2, 0x08, 0x22, 0xe8, 0xef, 0x92, 0xaa, 0xd4, 0xc1, 0x49, 0x6b,
+	0xa9, 0x4b, 0xba, 0xa2, 0xc0, 0x5b, 0xe8, 0x2d, 0xc8, 0xb2, 0xe5, 0x5d, 0x64, 0x2c, 0xb3, 0x99,
+	0x89, 0x34, 0x31, 0x23, 0x45, 0x49, 0x8d, 0xc5, 0xec, 0xcd, 0x8d, 0x42, 0x37, 0x09, 0x3e, 0xc0,
+	0x7f, 0xa4, 0x94, 0x2c, 0x1d, 0x4a, 0x58, 0x10, 0x83, 0xb7, 0x97, 0xe1, 0x3f, 0x55, 0xbc, 0xc3,
+	0xe0, 0x89, 0xec, 0xc1, 0x24, 0x64, 0xd0, 0xdf, 0xbd, 0xbe, 0xdc, 0xbf, 0x30, 0xad, 0xb1, 0x61,
+	0xda, 0x5a, 0x55, 0xf3, 0x2f, 0xaa, 0x5a, 0x55, 0xaa, 0xee, 0xbf, 0x9b, 0x70, 0xfe, 0x92, 0x70,
+	0x39, 0x25, 0xfb, 0x9c, 0xc5, 0x34, 0x95, 0x9c, 0x70, 0x06, 0xdd, 0xed, 0x40, 0xe0, 0x68, 0x5c,
+	0x66, 0x74, 0x5c, 0x11, 0x50, 0x7f, 0x58, 0x83, 0x50, 0xe9, 0x2a, 0x38, 0xc2, 0x08, 0x2e, 0xf6,
+	0xb8, 0x84, 0xd7, 0xbf, 0x1f, 0x56, 0xa7, 0xc4, 0xbf, 0xaa, 0x07, 0x15, 0x04, 0x33, 0xe8, 0x6e,
+	0xff, 0xc3, 0x8d, 0xc5, 0x2b, 0xdc, 0xf3, 0x87, 0x35, 0x08, 0x77, 0x6f, 0x7c, 0xe2, 0x9e, 0xe9,
+	0xc3, 0xcf, 0x00, 0x89, 0x42, 0x4f, 0x86, 0xb7, 0x03, 0x00, 0x00,
 }